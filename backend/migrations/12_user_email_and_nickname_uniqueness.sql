@@ -0,0 +1,19 @@
+-- +goose Up
+-- emails are compared case-insensitively
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email)) AND NOT EXISTS (
+    SELECT 1 FROM users other WHERE other.id <> users.id AND other.email = LOWER(TRIM(users.email))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (LOWER(email));
+
+-- nicknames of people are unique case-insensitively, so give accounts registered without a nickname or with a taken one a unique nickname first
+UPDATE users SET nickname = 'user' || id WHERE TRIM(nickname) = '';
+UPDATE users SET nickname = nickname || '-' || id
+WHERE is_bot = FALSE AND EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.is_bot = FALSE AND LOWER(other.nickname) = LOWER(users.nickname) AND other.id < users.id
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_nickname_lower_idx ON users (LOWER(nickname)) WHERE is_bot = FALSE;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_nickname_lower_idx;
+DROP INDEX IF EXISTS users_email_lower_idx;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- deleted accounts are kept as anonymised rows, so that their messages still have a sender
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- anonymised accounts share the same nickname, so they are excluded from the nickname uniqueness
+DROP INDEX IF EXISTS users_nickname_lower_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_nickname_lower_idx ON users (LOWER(nickname)) WHERE is_bot = FALSE AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_nickname_lower_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_nickname_lower_idx ON users (LOWER(nickname)) WHERE is_bot = FALSE;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- blocked users can't open private chatrooms with or send private messages to the blocker
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INT NOT NULL,
+    blocked_id INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_blocks_blocked_id_idx ON user_blocks (blocked_id);
+
+-- messages of muted users don't count as unread and don't notify the muter
+CREATE TABLE IF NOT EXISTS user_mutes (
+    muter_id INT NOT NULL,
+    muted_id INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (muter_id, muted_id),
+    FOREIGN KEY (muter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (muter_id <> muted_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_mutes_muted_id_idx ON user_mutes (muted_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_mutes;
+DROP TABLE IF EXISTS user_blocks;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS contact_requests (
+    id SERIAL PRIMARY KEY,
+    sender_id INT NOT NULL,
+    recipient_id INT NOT NULL,
+    -- PENDING, ACCEPTED, DECLINED or CANCELLED
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (sender_id <> recipient_id)
+);
+
+-- only one pending request between the same users in the same direction
+CREATE UNIQUE INDEX IF NOT EXISTS contact_requests_pending_idx ON contact_requests (sender_id, recipient_id) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS contact_requests_recipient_id_idx ON contact_requests (recipient_id);
+
+-- contacts are stored in both directions, so that the contacts of a user can be found by user_id
+CREATE TABLE IF NOT EXISTS contacts (
+    user_id INT NOT NULL,
+    contact_id INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, contact_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (contact_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS only_contacts_can_message BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS only_contacts_can_message;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS contact_requests;
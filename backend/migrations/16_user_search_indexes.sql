@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- trigram indexes serve substring and fuzzy matching of search terms with at least 3 characters
+CREATE INDEX IF NOT EXISTS users_nickname_trgm_idx ON users USING GIN (LOWER(nickname) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (LOWER(email) gin_trgm_ops);
+-- shorter search terms only match nickname prefixes
+CREATE INDEX IF NOT EXISTS users_nickname_prefix_idx ON users (LOWER(nickname) text_pattern_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS users_nickname_prefix_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_nickname_trgm_idx;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN status_emoji TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- the expiry job only looks at statuses which have an expiry time
+CREATE INDEX IF NOT EXISTS users_status_expires_at_idx ON users (status_expires_at) WHERE status_expires_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_status_expires_at_idx;
+ALTER TABLE users DROP COLUMN status_expires_at;
+ALTER TABLE users DROP COLUMN status_text;
+ALTER TABLE users DROP COLUMN status_emoji;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS data_exports (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    -- PENDING, PROCESSING, READY, FAILED or EXPIRED
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+    -- path of the archive on the server, set when the export is READY
+    file_path TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- only one export of a user can be in progress
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_in_progress_idx ON data_exports (user_id) WHERE status IN ('PENDING', 'PROCESSING');
+CREATE INDEX IF NOT EXISTS data_exports_status_idx ON data_exports (status);
+
+-- +goose Down
+DROP TABLE IF EXISTS data_exports;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS read_receipts_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+-- EVERYONE, CONTACTS or NOBODY
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_visibility VARCHAR(16) NOT NULL DEFAULT 'EVERYONE';
+-- when the user last disconnected from or connected to the websocket
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_visibility;
+ALTER TABLE users DROP COLUMN IF EXISTS read_receipts_enabled;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- keyset pagination of the user directory by nickname or registration time
+CREATE INDEX IF NOT EXISTS users_directory_nickname_idx ON users (LOWER(nickname), id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS users_directory_created_at_idx ON users (created_at, id) WHERE deleted_at IS NULL;
+-- the active filter looks up the latest activity of the sessions of a user
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_last_active_at_idx ON user_sessions (user_id, last_active_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS user_sessions_user_id_last_active_at_idx;
+DROP INDEX IF EXISTS users_directory_created_at_idx;
+DROP INDEX IF EXISTS users_directory_nickname_idx;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- OWNER, ADMIN or MEMBER. Only group chatrooms have an owner.
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'MEMBER';
+-- existing groups are owned by their participant with the lowest user ID, since the creator wasn't recorded
+UPDATE chatroom_participants cp SET role = 'OWNER'
+FROM (
+    SELECT cp.chatroom_id, MIN(cp.user_id) AS user_id
+    FROM chatroom_participants cp
+    INNER JOIN chatrooms c ON c.id = cp.chatroom_id
+    WHERE c.is_group = TRUE
+    GROUP BY cp.chatroom_id
+) owners
+WHERE cp.chatroom_id = owners.chatroom_id AND cp.user_id = owners.user_id;
+CREATE UNIQUE INDEX IF NOT EXISTS chatroom_participants_one_owner_idx ON chatroom_participants (chatroom_id) WHERE role = 'OWNER';
+
+-- +goose Down
+DROP INDEX IF EXISTS chatroom_participants_one_owner_idx;
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS role;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- USER for messages written by a participant, SYSTEM for membership changes like "Alice added Bob"
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'USER';
+-- MEMBER_ADDED, MEMBER_REMOVED or MEMBER_LEFT for system messages. The sender is the acting user.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS system_event VARCHAR(32);
+-- the participant the system message is about
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS system_user_id INT REFERENCES users(id);
+-- the longest standing admin, or otherwise member, becomes the owner when the owner leaves
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS joined_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS system_user_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS system_event;
+ALTER TABLE messages DROP COLUMN IF EXISTS kind;
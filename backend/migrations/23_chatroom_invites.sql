@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS chatroom_invites (
+    id SERIAL PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    created_by INT NOT NULL,
+    -- only the hash of the token is stored, the prefix lets admins recognise their links
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    prefix VARCHAR(16) NOT NULL,
+    -- unlimited if NULL
+    max_uses INT,
+    use_count INT NOT NULL DEFAULT 0,
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (chatroom_id) REFERENCES chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    CHECK (max_uses IS NULL OR max_uses > 0)
+);
+CREATE INDEX IF NOT EXISTS chatroom_invites_chatroom_id_idx ON chatroom_invites (chatroom_id);
+
+CREATE TABLE IF NOT EXISTS chatroom_join_requests (
+    id SERIAL PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    user_id INT NOT NULL,
+    -- the invite the request was made with
+    invite_id INT,
+    -- PENDING, APPROVED or DECLINED
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    responded_by INT,
+    FOREIGN KEY (chatroom_id) REFERENCES chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (invite_id) REFERENCES chatroom_invites(id) ON DELETE SET NULL,
+    FOREIGN KEY (responded_by) REFERENCES users(id)
+);
+-- only one pending request of a user per chatroom
+CREATE UNIQUE INDEX IF NOT EXISTS chatroom_join_requests_pending_idx ON chatroom_join_requests (chatroom_id, user_id) WHERE status = 'PENDING';
+
+-- +goose Down
+DROP TABLE IF EXISTS chatroom_join_requests;
+DROP TABLE IF EXISTS chatroom_invites;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS topic VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+-- group settings: only owners and admins can send messages, e.g. for announcement groups
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS only_admins_can_send BOOLEAN NOT NULL DEFAULT FALSE;
+-- group settings: members can change the name, description, topic and avatar like admins
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS members_can_edit_info BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS members_can_edit_info;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS only_admins_can_send;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS topic;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS description;
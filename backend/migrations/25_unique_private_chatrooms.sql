@@ -0,0 +1,64 @@
+-- +goose Up
+-- the two users of a private chatroom, the smaller user id first so that every unordered pair has a single chatroom
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS private_user1_id INT REFERENCES users(id);
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS private_user2_id INT REFERENCES users(id);
+ALTER TABLE chatrooms ADD CONSTRAINT chatrooms_private_users_ordered CHECK (private_user1_id < private_user2_id);
+
+-- private chatrooms whose other user deleted the account have a single participant and keep no pair
+UPDATE chatrooms c SET private_user1_id = p.user1_id, private_user2_id = p.user2_id
+FROM (
+    SELECT chatroom_id, MIN(user_id) AS user1_id, MAX(user_id) AS user2_id
+    FROM chatroom_participants
+    GROUP BY chatroom_id
+    HAVING COUNT(*) = 2
+) p
+WHERE c.id = p.chatroom_id AND NOT c.is_group;
+
+-- the oldest private chatroom of every pair is kept and the others are merged into it
+CREATE TEMPORARY TABLE private_chatroom_duplicates AS
+SELECT c.id AS duplicate_id, k.keep_id
+FROM chatrooms c
+INNER JOIN (
+    SELECT private_user1_id, private_user2_id, MIN(id) AS keep_id
+    FROM chatrooms
+    WHERE NOT is_group AND private_user1_id IS NOT NULL
+    GROUP BY private_user1_id, private_user2_id
+) k ON k.private_user1_id = c.private_user1_id AND k.private_user2_id = c.private_user2_id
+WHERE NOT c.is_group AND c.id <> k.keep_id;
+
+-- message views belong to the messages, so they move together with them
+UPDATE messages m SET chatroom_id = d.keep_id
+FROM private_chatroom_duplicates d
+WHERE m.chatroom_id = d.duplicate_id;
+
+UPDATE chatroom_participants cp
+SET unread_count = cp.unread_count + merged.unread_count, joined_at = LEAST(cp.joined_at, merged.joined_at)
+FROM (
+    SELECT d.keep_id, p.user_id, SUM(p.unread_count) AS unread_count, MIN(p.joined_at) AS joined_at
+    FROM chatroom_participants p
+    INNER JOIN private_chatroom_duplicates d ON d.duplicate_id = p.chatroom_id
+    GROUP BY d.keep_id, p.user_id
+) merged
+WHERE cp.chatroom_id = merged.keep_id AND cp.user_id = merged.user_id;
+
+-- API keys restricted to a merged chatroom stay valid for the kept one
+UPDATE api_keys
+SET chatroom_ids = ARRAY(
+    SELECT DISTINCT COALESCE(d.keep_id, chatroom_id)
+    FROM unnest(chatroom_ids) AS chatroom_id
+    LEFT JOIN private_chatroom_duplicates d ON d.duplicate_id = chatroom_id
+)
+WHERE chatroom_ids && ARRAY(SELECT duplicate_id FROM private_chatroom_duplicates);
+
+DELETE FROM chatroom_participants WHERE chatroom_id IN (SELECT duplicate_id FROM private_chatroom_duplicates);
+DELETE FROM chatrooms WHERE id IN (SELECT duplicate_id FROM private_chatroom_duplicates);
+DROP TABLE private_chatroom_duplicates;
+
+ALTER TABLE chatrooms ADD CONSTRAINT chatrooms_private_users_unique UNIQUE (private_user1_id, private_user2_id);
+
+-- +goose Down
+-- merged chatrooms are not split again
+ALTER TABLE chatrooms DROP CONSTRAINT IF EXISTS chatrooms_private_users_unique;
+ALTER TABLE chatrooms DROP CONSTRAINT IF EXISTS chatrooms_private_users_ordered;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS private_user2_id;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS private_user1_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    message_id INT PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    pinned_by INT NOT NULL,
+    pinned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (chatroom_id) REFERENCES chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (pinned_by) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS pinned_messages_chatroom_id_idx ON pinned_messages (chatroom_id, pinned_at);
+-- group settings: members can pin and unpin messages like admins
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS members_can_pin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS members_can_pin;
+DROP TABLE IF EXISTS pinned_messages;
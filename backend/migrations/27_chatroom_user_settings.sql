@@ -0,0 +1,12 @@
+-- +goose Up
+-- settings of a chatroom which only apply to one participant
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS pinned_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS marked_unread BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS marked_unread;
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS pinned_at;
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS muted_until;
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS archived;
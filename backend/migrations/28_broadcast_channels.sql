@@ -0,0 +1,13 @@
+-- +goose Up
+-- channels are group chatrooms in which only owners and admins post
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS is_channel BOOLEAN NOT NULL DEFAULT FALSE;
+-- channels don't store a view per subscriber and message, the subscribers have a read cursor instead
+ALTER TABLE chatroom_participants ADD COLUMN IF NOT EXISTS last_read_message_id INT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS chatroom_participants_read_cursor_idx ON chatroom_participants (chatroom_id, last_read_message_id);
+CREATE INDEX IF NOT EXISTS messages_chatroom_id_id_idx ON messages (chatroom_id, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS messages_chatroom_id_id_idx;
+DROP INDEX IF EXISTS chatroom_participants_read_cursor_idx;
+ALTER TABLE chatroom_participants DROP COLUMN IF EXISTS last_read_message_id;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS is_channel;
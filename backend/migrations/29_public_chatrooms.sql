@@ -0,0 +1,18 @@
+-- +goose Up
+-- group settings: public groups are listed in the chatroom directory where anyone can join them
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
+-- group settings: users who join a public group from the directory send a join request which owners and admins approve
+ALTER TABLE chatrooms ADD COLUMN IF NOT EXISTS join_requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+-- private chatrooms can never be public
+ALTER TABLE chatrooms ADD CONSTRAINT chatrooms_public_group_check CHECK (NOT is_public OR is_group);
+
+-- the directory is ordered by name and searched by substrings of the name and description
+CREATE INDEX IF NOT EXISTS chatrooms_public_name_idx ON chatrooms (LOWER(group_name), id) WHERE is_public;
+CREATE INDEX IF NOT EXISTS chatrooms_public_search_trgm_idx ON chatrooms USING GIN (LOWER(group_name || ' ' || description) gin_trgm_ops) WHERE is_public;
+
+-- +goose Down
+DROP INDEX IF EXISTS chatrooms_public_search_trgm_idx;
+DROP INDEX IF EXISTS chatrooms_public_name_idx;
+ALTER TABLE chatrooms DROP CONSTRAINT IF EXISTS chatrooms_public_group_check;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS join_requires_approval;
+ALTER TABLE chatrooms DROP COLUMN IF EXISTS is_public;
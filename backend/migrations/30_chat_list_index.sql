@@ -0,0 +1,6 @@
+-- +goose Up
+-- the chat list selects the chatrooms of a user, which the primary key starting with chatroom_id doesn't serve
+CREATE INDEX IF NOT EXISTS chatroom_participants_user_id_idx ON chatroom_participants (user_id, archived);
+
+-- +goose Down
+DROP INDEX IF EXISTS chatroom_participants_user_id_idx;
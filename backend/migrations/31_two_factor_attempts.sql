@@ -0,0 +1,8 @@
+-- +goose Up
+-- failed second factor attempts since the last success, so that codes can't be brute-forced within the lifetime of a challenge
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_failed_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_locked_until TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_failed_attempts;
@@ -6,6 +6,7 @@ import (
 	"backend/pkg/api/v1/middleware"
 	"backend/pkg/config"
 	"backend/pkg/consumer"
+	"backend/pkg/model"
 	"backend/pkg/service"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
@@ -21,8 +22,8 @@ func SetupRoutes(app *fiber.App, services *service.Services, messageHub *consume
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost,http://localhost:3000,http://frontend:3000",
-		AllowHeaders: "Content-Type, Authorization",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders: "Content-Type, Authorization, X-Device-Name",
+		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 	}))
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		requestedProtocol := c.Get("Sec-WebSocket-Protocol")
@@ -34,14 +35,18 @@ func SetupRoutes(app *fiber.App, services *service.Services, messageHub *consume
 		}
 		// Extract the JWT token from the second part
 		tokenStr := strings.TrimSpace(parts[1])
-		userID, err := v1.ValidateAuthToken(tokenStr)
+		userID, sessionID, err := v1.ValidateAuthToken(tokenStr)
+		if err == nil {
+			err = services.SessionService.ValidateSession(sessionID, userID)
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "Invalid token",
 			})
 		}
-		// save the user id in Locals to be able to fetch it in websocket handler
+		// save the user id and session id in Locals to be able to fetch them in websocket handler
 		c.Locals("userID", userID)
+		c.Locals("sessionID", sessionID)
 		// check if the client requested upgrade to the WebSocket protocol.
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
@@ -50,10 +55,10 @@ func SetupRoutes(app *fiber.App, services *service.Services, messageHub *consume
 	})
 
 	// Route for serving static files
-	app.Static("/static", "./static")
+	app.Static("/static", config.StaticDir())
 	// WebSocket route
 	app.Get("/ws", websocket.New(
-		ClientWebSocketConnectionHandler(messageHub, services.ChatroomService),
+		ClientWebSocketConnectionHandler(messageHub, services),
 		websocket.Config{
 			Subprotocols: []string{config.WebsocketChatSubProtocol},
 		},
@@ -63,20 +68,89 @@ func SetupRoutes(app *fiber.App, services *service.Services, messageHub *consume
 	})
 	// Grouping API version 1 prefix
 	api := app.Group("/api/v1")
+	auth := middleware.AuthMiddleware(services.SessionService, services.BotService)
+	// authWithAPIKey additionally accepts bot API keys that have the given scope
+	authWithAPIKey := func(scope string) fiber.Handler {
+		return middleware.AuthMiddleware(services.SessionService, services.BotService, scope)
+	}
 	// Swagger documentation route
 	api.Get("/swagger/*", swagger.New(swagger.ConfigDefault))
 	// Auth routes
-	api.Post("/register", v1.RegisterHandler(services.UserService))
-	api.Post("/login", v1.LoginHandler(services.UserService))
-	api.Post("/logout", v1.LogoutHandler())
-	api.Post("/validateToken", v1.ValidateTokenHandler())
+	api.Post("/register", v1.RegisterHandler(services.UserService, services.AuthService, services.SessionService))
+	api.Post("/login", v1.LoginHandler(services.UserService, services.SessionService))
+	api.Post("/login/2fa", v1.TwoFactorLoginHandler(services.AuthService, services.SessionService))
+	api.Post("/logout", auth, v1.LogoutHandler(services.SessionService, messageHub))
+	api.Post("/validateToken", v1.ValidateTokenHandler(services.SessionService))
+	api.Post("/verify-email/request", auth, v1.VerifyEmailRequestHandler(services.UserService, services.AuthService))
+	api.Post("/verify-email/confirm", v1.VerifyEmailConfirmHandler(services.AuthService))
+	api.Post("/password-reset/request", v1.PasswordResetRequestHandler(services.AuthService))
+	api.Post("/password-reset/confirm", v1.PasswordResetConfirmHandler(services.AuthService))
+	// OpenID Connect login routes
+	if services.OIDCService != nil {
+		api.Get("/auth/oidc/login", v1.OIDCLoginHandler(services.OIDCService))
+		api.Get("/auth/oidc/callback", v1.OIDCCallbackHandler(services.OIDCService, services.SessionService))
+	}
+	// Two-factor authentication routes
+	api.Post("/2fa/enrol", auth, v1.BeginTwoFactorEnrolmentHandler(services.AuthService))
+	api.Post("/2fa/confirm", auth, v1.ConfirmTwoFactorEnrolmentHandler(services.AuthService))
+	api.Post("/2fa/disable", auth, v1.DisableTwoFactorHandler(services.AuthService))
+	api.Post("/2fa/recovery-codes", auth, v1.RegenerateRecoveryCodesHandler(services.AuthService))
+	// Session routes
+	api.Get("/sessions", auth, v1.GetSessions(services.SessionService))
+	api.Delete("/sessions", auth, v1.RevokeOtherSessions(services.SessionService, messageHub))
+	api.Delete("/sessions/:id", auth, v1.RevokeSession(services.SessionService, messageHub))
+	// Bot routes
+	api.Post("/bots", auth, v1.CreateBot(services.BotService))
+	api.Get("/bots", auth, v1.GetBots(services.BotService))
+	api.Post("/bots/:id/api-keys", auth, v1.CreateAPIKey(services.BotService))
+	api.Get("/bots/:id/api-keys", auth, v1.GetAPIKeys(services.BotService))
+	api.Delete("/bots/:id/api-keys/:keyID", auth, v1.RevokeAPIKey(services.BotService))
 	// User routes
-	api.Get("/users", middleware.AuthMiddleware(), v1.GetUsers(services.UserService))
-	api.Get("/users/search", middleware.AuthMiddleware(), v1.SearchUsers(services.UserService))
-	api.Get("/users/:id", middleware.AuthMiddleware(), v1.GetUser(services.UserService))
-	api.Delete("/users/:id", middleware.AuthMiddleware(), v1.GetUser(services.UserService))
-	api.Get("/users/:id/chatrooms", middleware.AuthMiddleware(), v1.GetUserChatrooms(services.ChatroomService))
+	api.Get("/users", auth, v1.GetUsers(services.UserService))
+	api.Get("/users/search", auth, v1.SearchUsers(services.UserService))
+	api.Patch("/users/me", auth, v1.UpdateProfile(services.UserService, services.ChatroomService, messageHub))
+	api.Post("/users/me/avatar", auth, v1.UploadAvatar(services.UserService, services.ChatroomService, messageHub))
+	api.Put("/users/me/status", auth, v1.SetStatus(services.UserService, services.ChatroomService, messageHub))
+	api.Delete("/users/me/status", auth, v1.ClearStatus(services.UserService, services.ChatroomService, messageHub))
+	api.Post("/users/me/password", auth, v1.ChangePassword(services.AuthService, services.SessionService, messageHub))
+	api.Post("/users/me/identity-confirmation", auth, v1.RequestIdentityConfirmation(services.AuthService))
+	api.Delete("/users/me", auth, v1.DeleteAccount(services.UserService, services.AuthService, messageHub))
+	api.Get("/users/me/settings", auth, v1.GetUserSettings(services.UserService))
+	api.Patch("/users/me/settings", auth, v1.UpdateUserSettings(services.UserService))
+	api.Get("/users/me/blocked", auth, v1.GetBlockedUsers(services.BlockService))
+	api.Get("/users/me/muted", auth, v1.GetMutedUsers(services.BlockService))
+	api.Post("/users/me/exports", auth, v1.RequestDataExport(services.DataExportService))
+	api.Get("/users/me/exports", auth, v1.GetDataExports(services.DataExportService))
+	api.Get("/users/me/exports/:id/download", auth, v1.DownloadDataExport(services.DataExportService))
+	api.Get("/users/:id", auth, v1.GetUser(services.UserService))
+	api.Delete("/users/:id", auth, v1.DeleteAccount(services.UserService, services.AuthService, messageHub))
+	api.Put("/users/:id/block", auth, v1.BlockUser(services.BlockService))
+	api.Delete("/users/:id/block", auth, v1.UnblockUser(services.BlockService))
+	api.Put("/users/:id/mute", auth, v1.MuteUser(services.BlockService))
+	api.Delete("/users/:id/mute", auth, v1.UnmuteUser(services.BlockService))
+	api.Get("/users/:id/chatrooms", auth, v1.GetUserChatrooms(services.ChatroomService))
+	// Contact routes
+	api.Get("/contacts", auth, v1.GetContacts(services.ContactService, services.UserService, messageHub))
+	api.Delete("/contacts/:id", auth, v1.RemoveContact(services.ContactService))
+	api.Get("/contact-requests", auth, v1.GetContactRequests(services.ContactService))
+	api.Post("/contact-requests", auth, v1.SendContactRequest(services.ContactService, messageHub))
+	api.Post("/contact-requests/:id/accept", auth, v1.AcceptContactRequest(services.ContactService, messageHub))
+	api.Post("/contact-requests/:id/decline", auth, v1.DeclineContactRequest(services.ContactService, messageHub))
+	api.Delete("/contact-requests/:id", auth, v1.CancelContactRequest(services.ContactService, messageHub))
 	// Chatrooms routes
-	api.Get("/chatrooms/:id", middleware.AuthMiddleware(), v1.GetChatroomById(services.ChatroomService))
-	api.Get("/chatrooms/:id/messages", middleware.AuthMiddleware(), v1.GetChatroomMessages(services.ChatroomService))
+	api.Get("/chatrooms", auth, v1.GetPublicChatrooms(services.ChatroomService))
+	api.Get("/chatrooms/:id", authWithAPIKey(model.APIKeyScopeReadChatrooms), v1.GetChatroomById(services.ChatroomService))
+	api.Patch("/chatrooms/:id", auth, v1.UpdateGroupChatroom(services.ChatroomService, messageHub))
+	api.Post("/chatrooms/:id/avatar", auth, v1.UploadGroupAvatar(services.ChatroomService, messageHub))
+	api.Patch("/chatrooms/:id/user-settings", auth, v1.UpdateChatroomUserSettings(services.ChatroomService, messageHub))
+	api.Get("/chatrooms/:id/messages", authWithAPIKey(model.APIKeyScopeReadMessages), v1.GetChatroomMessages(services.ChatroomService))
+	api.Post("/chatrooms/:id/messages", authWithAPIKey(model.APIKeyScopeSendMessages), v1.SendMessage(services.ChatroomService, services.UserService, messageHub.MessageQueueChannel))
+	api.Post("/chatrooms/:id/invites", auth, v1.CreateChatroomInvite(services.ChatroomInviteService))
+	api.Get("/chatrooms/:id/invites", auth, v1.GetChatroomInvites(services.ChatroomInviteService))
+	api.Delete("/chatrooms/:id/invites/:inviteID", auth, v1.RevokeChatroomInvite(services.ChatroomInviteService))
+	api.Get("/chatrooms/:id/join-requests", auth, v1.GetChatroomJoinRequests(services.ChatroomInviteService))
+	api.Post("/chatrooms/:id/join-requests/:requestID/approve", auth, v1.ApproveChatroomJoinRequest(services.ChatroomInviteService, messageHub))
+	api.Post("/chatrooms/:id/join-requests/:requestID/decline", auth, v1.DeclineChatroomJoinRequest(services.ChatroomInviteService, messageHub))
+	api.Post("/chatrooms/:id/join", auth, v1.JoinPublicChatroom(services.ChatroomInviteService, messageHub))
+	api.Post("/invites/:token/redeem", auth, v1.RedeemChatroomInvite(services.ChatroomInviteService, messageHub))
 }
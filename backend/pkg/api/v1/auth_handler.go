@@ -2,27 +2,32 @@ package v1
 
 import (
 	"backend/pkg/config"
+	"backend/pkg/consumer"
 	"backend/pkg/model"
 	"backend/pkg/service"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// RegisterHandler handles user registration
+// RegisterHandler handles user registration. The new account stays unverified until the user confirms the email address with the link sent to them.
 // @Summary Register a new user
-// @Description Register a new user with the provided credentials
+// @Description Register a new user with the provided credentials and send an email verification link
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param body body model.RegistrationRequest true "User registration request"
-// @Success 201 {object} model.User
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} service.ValidationError
+// @Failure 409 {object} service.ValidationError
 // @Router /api/v1/register [post]
-func RegisterHandler(userService *service.UserService) fiber.Handler {
+func RegisterHandler(userService *service.UserService, authService *service.AuthService, sessionService *service.SessionService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		request := new(model.RegistrationRequest)
 		if err := c.BodyParser(request); err != nil {
@@ -31,26 +36,25 @@ func RegisterHandler(userService *service.UserService) fiber.Handler {
 			})
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		user, err := userService.RegisterUser(*request)
 		if err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't register", validationErr)
+			}
+			// database errors shouldn't be exposed to the clients
+			log.Printf("Couldn't register the new user: %v\n", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": fmt.Sprintf("Couldn't register the new user: %v", err),
+				"message": "Couldn't register the new user",
 			})
 		}
-		// Save new user to DB
-		user, err := userService.CreateNewUser(model.User{
-			Nickname:     request.Nickname,
-			PasswordHash: string(hashedPassword),
-			Email:        request.Email,
-		})
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": fmt.Sprintf("Couldn't register the new user: %v", err),
-			})
+		// The user can request a new verification email later, so a mailing failure shouldn't fail the registration
+		if err := authService.SendEmailVerification(&user); err != nil {
+			log.Printf("Couldn't send verification email to user %v: %v\n", user.ID, err)
 		}
 
-		// Generate a jwt token
-		token, err := GenerateAuthToken(user.ID)
+		// Start a new session and generate a jwt token for it
+		token, err := issueAuthToken(c, sessionService, user.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"message": fmt.Sprintf("Couldn't register the new user: %v", err),
@@ -62,16 +66,17 @@ func RegisterHandler(userService *service.UserService) fiber.Handler {
 	}
 }
 
-// LoginHandler handles user login
+// LoginHandler handles user login. Users with two-factor authentication enabled get a short-lived challenge token instead, which should be exchanged for an auth token with TwoFactorLoginHandler.
 // @Summary Log in a user
-// @Description Log in a user with the provided credentials
+// @Description Log in a user with the provided credentials. If two-factor authentication is enabled, a challenge token is returned instead of the auth token.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param body body model.LoginRequest true "User login request"
-// @Success 200 {object} model.User
+// @Success 200 {object} model.LoginResponse
+// @Failure 401 {object} map[string]string
 // @Router /api/v1/login [post]
-func LoginHandler(userService *service.UserService) fiber.Handler {
+func LoginHandler(userService *service.UserService, sessionService *service.SessionService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		request := new(model.LoginRequest)
 		if err := c.BodyParser(&request); err != nil {
@@ -81,7 +86,7 @@ func LoginHandler(userService *service.UserService) fiber.Handler {
 		}
 
 		// Retrieve user from DB and check password...
-		user, err := userService.GetUserByEmail(request.Email)
+		user, err := userService.GetUserByEmail(strings.TrimSpace(request.Email))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"message": fmt.Sprintf("Couldn't login: %v", err),
@@ -93,13 +98,24 @@ func LoginHandler(userService *service.UserService) fiber.Handler {
 			})
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": fmt.Sprintf("Couldn't login: %v", err),
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Couldn't login: invalid password",
 			})
 		}
 
-		// Generate a jwt token
-		token, err := GenerateAuthToken(user.ID)
+		// The second step of the login is required if two-factor authentication is enabled
+		if user.TwoFactorEnabled {
+			challengeToken, err := GenerateTwoFactorChallengeToken(user.ID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"message": fmt.Sprintf("Couldn't login: %v", err),
+				})
+			}
+			return c.JSON(model.LoginResponse{TwoFactorRequired: true, ChallengeToken: challengeToken})
+		}
+
+		// Start a new session and generate a jwt token for it
+		token, err := issueAuthToken(c, sessionService, user.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"message": fmt.Sprintf("Couldn't login: %v", err),
@@ -107,18 +123,30 @@ func LoginHandler(userService *service.UserService) fiber.Handler {
 		}
 
 		// Only returning token in the response body
-		return c.JSON(fiber.Map{"token": token})
+		return c.JSON(model.LoginResponse{Token: token})
 	}
 }
 
-// LogoutHandler handles user logout
+// LogoutHandler handles user logout by revoking the current session and closing its websocket connections
 // @Summary Log out a user
-// @Description Log out the currently authenticated user
+// @Description Log out the currently authenticated user. The auth token of the session stops working.
 // @Tags Authentication
 // @Success 200 {object} map[string]string
 // @Router /api/v1/logout [post]
-func LogoutHandler() fiber.Handler {
+func LogoutHandler(sessionService *service.SessionService, messageHub *consumer.MessageHub) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		userID, sessionID, ok := getAuthenticatedSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "session not found in context",
+			})
+		}
+		if err := sessionService.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": fmt.Sprintf("Couldn't log out: %v", err),
+			})
+		}
+		messageHub.CloseSessions <- []uint{sessionID}
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message": "Successfully logged out",
 		})
@@ -133,7 +161,7 @@ func LogoutHandler() fiber.Handler {
 // @Success 200
 // @Failure 401 {object} map[string]string
 // @Router /api/v1/validateToken [post]
-func ValidateTokenHandler() fiber.Handler {
+func ValidateTokenHandler(sessionService *service.SessionService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := c.Query("token")
 		if token == "" {
@@ -143,7 +171,10 @@ func ValidateTokenHandler() fiber.Handler {
 				token = strings.Replace(token, "Bearer ", "", 1)
 			}
 		}
-		_, err := ValidateAuthToken(token)
+		userID, sessionID, err := ValidateAuthToken(token)
+		if err == nil {
+			err = sessionService.ValidateSession(sessionID, userID)
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "Invalid token",
@@ -154,11 +185,138 @@ func ValidateTokenHandler() fiber.Handler {
 	}
 }
 
-// GenerateAuthToken generates a JWT token for a given user ID
-func GenerateAuthToken(userID uint) (string, error) {
+// VerifyEmailRequestHandler sends a new email verification link to the authenticated user
+// @Summary Resend email verification link
+// @Description Send a new email verification link to the authenticated user. Previously sent links stop working.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/verify-email/request [post]
+func VerifyEmailRequestHandler(userService *service.UserService, authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		user, err := userService.GetUserByID(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the user from database: %v", err)})
+		}
+		if user == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		if user.EmailVerified {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email is already verified"})
+		}
+		if err := authService.SendEmailVerification(user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't send verification email: %v", err)})
+		}
+		return c.JSON(fiber.Map{"message": "Verification email sent"})
+	}
+}
+
+// VerifyEmailConfirmHandler confirms the email address of a user with the token from the verification link
+// @Summary Confirm email address
+// @Description Confirm the email address with the token from the verification link
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body model.EmailVerificationConfirmRequest true "Email verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/verify-email/confirm [post]
+func VerifyEmailConfirmHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request := new(model.EmailVerificationConfirmRequest)
+		if err := c.BodyParser(request); err != nil || request.Token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't verify email: token is missing"})
+		}
+		if err := authService.VerifyEmail(request.Token); err != nil {
+			if errors.Is(err, service.ErrInvalidOrExpiredToken) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't verify email: %v", err)})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't verify email: %v", err)})
+		}
+		return c.JSON(fiber.Map{"message": "Email verified"})
+	}
+}
+
+// PasswordResetRequestHandler sends a password reset link to the given email. It responds the same way whether the email is registered or not.
+// @Summary Request password reset
+// @Description Send a password reset link to the given email if it belongs to a registered user
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body model.PasswordResetRequest true "Password reset request"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/password-reset/request [post]
+func PasswordResetRequestHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request := new(model.PasswordResetRequest)
+		if err := c.BodyParser(request); err != nil || request.Email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't request password reset: email is missing"})
+		}
+		if err := authService.RequestPasswordReset(request.Email); err != nil {
+			log.Printf("Couldn't send password reset email: %v\n", err)
+		}
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If the email is registered, a password reset link has been sent to it"})
+	}
+}
+
+// PasswordResetConfirmHandler sets a new password using the token from the password reset link
+// @Summary Reset password
+// @Description Set a new password with the token from the password reset link
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body model.PasswordResetConfirmRequest true "Password reset token and the new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/password-reset/confirm [post]
+func PasswordResetConfirmHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request := new(model.PasswordResetConfirmRequest)
+		if err := c.BodyParser(request); err != nil || request.Token == "" || request.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't reset password: token and password should be specified"})
+		}
+		if err := authService.ResetPassword(request.Token, request.Password); err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't reset password", validationErr)
+			}
+			if errors.Is(err, service.ErrInvalidOrExpiredToken) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't reset password: %v", err)})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't reset password: %v", err)})
+		}
+		return c.JSON(fiber.Map{"message": "Password has been reset"})
+	}
+}
+
+// validationErrorResponse responds with 409 if the input clashes with existing data and with 400 otherwise. The code and field let the clients show the error next to the right input.
+func validationErrorResponse(c *fiber.Ctx, prefix string, validationErr *service.ValidationError) error {
+	status := fiber.StatusBadRequest
+	if validationErr.IsConflict() {
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"message": fmt.Sprintf("%v: %v", prefix, validationErr.Message),
+		"code":    validationErr.Code,
+		"field":   validationErr.Field,
+	})
+}
+
+// GenerateAuthToken generates a JWT token for a given user ID and session ID
+func GenerateAuthToken(userID, sessionID uint) (string, error) {
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
 		Issuer:    strconv.Itoa(int(userID)),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(72 * time.Hour)), // 3 days
+		ID:        strconv.Itoa(int(sessionID)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AuthTokenTTLHours * time.Hour)),
 	})
 	token, err := claims.SignedString([]byte(config.JwtSecret))
 	if err != nil {
@@ -167,9 +325,78 @@ func GenerateAuthToken(userID uint) (string, error) {
 	return token, nil
 }
 
-func ValidateAuthToken(token string) (uint, error) {
+// GenerateTwoFactorChallengeToken generates a short-lived JWT token proving that the user passed the first login step. It can't be used as an auth token.
+func GenerateTwoFactorChallengeToken(userID uint) (string, error) {
+	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    strconv.Itoa(int(userID)),
+		Audience:  jwt.ClaimStrings{twoFactorChallengeAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.TwoFactorChallengeTokenTTLMinutes * time.Minute)),
+	})
+	token, err := claims.SignedString([]byte(config.JwtSecret))
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate challenge token: %v", err)
+	}
+	return token, nil
+}
+
+// ValidateTwoFactorChallengeToken validates a challenge token generated by GenerateTwoFactorChallengeToken and returns the user ID
+func ValidateTwoFactorChallengeToken(token string) (uint, error) {
+	claims, err := parseToken(token)
+	if err != nil {
+		return 0, err
+	}
+	if !claims.VerifyAudience(twoFactorChallengeAudience, true) {
+		return 0, fmt.Errorf("invalid token: not a challenge token")
+	}
+	return parseUserID(claims)
+}
+
+// ValidateAuthToken validates a token generated by GenerateAuthToken and returns the user ID and the session ID. It doesn't check whether the session was revoked.
+func ValidateAuthToken(token string) (uint, uint, error) {
+	claims, err := parseToken(token)
+	if err != nil {
+		return 0, 0, err
+	}
+	// tokens with an audience (e.g. two-factor challenge tokens) are only valid for their specific purpose
+	if len(claims.Audience) > 0 {
+		return 0, 0, fmt.Errorf("invalid token: unexpected audience %v", claims.Audience)
+	}
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return 0, 0, err
+	}
+	sessionID, err := strconv.ParseUint(claims.ID, 10, 64)
+	if err != nil || sessionID == 0 {
+		return 0, 0, fmt.Errorf("invalid session ID in token: %v", claims.ID)
+	}
+	return userID, uint(sessionID), nil
+}
+
+// issueAuthToken starts a new session for the user on the requesting device and generates an auth token for it
+func issueAuthToken(c *fiber.Ctx, sessionService *service.SessionService, userID uint) (string, error) {
+	// the IP is only taken from the proxy header of trusted proxies, see config.TrustedProxies
+	session, err := sessionService.CreateSession(userID, c.Get("X-Device-Name"), c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return "", err
+	}
+	return GenerateAuthToken(userID, session.ID)
+}
+
+// getAuthenticatedSession returns the user ID and the session ID set by the auth middleware
+func getAuthenticatedSession(c *fiber.Ctx) (uint, uint, bool) {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return 0, 0, false
+	}
+	sessionID, ok := c.Locals("sessionID").(uint)
+	return userID, sessionID, ok
+}
+
+const twoFactorChallengeAudience = "two-factor-challenge"
+
+func parseToken(token string) (*jwt.RegisteredClaims, error) {
 	if token == "" {
-		return 0, fmt.Errorf("empty token provided")
+		return nil, fmt.Errorf("empty token provided")
 	}
 	// Token validation logic
 	claims := &jwt.RegisteredClaims{}
@@ -177,8 +404,12 @@ func ValidateAuthToken(token string) (uint, error) {
 		return []byte(config.JwtSecret), nil
 	})
 	if err != nil || !parsedToken.Valid {
-		return 0, fmt.Errorf("invalid token: %v", err)
+		return nil, fmt.Errorf("invalid token: %v", err)
 	}
+	return claims, nil
+}
+
+func parseUserID(claims *jwt.RegisteredClaims) (uint, error) {
 	userIDString := claims.Issuer
 	userID, err := strconv.ParseUint(userIDString, 10, 64)
 	if err != nil {
@@ -0,0 +1,188 @@
+package v1
+
+import (
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BlockUser blocks a user for the authenticated user
+// @Summary Block a user
+// @Description Block a user. Blocked users can't open a private chatroom with or send private messages to the authenticated user, and both users are hidden from each other's searches.
+// @Tags Blocks
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/users/{id}/block [put]
+func BlockUser(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		targetID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		if err := blockService.BlockUser(userID, uint(targetID)); err != nil {
+			return blockErrorResponse(c, "Couldn't block the user", err)
+		}
+		return c.JSON(fiber.Map{"message": "User blocked"})
+	}
+}
+
+// UnblockUser removes the block of a user
+// @Summary Unblock a user
+// @Description Remove the block of a user
+// @Tags Blocks
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/users/{id}/block [delete]
+func UnblockUser(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		targetID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		if err := blockService.UnblockUser(userID, uint(targetID)); err != nil {
+			return blockErrorResponse(c, "Couldn't unblock the user", err)
+		}
+		return c.JSON(fiber.Map{"message": "User unblocked"})
+	}
+}
+
+// GetBlockedUsers lists the users blocked by the authenticated user
+// @Summary List blocked users
+// @Description List the users blocked by the authenticated user, most recently blocked first
+// @Tags Blocks
+// @Produce json
+// @Success 200 {array} model.User
+// @Router /api/v1/users/me/blocked [get]
+func GetBlockedUsers(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		users, err := blockService.GetBlockedUsers(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get blocked users: %v", err)})
+		}
+		return c.JSON(users)
+	}
+}
+
+// MuteUser mutes a user for the authenticated user
+// @Summary Mute a user
+// @Description Mute a user. Messages of muted users don't count as unread and are flagged as muted, so that clients don't notify about them. The shared chatrooms aren't left.
+// @Tags Blocks
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/users/{id}/mute [put]
+func MuteUser(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		targetID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		if err := blockService.MuteUser(userID, uint(targetID)); err != nil {
+			return blockErrorResponse(c, "Couldn't mute the user", err)
+		}
+		return c.JSON(fiber.Map{"message": "User muted"})
+	}
+}
+
+// UnmuteUser removes the mute of a user
+// @Summary Unmute a user
+// @Description Remove the mute of a user
+// @Tags Blocks
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/users/{id}/mute [delete]
+func UnmuteUser(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		targetID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		if err := blockService.UnmuteUser(userID, uint(targetID)); err != nil {
+			return blockErrorResponse(c, "Couldn't unmute the user", err)
+		}
+		return c.JSON(fiber.Map{"message": "User unmuted"})
+	}
+}
+
+// GetMutedUsers lists the users muted by the authenticated user
+// @Summary List muted users
+// @Description List the users muted by the authenticated user, most recently muted first
+// @Tags Blocks
+// @Produce json
+// @Success 200 {array} model.User
+// @Router /api/v1/users/me/muted [get]
+func GetMutedUsers(blockService *service.BlockService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		users, err := blockService.GetMutedUsers(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get muted users: %v", err)})
+		}
+		return c.JSON(users)
+	}
+}
+
+// blockErrorResponse maps the errors of the block service to the status codes
+func blockErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrCannotTargetSelf):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrNotBlockedOrMuted):
+		status = fiber.StatusNotFound
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
@@ -0,0 +1,179 @@
+package v1
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateBot creates a new bot owned by the authenticated user
+// @Summary Create a bot
+// @Description Create a bot user that can post to chatrooms with API keys. Add the bot to a chatroom like any other user.
+// @Tags Bots
+// @Accept json
+// @Produce json
+// @Param body body model.CreateBotRequest true "Bot"
+// @Success 201 {object} model.User
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/bots [post]
+func CreateBot(botService *service.BotService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.CreateBotRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't parse the request: %v", err)})
+		}
+		bot, err := botService.CreateBot(userID, request)
+		if err != nil {
+			return botErrorResponse(c, "Couldn't create the bot", err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(bot)
+	}
+}
+
+// GetBots gets the bots owned by the authenticated user
+// @Summary Get own bots
+// @Description Retrieve the bots owned by the authenticated user
+// @Tags Bots
+// @Produce json
+// @Success 200 {array} model.User
+// @Router /api/v1/bots [get]
+func GetBots(botService *service.BotService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		bots, err := botService.GetBots(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the bots from database: %v", err)})
+		}
+		return c.JSON(bots)
+	}
+}
+
+// CreateAPIKey creates a new API key for a bot of the authenticated user
+// @Summary Create an API key
+// @Description Create an API key for the bot scoped to the given actions and chatrooms. The bot has to be a participant of the chatrooms. The key is returned only once.
+// @Tags Bots
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param body body model.CreateAPIKeyRequest true "API key"
+// @Success 201 {object} model.CreatedAPIKey
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/bots/{id}/api-keys [post]
+func CreateAPIKey(botService *service.BotService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		botID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid bot ID"})
+		}
+		request := new(model.CreateAPIKeyRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't parse the request: %v", err)})
+		}
+		apiKey, err := botService.CreateAPIKey(userID, uint(botID), request)
+		if err != nil {
+			return botErrorResponse(c, "Couldn't create the API key", err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(apiKey)
+	}
+}
+
+// GetAPIKeys gets the API keys of a bot of the authenticated user
+// @Summary Get API keys of a bot
+// @Description Retrieve all API keys of the bot including revoked ones. The keys themselves are not returned.
+// @Tags Bots
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Success 200 {array} model.APIKey
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/bots/{id}/api-keys [get]
+func GetAPIKeys(botService *service.BotService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		botID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid bot ID"})
+		}
+		apiKeys, err := botService.GetAPIKeys(userID, uint(botID))
+		if err != nil {
+			return botErrorResponse(c, "Couldn't query the API keys", err)
+		}
+		return c.JSON(apiKeys)
+	}
+}
+
+// RevokeAPIKey revokes an API key of a bot of the authenticated user
+// @Summary Revoke an API key
+// @Description Revoke the API key. It stops working immediately.
+// @Tags Bots
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param keyID path int true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/bots/{id}/api-keys/{keyID} [delete]
+func RevokeAPIKey(botService *service.BotService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		botID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid bot ID"})
+		}
+		keyID, err := strconv.ParseUint(c.Params("keyID"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid API key ID"})
+		}
+		if err := botService.RevokeAPIKey(userID, uint(botID), uint(keyID)); err != nil {
+			return botErrorResponse(c, "Couldn't revoke the API key", err)
+		}
+		return c.JSON(fiber.Map{"message": "API key revoked"})
+	}
+}
+
+// botErrorResponse maps errors of the bot management to response statuses
+func botErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidBotRequest):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, service.ErrBotNotFound), errors.Is(err, service.ErrAPIKeyNotFound):
+		status = fiber.StatusNotFound
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
@@ -2,8 +2,12 @@ package v1
 
 import (
 	"backend/pkg/config"
+	"backend/pkg/consumer"
+	"backend/pkg/model"
 	"backend/pkg/service"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strconv"
 
@@ -12,7 +16,7 @@ import (
 
 // GetChatroomById gets a chatroom with participants and messages with pagination support
 // @Summary Get the chatroom information
-// @Description Retrieve information about a chatroom, including participants and messages
+// @Description Retrieve information about a chatroom, including participants and messages. Only participants can get the chatroom.
 // @Tags Chatrooms
 // @Accept json
 // @Produce json
@@ -21,6 +25,7 @@ import (
 // @Param pageSize query int false "Page size"
 // @Success 200 {object} model.Chatroom
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Router /api/v1/chatrooms/{id} [get]
 func GetChatroomById(chatroomService *service.ChatroomService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -44,8 +49,18 @@ func GetChatroomById(chatroomService *service.ChatroomService) fiber.Handler {
 				"message": "userID not found in context",
 			})
 		}
+		allowedForAPIKey, err := isChatroomAllowedForAPIKey(c, chatroomService, uint(chatroomID))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't check the API key: %v", err)})
+		}
+		if !allowedForAPIKey {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "API key is not valid for this chatroom"})
+		}
 
 		chatroom, err := chatroomService.GetChatroomById(uint(chatroomID), userID, int(page), int(pageSize))
+		if errors.Is(err, service.ErrChatroomPermissionDenied) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Only participants can view the chatroom"})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the chatroom from database: %v", err)})
 		}
@@ -57,34 +72,48 @@ func GetChatroomById(chatroomService *service.ChatroomService) fiber.Handler {
 	}
 }
 
-// GetUserChatrooms gets all chatrooms where given user is a participant
+// GetUserChatrooms gets a page of the chat list of the given user
 // @Summary Get chatrooms of a user
-// @Description Retrieve all chatrooms where a user is a participant
+// @Description Retrieve the chatrooms where a user is a participant with their last message, unread count and participant count. Private chatrooms include the other participant.
+// @Description Pinned chatrooms come first, followed by the others with the latest activity first. Pass the nextCursor of a page as cursor to fetch the next page with the same filter.
+// @Description The id can only be "me" or the ID of the authenticated user.
 // @Tags Chatrooms
 // @Accept json
 // @Produce json
-// @Param id path int true "User ID"
-// @Param page query int false "Page number"
+// @Param id path string true "User ID or me"
+// @Param cursor query string false "Cursor of the next page"
 // @Param pageSize query int false "Page size"
-// @Success 200 {array} model.ChatroomForUser
+// @Param archived query bool false "List the archived chatrooms instead of the others"
+// @Param unread query bool false "List only the chatrooms with unread messages or which are marked as unread"
+// @Success 200 {object} model.ChatList
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Router /api/v1/users/{id}/chatrooms [get]
 func GetUserChatrooms(chatroomService *service.ChatroomService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userId, err := strconv.ParseUint(c.Params("id"), 10, 64)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		userIDRaw := c.Locals("userID")
+		userId, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
 		}
-		// Parse pagination parameters and for no valid parameters case replace with default values
-		page, err := parseInt(c.Query("page"), 1)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid page query parameter: %v", c.Query("page"))})
+		// the chat list has the previews, unread counts and settings of the user, so nobody else may see it
+		if id := c.Params("id"); id != "me" && id != strconv.Itoa(int(userId)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Users can only list their own chatrooms"})
 		}
-		pageSize, err := parseInt(c.Query("pageSize"), config.MessageHistoryPaginationDefaultSize)
-		if err != nil {
+		pageSize, err := parseInt(c.Query("pageSize"), config.ChatListPaginationDefaultSize)
+		if err != nil || pageSize > config.ChatListPaginationMaxSize {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid pageSize query parameter: %v", c.Query("pageSize"))})
 		}
-		chatrooms, err := chatroomService.GetChatroomsByUserId(uint(userId), int(page), int(pageSize))
+		filter, err := parseChatroomFilter(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		chatrooms, err := chatroomService.GetChatList(userId, filter, c.Query("cursor"), int(pageSize))
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid cursor query parameter"})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the chatrooms for user with id %v from database: %v", userId, err)})
 		}
@@ -93,6 +122,51 @@ func GetUserChatrooms(chatroomService *service.ChatroomService) fiber.Handler {
 	}
 }
 
+// parseChatroomFilter parses the query parameters which select the chatrooms of the chat list
+func parseChatroomFilter(c *fiber.Ctx) (model.ChatroomFilter, error) {
+	filter := model.ChatroomFilter{}
+	archived, err := parseOptionalBool(c, "archived")
+	if err != nil {
+		return filter, err
+	}
+	unread, err := parseOptionalBool(c, "unread")
+	if err != nil {
+		return filter, err
+	}
+	filter.Archived = archived != nil && *archived
+	filter.Unread = unread != nil && *unread
+	return filter, nil
+}
+
+// GetPublicChatrooms fetches a page of the chatroom directory
+// @Summary List public chatrooms
+// @Description List the public group chatrooms ordered by name, optionally only those whose name or description contain the search term.
+// @Description Pass the nextCursor of a page as cursor to fetch the next page with the same search term.
+// @Tags Chatrooms
+// @Produce json
+// @Param q query string false "Search term"
+// @Param cursor query string false "Cursor of the next page"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} model.PublicChatroomPage
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/chatrooms [get]
+func GetPublicChatrooms(chatroomService *service.ChatroomService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pageSize, err := parseInt(c.Query("pageSize"), config.ChatroomDirectoryPaginationDefaultSize)
+		if err != nil || pageSize > config.ChatroomDirectoryPaginationMaxSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid pageSize query parameter: %v", c.Query("pageSize"))})
+		}
+		page, err := chatroomService.GetPublicChatroomsPage(c.Query("q"), c.Query("cursor"), int(pageSize))
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid cursor query parameter"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the public chatrooms from database: %v", err)})
+		}
+		return c.JSON(page)
+	}
+}
+
 func parseInt(paramStr string, defaultValue int64) (int64, error) {
 	if paramStr == "" {
 		return defaultValue, nil
@@ -119,8 +193,24 @@ func GetChatroomMessages(chatroomService *service.ChatroomService) fiber.Handler
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid pageSize query parameter: %v", c.Query("pageSize"))})
 		}
-		messages, err := chatroomService.GetChatroomMessages(uint(chatroomID), int(page), int(pageSize))
+		allowedForAPIKey, err := isChatroomAllowedForAPIKey(c, chatroomService, uint(chatroomID))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't check the API key: %v", err)})
+		}
+		if !allowedForAPIKey {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "API key is not valid for this chatroom"})
+		}
+		userID, ok := c.Locals("userID").(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		messages, err := chatroomService.GetChatroomMessages(uint(chatroomID), userID, int(page), int(pageSize))
 		log.Printf("Page number: %v, pageSize: %v, Messages: %v", page, pageSize, messages)
+		if errors.Is(err, service.ErrChatroomPermissionDenied) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Only participants can view the messages of the chatroom"})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the messages from database: %v", err)})
 		}
@@ -131,3 +221,181 @@ func GetChatroomMessages(chatroomService *service.ChatroomService) fiber.Handler
 		return c.JSON(messages)
 	}
 }
+
+// UpdateGroupChatroom changes the metadata and settings of a group chatroom
+// @Summary Update a group chatroom
+// @Description Change the name, description, topic, avatar URL or settings of a group chatroom. Only the fields which are present change.
+// @Description Owners and admins can change the metadata, and members too if the membersCanEditInfo setting allows it. Only owners and admins can change the settings.
+// @Description The participants get a CHATROOM_UPDATED websocket message with the values which actually changed.
+// @Tags Chatrooms
+// @Accept json
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param changes body model.ChatroomChanges true "Changed fields"
+// @Success 200 {object} model.ChatroomUpdated
+// @Failure 400 {object} service.ValidationError
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id} [patch]
+func UpdateGroupChatroom(chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		changes := model.ChatroomChanges{}
+		if err := c.BodyParser(&changes); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid request body: %v", err)})
+		}
+		if changes.IsEmpty() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't update the chatroom: nothing to update"})
+		}
+		updated, err := chatroomService.UpdateGroupChatroom(userID, &model.UpdateGroupChatroom{ID: uint(chatroomID), ChatroomChanges: changes})
+		if err != nil {
+			return groupChatroomErrorResponse(c, "Couldn't update the chatroom", err)
+		}
+		notifyChatroomUpdated(messageHub, userID, updated)
+		return c.JSON(updated)
+	}
+}
+
+// UploadGroupAvatar sets the uploaded image as the avatar of a group chatroom. The image is cropped to a square and stored in several sizes.
+// @Summary Upload a group avatar
+// @Description Upload a JPEG, PNG or GIF image as the avatar of a group chatroom. Image metadata is removed. The same participants who can change the group name can upload the avatar.
+// @Description The participants get a CHATROOM_UPDATED websocket message with the new avatarURL, which points to the largest size.
+// @Tags Chatrooms
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} model.ChatroomUpdated
+// @Failure 400 {object} service.ValidationError
+// @Failure 403 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/avatar [post]
+func UploadGroupAvatar(chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		fileHeader, err := c.FormFile("avatar")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't upload avatar: the image should be sent in the avatar form field"})
+		}
+		maxBytes := config.AvatarMaxUploadBytes()
+		if fileHeader.Size > int64(maxBytes) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: the image should be at most %v bytes", maxBytes)})
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: %v", err)})
+		}
+		defer file.Close()
+		imageData, err := io.ReadAll(io.LimitReader(file, int64(maxBytes)))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: %v", err)})
+		}
+
+		updated, err := chatroomService.UploadGroupAvatar(userID, uint(chatroomID), imageData)
+		if err != nil {
+			return groupChatroomErrorResponse(c, "Couldn't upload avatar", err)
+		}
+		notifyChatroomUpdated(messageHub, userID, updated)
+		return c.JSON(updated)
+	}
+}
+
+// UpdateChatroomUserSettings changes the settings of a chatroom which only apply to the authenticated user
+// @Summary Update the own settings of a chatroom
+// @Description Archive, mute, pin or mark a chatroom as unread for the authenticated user. Only the fields which are present change.
+// @Description A mutedUntil time which already passed unmutes the chatroom. A new message unarchives the chatroom unless it is muted, and viewing a message clears markedUnread.
+// @Description The other devices of the user get a CHATROOM_USER_SETTINGS_UPDATED websocket message with the new settings.
+// @Tags Chatrooms
+// @Accept json
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param changes body model.ChatroomUserSettingsChanges true "Changed settings"
+// @Success 200 {object} model.ChatroomUserSettings
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/user-settings [patch]
+func UpdateChatroomUserSettings(chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		changes := model.ChatroomUserSettingsChanges{}
+		if err := c.BodyParser(&changes); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid request body: %v", err)})
+		}
+		if changes.IsEmpty() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't update the chatroom settings: nothing to update"})
+		}
+		settings, err := chatroomService.UpdateUserSettings(userID, uint(chatroomID), changes)
+		if err != nil {
+			return groupChatroomErrorResponse(c, "Couldn't update the chatroom settings", err)
+		}
+		messageHub.Notify <- consumer.Notification{
+			MessageData: &model.MessageData{
+				MessageOption: model.MessageDataOptionChatroomUserSettingsUpdated,
+				ActorID:       userID,
+				ChatroomUserSettingsUpdated: &model.ChatroomUserSettingsUpdated{
+					ChatroomID: uint(chatroomID),
+					Settings:   *settings,
+				},
+			},
+			UserIDs: []uint{userID},
+		}
+		return c.JSON(settings)
+	}
+}
+
+// notifyChatroomUpdated sends the changes to the participants of the chatroom unless nothing changed
+func notifyChatroomUpdated(messageHub *consumer.MessageHub, actorID uint, updated *model.ChatroomUpdated) {
+	if updated.IsEmpty() {
+		return
+	}
+	messageHub.Notify <- consumer.Notification{
+		MessageData: &model.MessageData{
+			MessageOption:   model.MessageDataOptionChatroomUpdated,
+			ActorID:         actorID,
+			ChatroomUpdated: updated,
+		},
+		ChatroomIDs: []uint{updated.ChatroomID},
+	}
+}
+
+// groupChatroomErrorResponse maps the errors of changing a group chatroom to HTTP responses
+func groupChatroomErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErrorResponse(c, prefix, validationErr)
+	}
+	status := fiber.StatusInternalServerError
+	if errors.Is(err, service.ErrChatroomPermissionDenied) {
+		status = fiber.StatusForbidden
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
@@ -0,0 +1,351 @@
+package v1
+
+import (
+	"backend/pkg/consumer"
+	"backend/pkg/model"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateChatroomInvite creates an invite link to a group chatroom
+// @Summary Create a chatroom invite
+// @Description Create an invite to a group chatroom with an optional expiry, maximum number of uses and approval requirement. Only owners and admins can create invites.
+// @Description The token is returned only once, only a prefix of it is shown when listing the invites.
+// @Tags Chatrooms
+// @Accept json
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param request body model.CreateChatroomInviteRequest true "Invite limits"
+// @Success 201 {object} model.CreatedChatroomInvite
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/invites [post]
+func CreateChatroomInvite(inviteService *service.ChatroomInviteService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		request := &model.CreateChatroomInviteRequest{}
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid request body: %v", err)})
+		}
+		invite, err := inviteService.CreateInvite(userID, uint(chatroomID), request)
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't create the invite", err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(invite)
+	}
+}
+
+// GetChatroomInvites lists the invites of a group chatroom
+// @Summary List chatroom invites
+// @Description List the invites of a group chatroom which weren't revoked, newest first. Only owners and admins can list invites.
+// @Tags Chatrooms
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Success 200 {array} model.ChatroomInvite
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/invites [get]
+func GetChatroomInvites(inviteService *service.ChatroomInviteService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		invites, err := inviteService.GetInvites(userID, uint(chatroomID))
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't get the invites", err)
+		}
+		return c.JSON(invites)
+	}
+}
+
+// RevokeChatroomInvite revokes an invite of a group chatroom
+// @Summary Revoke a chatroom invite
+// @Description Revoke an invite of a group chatroom, so that it can't be redeemed anymore. Only owners and admins can revoke invites.
+// @Tags Chatrooms
+// @Param id path int true "Chatroom ID"
+// @Param inviteID path int true "Invite ID"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/invites/{inviteID} [delete]
+func RevokeChatroomInvite(inviteService *service.ChatroomInviteService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		inviteID, err := strconv.ParseUint(c.Params("inviteID"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid invite ID"})
+		}
+		if err := inviteService.RevokeInvite(userID, uint(chatroomID), uint(inviteID)); err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't revoke the invite", err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RedeemChatroomInvite joins the group chatroom of an invite
+// @Summary Redeem a chatroom invite
+// @Description Join the group chatroom of an invite. The participants get a PARTICIPANT_JOINED websocket message and the connected clients of the user are subscribed to the chatroom.
+// @Description If the invite requires approval, a join request is created instead, the owners and admins get a JOIN_REQUEST_CREATED websocket message and 202 is returned.
+// @Tags Chatrooms
+// @Produce json
+// @Param token path string true "Invite token"
+// @Success 200 {object} model.RedeemedChatroomInvite
+// @Success 202 {object} model.RedeemedChatroomInvite
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/invites/{token}/redeem [post]
+func RedeemChatroomInvite(inviteService *service.ChatroomInviteService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		redeemed, err := inviteService.RedeemInvite(userID, c.Params("token"))
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't redeem the invite", err)
+		}
+		if !redeemed.Joined {
+			notifyJoinRequestCreated(inviteService, messageHub, redeemed.JoinRequest)
+			return c.Status(fiber.StatusAccepted).JSON(redeemed)
+		}
+		notifyParticipantJoined(messageHub, &model.ParticipantJoined{ChatroomID: redeemed.ChatroomID, UserID: userID, SystemMessage: *redeemed.SystemMessage})
+		return c.JSON(redeemed)
+	}
+}
+
+// JoinPublicChatroom joins a public group chatroom from the chatroom directory
+// @Summary Join a public chatroom
+// @Description Join a public group chatroom. The participants get a PARTICIPANT_JOINED websocket message and the connected clients of the user are subscribed to the chatroom.
+// @Description If the chatroom requires approval, a join request is created instead, the owners and admins get a JOIN_REQUEST_CREATED websocket message and 202 is returned.
+// @Tags Chatrooms
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Success 200 {object} model.RedeemedChatroomInvite
+// @Success 202 {object} model.RedeemedChatroomInvite
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/join [post]
+func JoinPublicChatroom(inviteService *service.ChatroomInviteService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		joined, err := inviteService.JoinPublicChatroom(userID, uint(chatroomID))
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't join the chatroom", err)
+		}
+		if !joined.Joined {
+			notifyJoinRequestCreated(inviteService, messageHub, joined.JoinRequest)
+			return c.Status(fiber.StatusAccepted).JSON(joined)
+		}
+		notifyParticipantJoined(messageHub, &model.ParticipantJoined{ChatroomID: joined.ChatroomID, UserID: userID, SystemMessage: *joined.SystemMessage})
+		return c.JSON(joined)
+	}
+}
+
+// GetChatroomJoinRequests lists the pending join requests of a group chatroom
+// @Summary List join requests
+// @Description List the pending join requests of a group chatroom with the requesting users, oldest first. Only owners and admins can list join requests.
+// @Tags Chatrooms
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Success 200 {array} model.ChatroomJoinRequest
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/join-requests [get]
+func GetChatroomJoinRequests(inviteService *service.ChatroomInviteService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		requests, err := inviteService.GetJoinRequests(userID, uint(chatroomID))
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't get the join requests", err)
+		}
+		return c.JSON(requests)
+	}
+}
+
+// ApproveChatroomJoinRequest adds the user of a join request to the group chatroom
+// @Summary Approve a join request
+// @Description Approve a pending join request. The user joins the chatroom and the participants get a PARTICIPANT_JOINED websocket message. Only owners and admins can approve join requests.
+// @Tags Chatrooms
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param requestID path int true "Join request ID"
+// @Success 200 {object} model.ParticipantJoined
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/join-requests/{requestID}/approve [post]
+func ApproveChatroomJoinRequest(inviteService *service.ChatroomInviteService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, requestID, err := parseJoinRequestParams(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		joined, err := inviteService.ApproveJoinRequest(userID, chatroomID, requestID)
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't approve the join request", err)
+		}
+		notifyParticipantJoined(messageHub, joined)
+		return c.JSON(joined)
+	}
+}
+
+// DeclineChatroomJoinRequest declines a join request of a group chatroom
+// @Summary Decline a join request
+// @Description Decline a pending join request. The user and the owners and admins get a JOIN_REQUEST_DECLINED websocket message. Only owners and admins can decline join requests.
+// @Tags Chatrooms
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param requestID path int true "Join request ID"
+// @Success 200 {object} model.ChatroomJoinRequest
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/join-requests/{requestID}/decline [post]
+func DeclineChatroomJoinRequest(inviteService *service.ChatroomInviteService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		chatroomID, requestID, err := parseJoinRequestParams(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		request, err := inviteService.DeclineJoinRequest(userID, chatroomID, requestID)
+		if err != nil {
+			return chatroomInviteErrorResponse(c, "Couldn't decline the join request", err)
+		}
+		approverIDs, err := inviteService.GetJoinRequestApproverIDs(chatroomID)
+		if err != nil {
+			// the request is already declined, so the other approvers only miss the update
+			log.Printf("Couldn't find the approvers of chatroom %v: %v\n", chatroomID, err)
+		}
+		messageHub.Notify <- consumer.Notification{
+			MessageData: &model.MessageData{
+				MessageOption: model.MessageDataOptionJoinRequestDeclined,
+				JoinRequest:   request,
+			},
+			UserIDs: append(approverIDs, request.UserID),
+		}
+		return c.JSON(request)
+	}
+}
+
+func parseJoinRequestParams(c *fiber.Ctx) (uint, uint, error) {
+	chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid chatroom ID")
+	}
+	requestID, err := strconv.ParseUint(c.Params("requestID"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid join request ID")
+	}
+	return uint(chatroomID), uint(requestID), nil
+}
+
+// notifyParticipantJoined subscribes the clients of the new participant to the chatroom and announces the join to everyone in it
+func notifyParticipantJoined(messageHub *consumer.MessageHub, joined *model.ParticipantJoined) {
+	messageHub.Notify <- consumer.Notification{
+		MessageData: &model.MessageData{
+			MessageOption:     model.MessageDataOptionParticipantJoined,
+			ParticipantJoined: joined,
+		},
+		ChatroomIDs:         []uint{joined.ChatroomID},
+		UserIDs:             []uint{joined.UserID},
+		SubscribeChatroomID: joined.ChatroomID,
+	}
+}
+
+// notifyJoinRequestCreated sends the join request to the owners and admins of its chatroom, so that they can approve or decline it. Clients identify requests by their ID, because a pending request is sent again when the user repeats it.
+func notifyJoinRequestCreated(inviteService *service.ChatroomInviteService, messageHub *consumer.MessageHub, request *model.ChatroomJoinRequest) {
+	approverIDs, err := inviteService.GetJoinRequestApproverIDs(request.ChatroomID)
+	if err != nil {
+		log.Printf("Couldn't notify about join request %v: %v\n", request.ID, err)
+		return
+	}
+	messageHub.Notify <- consumer.Notification{
+		MessageData: &model.MessageData{
+			MessageOption: model.MessageDataOptionJoinRequestCreated,
+			JoinRequest:   request,
+		},
+		UserIDs: approverIDs,
+	}
+}
+
+// chatroomInviteErrorResponse maps the errors of the chatroom invite service to HTTP responses
+func chatroomInviteErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidChatroomInvite):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, service.ErrChatroomPermissionDenied):
+		status = fiber.StatusForbidden
+	case errors.Is(err, service.ErrChatroomInviteNotFound), errors.Is(err, service.ErrJoinRequestNotFound), errors.Is(err, service.ErrPublicChatroomNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, service.ErrAlreadyParticipant):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
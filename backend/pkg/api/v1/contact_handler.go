@@ -0,0 +1,236 @@
+package v1
+
+import (
+	"backend/pkg/consumer"
+	"backend/pkg/model"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetContacts lists the contacts of the authenticated user together with their presence
+// @Summary List contacts
+// @Description List the contacts of the authenticated user ordered by nickname. Online tells whether the contact is connected.
+// @Description Online and lastSeenAt are only included if the last seen privacy settings of both users allow it.
+// @Tags Contacts
+// @Produce json
+// @Success 200 {array} model.Contact
+// @Router /api/v1/contacts [get]
+func GetContacts(contactService *service.ContactService, userService *service.UserService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		contacts, err := contactService.GetContacts(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get contacts: %v", err)})
+		}
+		contactIDs := make([]uint, len(contacts))
+		for i, contact := range contacts {
+			contactIDs[i] = contact.ID
+		}
+		// presence is hidden together with the last seen time
+		lastSeen, err := userService.GetVisibleLastSeen(userID, contactIDs)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get contacts: %v", err)})
+		}
+		online := messageHub.GetOnlineUsers(contactIDs)
+		for i := range contacts {
+			lastSeenAt, visible := lastSeen[contacts[i].ID]
+			contacts[i].Online = visible && online[contacts[i].ID]
+			contacts[i].LastSeenAt = lastSeenAt
+		}
+		return c.JSON(contacts)
+	}
+}
+
+// RemoveContact removes a user from the contacts of the authenticated user and vice versa
+// @Summary Remove a contact
+// @Description Remove a user from the contacts of the authenticated user. The authenticated user is also removed from the user's contacts.
+// @Tags Contacts
+// @Produce json
+// @Param id path int true "User ID of the contact"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/contacts/{id} [delete]
+func RemoveContact(contactService *service.ContactService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		contactID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		if err := contactService.RemoveContact(userID, uint(contactID)); err != nil {
+			return contactErrorResponse(c, "Couldn't remove the contact", err)
+		}
+		return c.JSON(fiber.Map{"message": "Contact removed"})
+	}
+}
+
+// GetContactRequests lists the pending contact requests of the authenticated user
+// @Summary List pending contact requests
+// @Description List the pending contact requests received (incoming, default) or sent (outgoing) by the authenticated user, newest first
+// @Tags Contacts
+// @Produce json
+// @Param direction query string false "incoming or outgoing"
+// @Success 200 {array} model.ContactRequest
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/contact-requests [get]
+func GetContactRequests(contactService *service.ContactService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		direction := c.Query("direction", "incoming")
+		if direction != "incoming" && direction != "outgoing" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "direction should be incoming or outgoing"})
+		}
+		requests, err := contactService.GetPendingRequests(userID, direction == "incoming")
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get contact requests: %v", err)})
+		}
+		return c.JSON(requests)
+	}
+}
+
+// SendContactRequest sends a contact request to a user. If the user already sent a request to the authenticated user, that request is accepted instead.
+// @Summary Send a contact request
+// @Description Send a contact request to a user. The sender and the recipient are notified through the websocket.
+// @Tags Contacts
+// @Accept json
+// @Produce json
+// @Param body body model.SendContactRequestRequest true "Recipient"
+// @Success 201 {object} model.ContactRequest
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/contact-requests [post]
+func SendContactRequest(contactService *service.ContactService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.SendContactRequestRequest)
+		if err := c.BodyParser(request); err != nil || request.UserID == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't send the contact request: userID should be specified"})
+		}
+		contactRequest, err := contactService.SendRequest(userID, request.UserID)
+		if err != nil {
+			return contactErrorResponse(c, "Couldn't send the contact request", err)
+		}
+		option := model.MessageDataOptionContactRequestSent
+		if contactRequest.Status == model.ContactRequestStatusAccepted {
+			option = model.MessageDataOptionContactRequestAccepted
+		}
+		notifyContactRequest(messageHub, option, contactRequest)
+		return c.Status(fiber.StatusCreated).JSON(contactRequest)
+	}
+}
+
+// AcceptContactRequest accepts a contact request received by the authenticated user
+// @Summary Accept a contact request
+// @Description Accept a contact request. The users become each other's contacts.
+// @Tags Contacts
+// @Produce json
+// @Param id path int true "Contact request ID"
+// @Success 200 {object} model.ContactRequest
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/contact-requests/{id}/accept [post]
+func AcceptContactRequest(contactService *service.ContactService, messageHub *consumer.MessageHub) fiber.Handler {
+	return respondToContactRequest(contactService.AcceptRequest, model.MessageDataOptionContactRequestAccepted, messageHub)
+}
+
+// DeclineContactRequest declines a contact request received by the authenticated user
+// @Summary Decline a contact request
+// @Description Decline a contact request received by the authenticated user
+// @Tags Contacts
+// @Produce json
+// @Param id path int true "Contact request ID"
+// @Success 200 {object} model.ContactRequest
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/contact-requests/{id}/decline [post]
+func DeclineContactRequest(contactService *service.ContactService, messageHub *consumer.MessageHub) fiber.Handler {
+	return respondToContactRequest(contactService.DeclineRequest, model.MessageDataOptionContactRequestDeclined, messageHub)
+}
+
+// CancelContactRequest cancels a contact request sent by the authenticated user
+// @Summary Cancel a contact request
+// @Description Cancel a pending contact request sent by the authenticated user
+// @Tags Contacts
+// @Produce json
+// @Param id path int true "Contact request ID"
+// @Success 200 {object} model.ContactRequest
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/contact-requests/{id} [delete]
+func CancelContactRequest(contactService *service.ContactService, messageHub *consumer.MessageHub) fiber.Handler {
+	return respondToContactRequest(contactService.CancelRequest, model.MessageDataOptionContactRequestCancelled, messageHub)
+}
+
+// respondToContactRequest handles the actions on a pending contact request and notifies both users about the outcome
+func respondToContactRequest(respond func(userID, requestID uint) (*model.ContactRequest, error), option string, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		requestID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid contact request ID"})
+		}
+		contactRequest, err := respond(userID, uint(requestID))
+		if err != nil {
+			return contactErrorResponse(c, "Couldn't update the contact request", err)
+		}
+		notifyContactRequest(messageHub, option, contactRequest)
+		return c.JSON(contactRequest)
+	}
+}
+
+func notifyContactRequest(messageHub *consumer.MessageHub, option string, contactRequest *model.ContactRequest) {
+	messageHub.Notify <- consumer.Notification{
+		MessageData: &model.MessageData{
+			MessageOption:  option,
+			ContactRequest: contactRequest,
+		},
+		UserIDs: []uint{contactRequest.SenderID, contactRequest.RecipientID},
+	}
+}
+
+// contactErrorResponse maps the errors of the contact service to the status codes
+func contactErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrCannotTargetSelf):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, service.ErrContactRequestNotAllowed):
+		status = fiber.StatusForbidden
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrContactRequestNotFound), errors.Is(err, service.ErrContactNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, service.ErrContactRequestExists), errors.Is(err, service.ErrAlreadyContacts):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
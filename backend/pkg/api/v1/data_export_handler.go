@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestDataExport queues an export of the personal data of the authenticated user
+// @Summary Request a personal data export
+// @Description Queue a zip archive with the profile, chatroom memberships, sent messages, message views and attachments of the authenticated user.
+// @Description A DATA_EXPORT_READY or DATA_EXPORT_FAILED websocket message is sent when the archive is finished. Only one export can be in progress at a time.
+// @Tags Users
+// @Produce json
+// @Success 202 {object} model.DataExport
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/exports [post]
+func RequestDataExport(dataExportService *service.DataExportService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		export, err := dataExportService.RequestExport(userID)
+		if err != nil {
+			return dataExportErrorResponse(c, "Couldn't request data export", err)
+		}
+		return c.Status(fiber.StatusAccepted).JSON(export)
+	}
+}
+
+// GetDataExports lists the personal data exports of the authenticated user
+// @Summary List personal data exports
+// @Description List the personal data exports of the authenticated user, newest first
+// @Tags Users
+// @Produce json
+// @Success 200 {array} model.DataExport
+// @Router /api/v1/users/me/exports [get]
+func GetDataExports(dataExportService *service.DataExportService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		exports, err := dataExportService.GetExports(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get data exports: %v", err)})
+		}
+		return c.JSON(exports)
+	}
+}
+
+// DownloadDataExport sends the archive of a ready personal data export of the authenticated user
+// @Summary Download a personal data export
+// @Description Download the zip archive of a READY personal data export of the authenticated user
+// @Tags Users
+// @Produce application/zip
+// @Param id path int true "Export ID"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/exports/{id}/download [get]
+func DownloadDataExport(dataExportService *service.DataExportService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		exportID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid export ID"})
+		}
+		filePath, err := dataExportService.GetArchivePath(userID, uint(exportID))
+		if err != nil {
+			return dataExportErrorResponse(c, "Couldn't download data export", err)
+		}
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.Download(filePath, fmt.Sprintf("chatapp-data-export-%v.zip", exportID))
+	}
+}
+
+// dataExportErrorResponse maps the errors of the data export service to HTTP responses
+func dataExportErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrDataExportNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, service.ErrDataExportInProgress), errors.Is(err, service.ErrDataExportNotReady):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
@@ -3,32 +3,97 @@ package v1
 import (
 	"backend/pkg/config"
 	"backend/pkg/model"
+	"backend/pkg/service"
 	"encoding/json"
+	"fmt"
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/streadway/amqp"
 )
 
-// SendMessage Sends a message to message queue
-func SendMessage(messageChannel *amqp.Channel) fiber.Handler {
+// SendMessage sends a message to a chatroom through the same message queue as the websocket SEND_MESSAGE action. It is meant for bots posting with an API key.
+// @Summary Send a message
+// @Description Send a message to a chatroom as the authenticated user or bot. The message is delivered asynchronously.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Param id path int true "Chatroom ID"
+// @Param body body model.SendMessageRequest true "Message"
+// @Success 202 {object} model.MessageData
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/chatrooms/{id}/messages [post]
+func SendMessage(chatroomService *service.ChatroomService, userService *service.UserService, messageChannel *amqp.Channel) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		body := new(model.ChatMessage)
-		err := c.BodyParser(body)
+		chatroomID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid chatroom ID"})
+		}
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		allowedForAPIKey, err := isChatroomAllowedForAPIKey(c, chatroomService, uint(chatroomID))
 		if err != nil {
-			_ = c.Status(fiber.StatusBadRequest).SendString(err.Error())
-			return err
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't check the API key: %v", err)})
+		}
+		if !allowedForAPIKey {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "API key is not valid for this chatroom"})
 		}
-		err = SendToQueue(*body, messageChannel)
+		// the same check as for messages sent through the websocket
+		allowed, err := userService.CanSendMessages(userID)
 		if err != nil {
-			_ = c.Status(fiber.StatusInternalServerError).SendString(err.Error())
-			return err
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't send the message: %v", err)})
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Email address should be verified before sending messages"})
+		}
+		request := new(model.SendMessageRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't parse the request: %v", err)})
+		}
+		if request.Text == "" && request.AttachmentURL == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Message text or attachment should be specified"})
+		}
+		canSend, err := chatroomService.CanSendMessage(uint(chatroomID), userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't send the message: %v", err)})
+		}
+		if !canSend {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Only participants can send messages to the chatroom, and only admins if the group restricts sending"})
 		}
-		return c.Status(fiber.StatusOK).JSON(body)
+		blocked, err := chatroomService.IsBlockedInPrivateChatroom(uint(chatroomID), userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't send the message: %v", err)})
+		}
+		if blocked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Messages can't be sent to this private chatroom because of a block"})
+		}
+
+		messageData := &model.MessageData{
+			MessageOption: model.MessageDataOptionSendMessage,
+			ActorID:       userID,
+			SendMessage: &model.SendMessage{ChatMessage: model.ChatMessage{
+				ChatroomID:    uint(chatroomID),
+				SenderID:      userID,
+				Text:          request.Text,
+				AttachmentURL: request.AttachmentURL,
+			}},
+		}
+		if err := SendToQueue(messageData, messageChannel); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't send the message: %v", err)})
+		}
+		return c.Status(fiber.StatusAccepted).JSON(messageData)
 	}
 }
 
-func SendToQueue(message model.ChatMessage, ch *amqp.Channel) error {
-	// Serialize message to JSON
-	messageBytes, err := json.Marshal(message)
+// SendToQueue publishes the message data to the message queue to be handled by the message consumer
+func SendToQueue(messageData *model.MessageData, ch *amqp.Channel) error {
+	// Serialize message data to JSON
+	messageBytes, err := json.Marshal(messageData)
 	if err != nil {
 		return err
 	}
@@ -45,3 +110,16 @@ func SendToQueue(message model.ChatMessage, ch *amqp.Channel) error {
 	)
 	return err
 }
+
+// isChatroomAllowedForAPIKey checks the chatrooms of the API key if the request was authenticated with one.
+// The bot may have left the chatroom since the key was created, so its participation is checked again.
+func isChatroomAllowedForAPIKey(c *fiber.Ctx, chatroomService *service.ChatroomService, chatroomID uint) (bool, error) {
+	apiKey, ok := c.Locals("apiKey").(*model.APIKey)
+	if !ok {
+		return true, nil
+	}
+	if !apiKey.AllowsChatroom(chatroomID) {
+		return false, nil
+	}
+	return chatroomService.IsParticipant(chatroomID, apiKey.UserID)
+}
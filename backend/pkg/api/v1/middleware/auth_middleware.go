@@ -2,12 +2,14 @@ package middleware
 
 import (
 	v1 "backend/pkg/api/v1"
+	"backend/pkg/service"
 	"github.com/gofiber/fiber/v2"
 	"strings"
 )
 
-// AuthMiddleware middleware to check JWT token in Authorization header
-func AuthMiddleware() func(c *fiber.Ctx) error {
+// AuthMiddleware middleware to check JWT token in Authorization header and that its session wasn't revoked.
+// Bot API keys are accepted instead of JWT tokens only on routes that declare the API key scopes they require.
+func AuthMiddleware(sessionService *service.SessionService, botService *service.BotService, apiKeyScopes ...string) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -15,15 +17,53 @@ func AuthMiddleware() func(c *fiber.Ctx) error {
 				"message": "Authorization header missing",
 			})
 		}
-		token := strings.Split(authHeader, " ")[1]
-		userID, err := v1.ValidateAuthToken(token)
+		headerParts := strings.Split(authHeader, " ")
+		if len(headerParts) < 2 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid token",
+			})
+		}
+		token := headerParts[1]
+		if strings.HasPrefix(token, service.APIKeyPrefix) {
+			return authenticateAPIKey(c, botService, token, apiKeyScopes)
+		}
+		userID, sessionID, err := v1.ValidateAuthToken(token)
+		if err == nil {
+			err = sessionService.ValidateSession(sessionID, userID)
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "Invalid token",
 			})
 		}
-		// Set user ID in context for subsequent handlers
+		// Set user ID and session ID in context for subsequent handlers
 		c.Locals("userID", userID)
+		c.Locals("sessionID", sessionID)
 		return c.Next()
 	}
 }
+
+func authenticateAPIKey(c *fiber.Ctx, botService *service.BotService, key string, requiredScopes []string) error {
+	if len(requiredScopes) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "API keys are not accepted on this route",
+		})
+	}
+	apiKey, err := botService.AuthenticateAPIKey(key)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid API key",
+		})
+	}
+	for _, scope := range requiredScopes {
+		if !apiKey.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "API key is missing the scope " + scope,
+			})
+		}
+	}
+	// Set user ID of the bot and the key in context for subsequent handlers. The chatrooms of the key are checked by the handlers.
+	c.Locals("userID", apiKey.UserID)
+	c.Locals("apiKey", apiKey)
+	return c.Next()
+}
@@ -0,0 +1,131 @@
+package v1
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/oidc"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const oidcLoginStateAudience = "oidc-login"
+
+// oidcLoginState is kept in a signed cookie between redirecting the user to the identity provider and the callback
+type oidcLoginState struct {
+	jwt.RegisteredClaims
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+// OIDCLoginHandler starts the OpenID Connect login by redirecting the user to the identity provider
+// @Summary Start OpenID Connect login
+// @Description Redirect to the identity provider's login page using the authorization code flow with PKCE
+// @Tags Authentication
+// @Success 302
+// @Router /api/v1/auth/oidc/login [get]
+func OIDCLoginHandler(oidcService *service.OIDCService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		loginState := &oidcLoginState{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{oidcLoginStateAudience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.OIDCLoginStateTTLMinutes * time.Minute)),
+			},
+		}
+		for _, value := range []*string{&loginState.State, &loginState.Nonce, &loginState.CodeVerifier} {
+			randomString, err := oidc.GenerateRandomString()
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't start login: %v", err)})
+			}
+			*value = randomString
+		}
+		signedState, err := jwt.NewWithClaims(jwt.SigningMethodHS256, loginState).SignedString([]byte(config.JwtSecret))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't start login: %v", err)})
+		}
+		authURL, err := oidcService.AuthCodeURL(loginState.State, loginState.Nonce, loginState.CodeVerifier)
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't start login: %v", err)})
+		}
+
+		c.Cookie(&fiber.Cookie{
+			Name:     config.OIDCLoginStateCookieName,
+			Value:    signedState,
+			Path:     "/api/v1/auth/oidc",
+			MaxAge:   config.OIDCLoginStateTTLMinutes * 60,
+			HTTPOnly: true,
+			Secure:   c.Protocol() == "https",
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+		return c.Redirect(authURL, fiber.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler completes the OpenID Connect login and redirects to the frontend with the auth token in the URL fragment
+// @Summary Complete OpenID Connect login
+// @Description Callback of the identity provider. Redirects to the frontend with the auth token (or an error) in the URL fragment.
+// @Tags Authentication
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 302
+// @Router /api/v1/auth/oidc/callback [get]
+func OIDCCallbackHandler(oidcService *service.OIDCService, sessionService *service.SessionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		signedState := c.Cookies(config.OIDCLoginStateCookieName)
+		// the login state can be used only once
+		c.ClearCookie(config.OIDCLoginStateCookieName)
+
+		if providerError := c.Query("error"); providerError != "" {
+			return redirectToFrontendWithOIDCResult(c, "error", providerError)
+		}
+		loginState, err := parseOIDCLoginState(signedState)
+		if err != nil || c.Query("state") != loginState.State || c.Query("code") == "" {
+			log.Printf("OpenID Connect callback with invalid state: %v\n", err)
+			return redirectToFrontendWithOIDCResult(c, "error", "invalid_state")
+		}
+
+		user, err := oidcService.Login(c.Query("code"), loginState.CodeVerifier, loginState.Nonce)
+		if err != nil {
+			log.Printf("OpenID Connect login failed: %v\n", err)
+			if errors.Is(err, service.ErrIdentityNotLinked) {
+				return redirectToFrontendWithOIDCResult(c, "error", "not_provisioned")
+			}
+			return redirectToFrontendWithOIDCResult(c, "error", "login_failed")
+		}
+		token, err := issueAuthToken(c, sessionService, user.ID)
+		if err != nil {
+			return redirectToFrontendWithOIDCResult(c, "error", "login_failed")
+		}
+		return redirectToFrontendWithOIDCResult(c, "token", token)
+	}
+}
+
+func parseOIDCLoginState(signedState string) (*oidcLoginState, error) {
+	if signedState == "" {
+		return nil, fmt.Errorf("login state cookie is missing")
+	}
+	loginState := &oidcLoginState{}
+	parsedToken, err := jwt.ParseWithClaims(signedState, loginState, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JwtSecret), nil
+	})
+	if err != nil || !parsedToken.Valid {
+		return nil, fmt.Errorf("invalid login state: %v", err)
+	}
+	if !loginState.VerifyAudience(oidcLoginStateAudience, true) {
+		return nil, fmt.Errorf("invalid login state: unexpected audience")
+	}
+	return loginState, nil
+}
+
+// redirectToFrontendWithOIDCResult passes the result in the URL fragment, so that it isn't sent to any server or logged
+func redirectToFrontendWithOIDCResult(c *fiber.Ctx, key, value string) error {
+	fragment := url.Values{}
+	fragment.Set(key, value)
+	return c.Redirect(fmt.Sprintf("%v/login/oidc#%v", config.AppBaseURL(), fragment.Encode()), fiber.StatusFound)
+}
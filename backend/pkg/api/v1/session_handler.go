@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"backend/pkg/consumer"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSessions lists the active sessions of the authenticated user
+// @Summary Get sessions
+// @Description Retrieve the devices where the authenticated user is logged in. The session of the request is marked as current.
+// @Tags Sessions
+// @Produce json
+// @Success 200 {array} model.Session
+// @Router /api/v1/sessions [get]
+func GetSessions(sessionService *service.SessionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, sessionID, ok := getAuthenticatedSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "session not found in context",
+			})
+		}
+		sessions, err := sessionService.GetSessions(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the sessions from database: %v", err)})
+		}
+		return c.JSON(sessions)
+	}
+}
+
+// RevokeSession revokes a session of the authenticated user and closes its websocket connections
+// @Summary Revoke a session
+// @Description Log out the authenticated user on the device of the given session
+// @Tags Sessions
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/sessions/{id} [delete]
+func RevokeSession(sessionService *service.SessionService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _, ok := getAuthenticatedSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "session not found in context",
+			})
+		}
+		sessionID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid session ID"})
+		}
+		if err := sessionService.RevokeSession(userID, uint(sessionID)); err != nil {
+			if errors.Is(err, service.ErrSessionNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't revoke the session: %v", err)})
+		}
+		messageHub.CloseSessions <- []uint{uint(sessionID)}
+		return c.JSON(fiber.Map{"message": "Session revoked"})
+	}
+}
+
+// RevokeOtherSessions revokes all sessions of the authenticated user except the current one and closes their websocket connections
+// @Summary Revoke all other sessions
+// @Description Log out the authenticated user on all devices except the one of the request
+// @Tags Sessions
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/sessions [delete]
+func RevokeOtherSessions(sessionService *service.SessionService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, sessionID, ok := getAuthenticatedSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "session not found in context",
+			})
+		}
+		revoked, err := sessionService.RevokeOtherSessions(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't revoke the sessions: %v", err)})
+		}
+		if len(revoked) > 0 {
+			messageHub.CloseSessions <- revoked
+		}
+		return c.JSON(fiber.Map{"message": "Sessions revoked", "revokedSessionIDs": revoked})
+	}
+}
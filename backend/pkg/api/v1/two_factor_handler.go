@@ -0,0 +1,175 @@
+package v1
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/service"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TwoFactorLoginHandler completes the login of a user with two-factor authentication enabled
+// @Summary Complete two-factor login
+// @Description Exchange the challenge token from the login and a TOTP or recovery code for an auth token
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body model.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} model.LoginResponse
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /api/v1/login/2fa [post]
+func TwoFactorLoginHandler(authService *service.AuthService, sessionService *service.SessionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request := new(model.TwoFactorLoginRequest)
+		if err := c.BodyParser(request); err != nil || request.ChallengeToken == "" || request.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't login: challenge token and code should be specified"})
+		}
+		userID, err := ValidateTwoFactorChallengeToken(request.ChallengeToken)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Couldn't login: invalid or expired challenge token"})
+		}
+		if err := authService.VerifySecondFactor(userID, request.Code); err != nil {
+			return twoFactorErrorResponse(c, "Couldn't login", err)
+		}
+
+		token, err := issueAuthToken(c, sessionService, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't login: %v", err)})
+		}
+		return c.JSON(model.LoginResponse{Token: token})
+	}
+}
+
+// BeginTwoFactorEnrolmentHandler generates a new TOTP secret for the authenticated user
+// @Summary Start two-factor enrolment
+// @Description Generate a TOTP secret and the otpauth URI to add it to an authenticator app. Two-factor authentication is enabled once a code is confirmed.
+// @Tags Two-factor authentication
+// @Produce json
+// @Success 200 {object} model.TwoFactorEnrolment
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/2fa/enrol [post]
+func BeginTwoFactorEnrolmentHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		enrolment, err := authService.BeginTwoFactorEnrolment(userID)
+		if err != nil {
+			return twoFactorErrorResponse(c, "Couldn't start two-factor enrolment", err)
+		}
+		return c.JSON(enrolment)
+	}
+}
+
+// ConfirmTwoFactorEnrolmentHandler enables two-factor authentication for the authenticated user
+// @Summary Confirm two-factor enrolment
+// @Description Enable two-factor authentication by confirming a code from the authenticator app. Returns one-time recovery codes.
+// @Tags Two-factor authentication
+// @Accept json
+// @Produce json
+// @Param body body model.TwoFactorConfirmRequest true "TOTP code"
+// @Success 200 {object} model.RecoveryCodesResponse
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/2fa/confirm [post]
+func ConfirmTwoFactorEnrolmentHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.TwoFactorConfirmRequest)
+		if err := c.BodyParser(request); err != nil || request.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't confirm two-factor enrolment: code should be specified"})
+		}
+		recoveryCodes, err := authService.ConfirmTwoFactorEnrolment(userID, request.Code)
+		if err != nil {
+			return twoFactorErrorResponse(c, "Couldn't confirm two-factor enrolment", err)
+		}
+		return c.JSON(model.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	}
+}
+
+// DisableTwoFactorHandler disables two-factor authentication for the authenticated user
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication after re-authenticating with the password and a TOTP or recovery code
+// @Tags Two-factor authentication
+// @Accept json
+// @Produce json
+// @Param body body model.TwoFactorReauthRequest true "Password and code"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/2fa/disable [post]
+func DisableTwoFactorHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.TwoFactorReauthRequest)
+		if err := c.BodyParser(request); err != nil || request.Password == "" || request.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't disable two-factor authentication: password and code should be specified"})
+		}
+		if err := authService.DisableTwoFactor(userID, request.Password, request.Code); err != nil {
+			return twoFactorErrorResponse(c, "Couldn't disable two-factor authentication", err)
+		}
+		return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the authenticated user
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after re-authenticating with the password and a TOTP or recovery code
+// @Tags Two-factor authentication
+// @Accept json
+// @Produce json
+// @Param body body model.TwoFactorReauthRequest true "Password and code"
+// @Success 200 {object} model.RecoveryCodesResponse
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/2fa/recovery-codes [post]
+func RegenerateRecoveryCodesHandler(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.TwoFactorReauthRequest)
+		if err := c.BodyParser(request); err != nil || request.Password == "" || request.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't regenerate recovery codes: password and code should be specified"})
+		}
+		recoveryCodes, err := authService.RegenerateRecoveryCodes(userID, request.Password, request.Code)
+		if err != nil {
+			return twoFactorErrorResponse(c, "Couldn't regenerate recovery codes", err)
+		}
+		return c.JSON(model.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	}
+}
+
+// twoFactorErrorResponse maps errors of the two-factor flows to response statuses
+func twoFactorErrorResponse(c *fiber.Ctx, prefix string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidPassword), errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrInvalidOrExpiredToken):
+		status = fiber.StatusUnauthorized
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrTwoFactorNotEnrolled),
+		errors.Is(err, service.ErrPasswordNotSet), errors.Is(err, service.ErrPasswordAlreadySet):
+		status = fiber.StatusConflict
+	case errors.Is(err, service.ErrTooManyTwoFactorAttempts):
+		status = fiber.StatusTooManyRequests
+	}
+	return c.Status(status).JSON(fiber.Map{"message": fmt.Sprintf("%v: %v", prefix, err)})
+}
@@ -1,35 +1,111 @@
 package v1
 
 import (
+	"backend/pkg/config"
+	"backend/pkg/consumer"
 	"backend/pkg/model"
 	"backend/pkg/service"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// GetUsers fetches all users
-// @Summary Get all users
-// @Description Retrieve all users
+// GetUsers fetches a page of the user directory
+// @Summary List users
+// @Description List users page by page, optionally filtered. Pass the nextCursor of a page as cursor to fetch the next page with the same sort order and filters.
 // @Tags Users
 // @Accept json
 // @Produce json
-// @Success 200 {array} model.User
+// @Param sort query string false "Sort by nickname (default) or createdAt"
+// @Param order query string false "asc (default) or desc"
+// @Param createdSince query string false "Only users registered at or after this RFC 3339 time"
+// @Param hasAvatar query bool false "Only users with (true) or without (false) an avatar"
+// @Param isBot query bool false "Only bots (true) or people (false)"
+// @Param isActive query bool false "Only users who used the app within the last 30 days (true) or who didn't (false)"
+// @Param cursor query string false "Cursor of the next page"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} model.UserPage
+// @Failure 400 {object} map[string]string
 // @Router /api/v1/users [get]
 func GetUsers(userService *service.UserService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		users, err := userService.GetAllUsers()
+		filter, err := parseUserDirectoryFilter(c)
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		pageSize, err := parseInt(c.Query("pageSize"), config.UserDirectoryPaginationDefaultSize)
+		if err != nil || pageSize > config.UserDirectoryPaginationMaxSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid pageSize query parameter: %v", c.Query("pageSize"))})
+		}
+		page, err := userService.GetDirectoryPage(filter, c.Query("cursor"), int(pageSize))
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid cursor query parameter"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the users from database: %v", err)})
+		}
+		return c.JSON(page)
+	}
+}
+
+// parseUserDirectoryFilter reads the sort order and the filters of the user directory from the query parameters
+func parseUserDirectoryFilter(c *fiber.Ctx) (model.UserDirectoryFilter, error) {
+	filter := model.UserDirectoryFilter{Sort: model.UserDirectorySortNickname}
+	switch sort := c.Query("sort"); sort {
+	case "", model.UserDirectorySortNickname:
+	case model.UserDirectorySortCreatedAt:
+		filter.Sort = sort
+	default:
+		return filter, fmt.Errorf("Invalid sort query parameter: %v", sort)
+	}
+	switch order := c.Query("order"); order {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("Invalid order query parameter: %v", order)
+	}
+	if createdSince := c.Query("createdSince"); createdSince != "" {
+		parsed, err := time.Parse(time.RFC3339, createdSince)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid createdSince query parameter: %v", createdSince)
 		}
-		return c.JSON(users)
+		filter.CreatedSince = &parsed
+	}
+	var err error
+	if filter.HasAvatar, err = parseOptionalBool(c, "hasAvatar"); err != nil {
+		return filter, err
+	}
+	if filter.IsBot, err = parseOptionalBool(c, "isBot"); err != nil {
+		return filter, err
+	}
+	if filter.IsActive, err = parseOptionalBool(c, "isActive"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseOptionalBool parses a boolean query parameter. Returns nil if the parameter is not given.
+func parseOptionalBool(c *fiber.Ctx, name string) (*bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %v query parameter: %v", name, value)
 	}
+	return &parsed, nil
 }
 
 // GetUser gets a specific user with given id
 // @Summary Get a user
-// @Description Retrieve information about a user by ID
+// @Description Retrieve information about a user by ID. lastSeenAt is only included if the privacy settings of both users allow it.
 // @Tags Users
 // @Accept json
 // @Produce json
@@ -51,29 +127,43 @@ func GetUser(userService *service.UserService) fiber.Handler {
 		if user == nil {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
 		}
+		if viewerID, ok := c.Locals("userID").(uint); ok {
+			lastSeen, err := userService.GetVisibleLastSeen(viewerID, []uint{user.ID})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't query the user from database: %v", err)})
+			}
+			user.LastSeenAt = lastSeen[user.ID]
+		}
 
 		return c.JSON(user)
 	}
 }
 
-// SearchUsers fetches all users containing the searchTerm in their email or nickname
+// SearchUsers fetches a page of users matching the searchTerm in their email or nickname, ranked by relationship to the searcher and relevance
 // @Summary Search users
-// @Description Search for users by email or nickname containing the provided search term
+// @Description Search for users by email or nickname matching the provided search term. Contacts come first, then members of shared chatrooms, then everyone else, each ordered by relevance.
+// @Description Terms shorter than 3 characters only match the beginning of nicknames. Pass the nextCursor of a page as cursor to fetch the next page.
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param searchTerm query string true "Search term"
-// @Success 200 {array} model.User
+// @Param cursor query string false "Cursor of the next page"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} model.UserPage
 // @Failure 400 {object} map[string]string
 // @Router /api/v1/users/search [get]
 func SearchUsers(userService *service.UserService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the search term from the query parameter
-		searchTerm := c.Query("searchTerm")
+		searchTerm := strings.TrimSpace(c.Query("searchTerm"))
 
 		// Check if searchTerm is empty
 		if searchTerm == "" {
-			return c.JSON([]model.User{})
+			return c.JSON(model.UserPage{Users: []model.User{}})
+		}
+		pageSize, err := parseInt(c.Query("pageSize"), config.UserSearchPaginationDefaultSize)
+		if err != nil || pageSize < 1 || pageSize > config.UserSearchPaginationMaxSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Invalid pageSize query parameter: %v", c.Query("pageSize"))})
 		}
 		userIDRaw := c.Locals("userID")
 		userID, ok := userIDRaw.(uint)
@@ -83,11 +173,348 @@ func SearchUsers(userService *service.UserService) fiber.Handler {
 			})
 		}
 		excludedUsers := []uint{userID}
-		users, err := userService.GetUsersBySearchTerm(searchTerm, excludedUsers)
+		page, err := userService.SearchUsers(searchTerm, userID, excludedUsers, c.Query("cursor"), int(pageSize))
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid cursor query parameter"})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Error searching users: %v", err)})
 		}
 
-		return c.JSON(users)
+		return c.JSON(page)
+	}
+}
+
+// UpdateProfile updates the nickname and/or avatar of the authenticated user and notifies the users who share a chatroom with them
+// @Summary Update own profile
+// @Description Update the nickname and/or avatar URL of the authenticated user. Fields which are not specified stay unchanged.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body model.UpdateProfileRequest true "Profile fields to update"
+// @Success 200 {object} model.User
+// @Failure 400 {object} service.ValidationError
+// @Failure 409 {object} service.ValidationError
+// @Router /api/v1/users/me [patch]
+func UpdateProfile(userService *service.UserService, chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.UpdateProfileRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't update profile: Couldn't parse the request: %v", err)})
+		}
+		user, err := userService.UpdateProfile(userID, *request)
+		if err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't update profile", validationErr)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't update profile: %v", err)})
+		}
+
+		messageHub.NotifyUserUpdated(chatroomService, user)
+		return c.JSON(user)
+	}
+}
+
+// UploadAvatar sets the uploaded image as the avatar of the authenticated user. The image is cropped to a square and stored in several sizes.
+// @Summary Upload own avatar
+// @Description Upload a JPEG, PNG or GIF image as the avatar of the authenticated user. Image metadata is removed. The avatarURL of the returned user points to the largest size.
+// @Tags Users
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} model.User
+// @Failure 400 {object} service.ValidationError
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/users/me/avatar [post]
+func UploadAvatar(userService *service.UserService, chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		fileHeader, err := c.FormFile("avatar")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't upload avatar: the image should be sent in the avatar form field"})
+		}
+		maxBytes := config.AvatarMaxUploadBytes()
+		if fileHeader.Size > int64(maxBytes) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: the image should be at most %v bytes", maxBytes)})
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: %v", err)})
+		}
+		defer file.Close()
+		imageData, err := io.ReadAll(io.LimitReader(file, int64(maxBytes)))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: %v", err)})
+		}
+
+		user, err := userService.UploadAvatar(userID, imageData)
+		if err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't upload avatar", validationErr)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't upload avatar: %v", err)})
+		}
+		messageHub.NotifyUserUpdated(chatroomService, user)
+		return c.JSON(user)
+	}
+}
+
+// SetStatus sets the custom status of the authenticated user and notifies the users who share a chatroom with them
+// @Summary Set own status
+// @Description Set a status emoji and/or text of the authenticated user with an optional expiry time after which the status is cleared
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body model.SetUserStatusRequest true "Status"
+// @Success 200 {object} model.User
+// @Failure 400 {object} service.ValidationError
+// @Router /api/v1/users/me/status [put]
+func SetStatus(userService *service.UserService, chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.SetUserStatusRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't set status: Couldn't parse the request: %v", err)})
+		}
+		user, err := userService.SetStatus(userID, *request)
+		if err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't set status", validationErr)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't set status: %v", err)})
+		}
+
+		messageHub.NotifyUserUpdated(chatroomService, user)
+		return c.JSON(user)
+	}
+}
+
+// ClearStatus removes the custom status of the authenticated user and notifies the users who share a chatroom with them
+// @Summary Clear own status
+// @Description Remove the status emoji and text of the authenticated user
+// @Tags Users
+// @Produce json
+// @Success 200 {object} model.User
+// @Router /api/v1/users/me/status [delete]
+func ClearStatus(userService *service.UserService, chatroomService *service.ChatroomService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		user, err := userService.ClearStatus(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't clear status: %v", err)})
+		}
+
+		messageHub.NotifyUserUpdated(chatroomService, user)
+		return c.JSON(user)
+	}
+}
+
+// ChangePassword changes the password of the authenticated user and logs them out on all other devices
+// @Summary Change own password
+// @Description Change the password of the authenticated user. All other sessions of the user are revoked.
+// @Description Users without a password, e.g. who signed up with OIDC, set one with a confirmation token from POST /api/v1/users/me/identity-confirmation instead of the current password.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body model.ChangePasswordRequest true "Current password or confirmation token and new password"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} service.ValidationError
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/password [post]
+func ChangePassword(authService *service.AuthService, sessionService *service.SessionService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, sessionID, ok := getAuthenticatedSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "session not found in context",
+			})
+		}
+		request := new(model.ChangePasswordRequest)
+		if err := c.BodyParser(request); err != nil || (request.CurrentPassword == "" && request.ConfirmationToken == "") || request.NewPassword == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't change password: current password or confirmation token and new password should be specified"})
+		}
+		if err := authService.ChangePassword(userID, request.CurrentPassword, request.ConfirmationToken, request.NewPassword); err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't change password", validationErr)
+			}
+			return twoFactorErrorResponse(c, "Couldn't change password", err)
+		}
+
+		// whoever else is logged in with the old password shouldn't stay logged in
+		revoked, err := sessionService.RevokeOtherSessions(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Password changed, but couldn't revoke the other sessions: %v", err)})
+		}
+		if len(revoked) > 0 {
+			messageHub.CloseSessions <- revoked
+		}
+		return c.JSON(fiber.Map{"message": "Password changed", "revokedSessionIDs": revoked})
+	}
+}
+
+// RequestIdentityConfirmation mails a confirmation token to the authenticated user if they have no password
+// @Summary Request an identity confirmation token
+// @Description Mail a confirmation token to the authenticated user, which replaces the password when deleting the account or setting a password. Only for users without a password, e.g. who signed up with OIDC.
+// @Tags Users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/identity-confirmation [post]
+func RequestIdentityConfirmation(authService *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		if err := authService.SendIdentityConfirmation(userID); err != nil {
+			return twoFactorErrorResponse(c, "Couldn't send confirmation token", err)
+		}
+		return c.JSON(fiber.Map{"message": "Confirmation token sent"})
+	}
+}
+
+// DeleteAccount deletes the account of the authenticated user. The user's messages are kept but anonymised, and their chatrooms are notified.
+// @Summary Delete own account
+// @Description Delete the account of the authenticated user after confirming the password (and two-factor code if enabled). The id can only be "me" or the ID of the authenticated user.
+// @Description Users without a password confirm with a confirmation token from POST /api/v1/users/me/identity-confirmation instead.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID or me"
+// @Param body body model.DeleteAccountRequest true "Password or confirmation token and two-factor code"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/{id} [delete]
+func DeleteAccount(userService *service.UserService, authService *service.AuthService, messageHub *consumer.MessageHub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		if id := c.Params("id", "me"); id != "me" && id != strconv.Itoa(int(userID)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Users can only delete their own account"})
+		}
+		request := new(model.DeleteAccountRequest)
+		if err := c.BodyParser(request); err != nil || (request.Password == "" && request.ConfirmationToken == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Couldn't delete account: password or confirmation token should be specified"})
+		}
+		if err := authService.ConfirmIdentity(userID, request.Password, request.ConfirmationToken, request.Code); err != nil {
+			return twoFactorErrorResponse(c, "Couldn't delete account", err)
+		}
+
+		deletedAccount, err := userService.DeleteAccount(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't delete account: %v", err)})
+		}
+		if len(deletedAccount.ChatroomIDs) > 0 {
+			messageHub.Notify <- consumer.Notification{
+				MessageData: &model.MessageData{
+					MessageOption: model.MessageDataOptionUserDeleted,
+					UserDeleted:   &model.UserDeleted{UserID: userID, ChatroomIDs: deletedAccount.ChatroomIDs},
+				},
+				ChatroomIDs: deletedAccount.ChatroomIDs,
+			}
+		}
+		if len(deletedAccount.SessionIDs) > 0 {
+			messageHub.CloseSessions <- deletedAccount.SessionIDs
+		}
+		return c.JSON(fiber.Map{"message": "Account deleted"})
+	}
+}
+
+// GetUserSettings returns the settings of the authenticated user
+// @Summary Get own settings
+// @Description Get the settings of the authenticated user
+// @Tags Users
+// @Produce json
+// @Success 200 {object} model.UserSettings
+// @Router /api/v1/users/me/settings [get]
+func GetUserSettings(userService *service.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		settings, err := userService.GetSettings(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't get settings: %v", err)})
+		}
+		return c.JSON(settings)
+	}
+}
+
+// UpdateUserSettings updates the settings of the authenticated user
+// @Summary Update own settings
+// @Description Update the settings of the authenticated user. Settings which are not specified stay unchanged.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body model.UpdateUserSettingsRequest true "Settings to update"
+// @Success 200 {object} model.UserSettings
+// @Failure 400 {object} service.ValidationError
+// @Router /api/v1/users/me/settings [patch]
+func UpdateUserSettings(userService *service.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userIDRaw := c.Locals("userID")
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "userID not found in context",
+			})
+		}
+		request := new(model.UpdateUserSettingsRequest)
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't update settings: Couldn't parse the request: %v", err)})
+		}
+		settings, err := userService.UpdateSettings(userID, *request)
+		if err != nil {
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				return validationErrorResponse(c, "Couldn't update settings", validationErr)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": fmt.Sprintf("Couldn't update settings: %v", err)})
+		}
+		return c.JSON(settings)
 	}
 }
@@ -1,11 +1,13 @@
 package api
 
 import (
-	"backend/pkg/config"
+	v1 "backend/pkg/api/v1"
 	"backend/pkg/consumer"
+	"backend/pkg/model"
 	"backend/pkg/service"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
-	"github.com/streadway/amqp"
 	"log"
 )
 
@@ -15,7 +17,7 @@ import (
 // @Tags WebSocket
 // @Success 101
 // @Router /ws [get]
-func ClientWebSocketConnectionHandler(messageHub *consumer.MessageHub, chatroomService *service.ChatroomService) func(c *websocket.Conn) {
+func ClientWebSocketConnectionHandler(messageHub *consumer.MessageHub, services *service.Services) func(c *websocket.Conn) {
 	return func(c *websocket.Conn) {
 		userIDRaw := c.Locals("userID")
 		userID, ok := userIDRaw.(uint)
@@ -23,22 +25,35 @@ func ClientWebSocketConnectionHandler(messageHub *consumer.MessageHub, chatroomS
 			log.Printf("failed to connect the client: invalid user id in the context")
 			return
 		}
-		client := &consumer.Client{Conn: c, ChatIDs: make(map[uint]bool)}
+		sessionID, ok := c.Locals("sessionID").(uint)
+		if !ok {
+			log.Printf("failed to connect the client: invalid session id in the context")
+			return
+		}
+		client := &consumer.Client{Conn: c, ChatIDs: make(map[uint]bool), SessionID: sessionID}
 		// TODO: send chatrooms to the client on connection through the websocket
 		// retrieve chatrooms that the user is subscribed to
-		chatrooms, err := chatroomService.GetChatroomsByUserId(userID, 1, 1)
+		chatroomIDs, err := services.ChatroomService.GetChatroomIDsByUserID(userID)
 		if err != nil {
 			return
 		}
-		for _, chatroom := range chatrooms {
-			client.ChatIDs[chatroom.ID] = true
+		for _, chatroomID := range chatroomIDs {
+			client.ChatIDs[chatroomID] = true
 		}
 		client.UserID = userID
+		// unverified users can receive messages but can't send anything until they confirm their email address
+		canSend, err := services.UserService.CanSendMessages(userID)
+		if err != nil {
+			log.Printf("failed to connect the client: %v", err)
+			return
+		}
 		messageHub.Register <- client
+		updateLastSeen(services.UserService, userID)
 
 		defer func() {
 			messageHub.Unregister <- client
 			c.Close()
+			updateLastSeen(services.UserService, userID)
 		}()
 
 		// Handle messages from the client WebSocket and disconnect the client on failure
@@ -55,13 +70,37 @@ func ClientWebSocketConnectionHandler(messageHub *consumer.MessageHub, chatroomS
 			}
 
 			// If it's a ping message then ignore it
+			// The session stays active while the client keeps pinging
 			if string(msg) == "PING" {
 				log.Printf("Received `PING` from client with user %v\n", client.UserID)
+				if err := services.SessionService.ValidateSession(client.SessionID, client.UserID); err != nil {
+					log.Printf("Session %v of user %v is no longer valid: %v. Disconnecting the client\n", client.SessionID, client.UserID, err)
+					return
+				}
 				continue
 			}
 
+			// The user may have confirmed the email address since connecting, so check again before rejecting the message
+			if !canSend {
+				if canSend, err = services.UserService.CanSendMessages(userID); err != nil || !canSend {
+					log.Printf("Rejected message from user %v: email is not verified\n", client.UserID)
+					_ = c.WriteJSON(fiber.Map{"message": "Email address should be verified before sending messages"})
+					continue
+				}
+			}
+
+			messageData := &model.MessageData{}
+			if err := json.Unmarshal(msg, messageData); err != nil {
+				log.Printf("Rejected invalid message from user %v: %v\n", client.UserID, err)
+				_ = c.WriteJSON(fiber.Map{"message": "Invalid message data"})
+				continue
+			}
+			// the consumer checks the permissions of the actions against the authenticated user, never a user sent by the client.
+			// User IDs in the payload which have to be the acting user, like the sender or viewer of a message, are rejected if they differ.
+			messageData.ActorID = userID
+
 			// Publish message to RabbitMQ
-			if err := PublishMessageToQueue(msg, messageHub.MessageQueueChannel); err != nil {
+			if err := v1.SendToQueue(messageData, messageHub.MessageQueueChannel); err != nil {
 				log.Printf("Error publishing message: %v\n", err)
 				continue
 			}
@@ -69,17 +108,9 @@ func ClientWebSocketConnectionHandler(messageHub *consumer.MessageHub, chatroomS
 	}
 }
 
-func PublishMessageToQueue(msg []byte, ch *amqp.Channel) error {
-	log.Printf("ChatMessage published to msg queue\n")
-	err := ch.Publish(
-		"",                           // exchange
-		config.ChatMessageRoutingKey, // routing key
-		false,                        // mandatory
-		false,                        // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        msg,
-		},
-	)
-	return err
+// updateLastSeen records that the user was online now. Failures are only logged because they must not disconnect the client.
+func updateLastSeen(userService *service.UserService, userID uint) {
+	if err := userService.UpdateLastSeen(userID); err != nil {
+		log.Printf("Couldn't update last seen of user %v: %v\n", userID, err)
+	}
 }
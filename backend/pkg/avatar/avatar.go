@@ -0,0 +1,138 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Sizes are the edge lengths in pixels of the square avatars generated from every upload
+var Sizes = []int{64, 256, 512}
+
+// MaxPixels limits the dimensions of uploaded images, so that a small file can't decode into a huge image
+const MaxPixels = 25_000_000
+
+const jpegQuality = 85
+
+var (
+	// ErrUnsupportedImage is returned when the upload is not a JPEG, PNG or GIF image
+	ErrUnsupportedImage = errors.New("unsupported image type, only JPEG, PNG and GIF images are accepted")
+	// ErrImageTooLarge is returned when the dimensions of the image exceed MaxPixels
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+var supportedContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Process validates the uploaded image, crops it to a centred square and returns a JPEG encoded version for each size.
+// The images are re-encoded from pixels, so metadata of the original (EXIF, GPS location, comments) is dropped.
+func Process(data []byte, sizes []int) (map[int][]byte, error) {
+	// the content type is sniffed from the data because the client provided type can't be trusted
+	if !supportedContentTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedImage
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 || imageConfig.Width*imageConfig.Height > MaxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	square := cropSquare(img)
+	images := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(square, size), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("couldn't encode avatar: %v", err)
+		}
+		images[size] = buf.Bytes()
+	}
+	return images, nil
+}
+
+// cropSquare returns the centred square of the image as RGBA. Transparent areas are flattened onto white because JPEG has no alpha channel.
+func cropSquare(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	edge := bounds.Dx()
+	if bounds.Dy() < edge {
+		edge = bounds.Dy()
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-edge)/2, bounds.Min.Y+(bounds.Dy()-edge)/2)
+	square := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(square, square.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(square, square.Bounds(), img, origin, draw.Over)
+	return square
+}
+
+// resize scales a square image to size x size. Every target pixel is the average of the source pixels it covers (box filter), which keeps downscaled avatars smooth.
+func resize(src *image.RGBA, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	srcSize := src.Bounds().Dx()
+	for y := 0; y < size; y++ {
+		y0, y1 := sourceSpan(y, size, srcSize)
+		for x := 0; x < size; x++ {
+			x0, x1 := sourceSpan(x, size, srcSize)
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
+
+// sourceSpan returns the range of source pixels covered by the target pixel. The range contains at least one pixel, so upscaling repeats pixels.
+func sourceSpan(target, targetSize, srcSize int) (int, int) {
+	start := target * srcSize / targetSize
+	end := (target + 1) * srcSize / targetSize
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// URLForSize returns the URL of the given size of an uploaded avatar. Other avatar URLs (external or seed data) are returned unchanged.
+func URLForSize(avatarURL string, size int) string {
+	if !strings.HasPrefix(avatarURL, URLPrefix) || !strings.HasSuffix(avatarURL, fileExtension) {
+		return avatarURL
+	}
+	base := strings.TrimSuffix(avatarURL, fileExtension)
+	separator := strings.LastIndex(base, "_")
+	if separator == -1 {
+		return avatarURL
+	}
+	if _, err := strconv.Atoi(base[separator+1:]); err != nil {
+		return avatarURL
+	}
+	return fmt.Sprintf("%v_%v%v", base[:separator], size, fileExtension)
+}
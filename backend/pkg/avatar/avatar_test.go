@@ -0,0 +1,58 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessGeneratesSquareJPEGs(t *testing.T) {
+	images, err := Process(encodePNG(t, 300, 200), Sizes)
+	assert.NoError(t, err)
+	assert.Len(t, images, len(Sizes))
+	for _, size := range Sizes {
+		img, err := jpeg.Decode(bytes.NewReader(images[size]))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, size, size), img.Bounds())
+	}
+}
+
+func TestProcessRejectsUnsupportedData(t *testing.T) {
+	_, err := Process([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), Sizes)
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+
+	// a PNG header declaring huge dimensions shouldn't be decoded
+	data := encodePNG(t, 1, 1)
+	data[16], data[17], data[18], data[19] = 0, 0, 0x4e, 0x20 // width 20000
+	data[20], data[21], data[22], data[23] = 0, 0, 0x4e, 0x20 // height 20000
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	_, err = Process(data, Sizes)
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestURLForSize(t *testing.T) {
+	assert.Equal(t, "/static/avatars/7/abc_64.jpg", URLForSize("/static/avatars/7/abc_512.jpg", 64))
+	assert.Equal(t, "avatar1.jpg", URLForSize("avatar1.jpg", 64))
+	assert.Equal(t, "https://example.com/me_512.jpg", URLForSize("https://example.com/me_512.jpg", 64))
+}
@@ -0,0 +1,75 @@
+package avatar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// URLPrefix is the URL path under which uploaded avatars are served
+const URLPrefix = "/static/avatars/"
+
+const fileExtension = ".jpg"
+
+// Storage stores the generated avatars in the static files directory
+type Storage struct {
+	// dir is the directory served under /static
+	dir string
+}
+
+func NewStorage(staticDir string) *Storage {
+	return &Storage{dir: staticDir}
+}
+
+// Save writes the avatar images of the user and returns the URL of the largest size. Every upload gets a new random name so that clients don't show cached old avatars.
+func (s *Storage) Save(userID uint, images map[int][]byte) (string, error) {
+	return s.save(fmt.Sprint(userID), images)
+}
+
+// SaveForChatroom writes the avatar images of a group chatroom and returns the URL of the largest size
+func (s *Storage) SaveForChatroom(chatroomID uint, images map[int][]byte) (string, error) {
+	return s.save(fmt.Sprintf("groups/%v", chatroomID), images)
+}
+
+// save writes the avatar images into the subdirectory of the avatars directory
+func (s *Storage) save(subdir string, images map[int][]byte) (string, error) {
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(randomBytes)
+	ownerDir := filepath.Join(s.dir, "avatars", filepath.FromSlash(subdir))
+	if err := os.MkdirAll(ownerDir, 0o755); err != nil {
+		return "", fmt.Errorf("couldn't create avatar directory: %v", err)
+	}
+
+	largestSize := 0
+	for size, data := range images {
+		path := filepath.Join(ownerDir, fmt.Sprintf("%v_%v%v", name, size, fileExtension))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return "", fmt.Errorf("couldn't write avatar: %v", err)
+		}
+		if size > largestSize {
+			largestSize = size
+		}
+	}
+	return fmt.Sprintf("%v%v/%v_%v%v", URLPrefix, subdir, name, largestSize, fileExtension), nil
+}
+
+// Remove deletes all sizes of an uploaded avatar. Other avatar URLs are ignored.
+func (s *Storage) Remove(avatarURL string) error {
+	if !strings.HasPrefix(avatarURL, URLPrefix) || strings.Contains(avatarURL, "..") {
+		return nil
+	}
+	for _, size := range Sizes {
+		relativePath := strings.TrimPrefix(URLForSize(avatarURL, size), "/static/")
+		err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(relativePath)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,3 +11,83 @@ const WebsocketChatSubProtocol = "chat-protocol"
 const JwtSecret = "my_secret_key" // TODO: generate a secret key
 
 const MessageHistoryPaginationDefaultSize = 20
+
+const EmailVerificationTokenTTLHours = 48
+
+const PasswordResetTokenTTLMinutes = 60
+
+const IdentityConfirmationTokenTTLMinutes = 15
+
+const TwoFactorIssuer = "ChatApp"
+
+const TwoFactorChallengeTokenTTLMinutes = 5
+
+const TwoFactorMaxFailedAttempts = 5
+
+const TwoFactorRecoveryCodesCount = 10
+
+const OIDCLoginStateTTLMinutes = 10
+
+const OIDCLoginStateCookieName = "oidc_login_state"
+
+const AuthTokenTTLHours = 72
+
+// SessionActivityUpdateIntervalSeconds limits how often the last activity of a session is written to the database
+const SessionActivityUpdateIntervalSeconds = 60
+
+// PasswordMaxLength is the maximum length of a password in bytes because bcrypt ignores everything after 72 bytes
+const PasswordMaxLength = 72
+
+const NicknameMinLength = 3
+
+const NicknameMaxLength = 32
+
+const GroupNameMaxLength = 100
+
+const GroupDescriptionMaxLength = 1000
+
+const GroupTopicMaxLength = 120
+
+// PinnedMessagesMaxCount is how many messages can be pinned in a chatroom at the same time
+const PinnedMessagesMaxCount = 10
+
+// ChatroomPictureAvatarSize is the avatar size used as the picture of private chatrooms in the chat list
+const ChatroomPictureAvatarSize = 64
+
+// SessionDeviceNameMaxLength is the maximum length of the device name of a session in characters. Longer names sent by the client are cut off.
+const SessionDeviceNameMaxLength = 255
+
+const UserSearchPaginationDefaultSize = 10
+
+const UserSearchPaginationMaxSize = 50
+
+// UserSearchMinTrigramTermLength is the minimum length of a search term matched anywhere in nicknames and emails. Shorter terms only match nickname prefixes.
+const UserSearchMinTrigramTermLength = 3
+
+const UserStatusTextMaxLength = 100
+
+const UserStatusEmojiMaxLength = 16
+
+// UserStatusExpiryIntervalSeconds is how often expired user statuses are cleared
+const UserStatusExpiryIntervalSeconds = 60
+
+// DataExportJobIntervalSeconds is how often pending personal data exports are processed and expired archives are removed
+const DataExportJobIntervalSeconds = 10
+
+// DataExportStaleMinutes is after how long an export still being processed is considered abandoned, e.g. because the server was restarted, and processed again
+const DataExportStaleMinutes = 30
+
+const UserDirectoryPaginationDefaultSize = 50
+
+const UserDirectoryPaginationMaxSize = 200
+
+// UserActiveWithinDays is within how many days a user must have used the app to be listed as active in the user directory
+const UserActiveWithinDays = 30
+
+const ChatroomDirectoryPaginationDefaultSize = 50
+
+const ChatroomDirectoryPaginationMaxSize = 200
+
+const ChatListPaginationDefaultSize = 30
+
+const ChatListPaginationMaxSize = 100
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetEnv returns the value of the environment variable with the given key or the fallback value if it is not set
+func GetEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvInt returns the integer value of the environment variable with the given key or the fallback value if it is not set or is not a valid integer
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvBool returns the boolean value of the environment variable with the given key or the fallback value if it is not set or is not a valid boolean
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// AppBaseURL is the public URL of the frontend. It is used to build links sent to users (e.g. in emails)
+func AppBaseURL() string {
+	return GetEnv("APP_BASE_URL", "http://localhost")
+}
+
+// ProxyHeader is the header with the client IP set by the reverse proxy. It is only read from requests of TrustedProxies.
+func ProxyHeader() string {
+	return GetEnv("PROXY_HEADER", "X-Real-IP")
+}
+
+// TrustedProxies are the comma separated IPs or CIDR ranges of the reverse proxies whose ProxyHeader is trusted. Empty trusts no proxy, so the IP of the connection is used.
+func TrustedProxies() []string {
+	proxies := []string{}
+	for _, proxy := range strings.Split(GetEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// MailDriver selects the mailer implementation: "smtp" or "file"
+func MailDriver() string {
+	return GetEnv("MAIL_DRIVER", "file")
+}
+
+// MailFrom is the sender address for outgoing emails
+func MailFrom() string {
+	return GetEnv("MAIL_FROM", "no-reply@chat-app.local")
+}
+
+// MailFileDir is the directory where the file mailer stores outgoing emails. Empty means log only
+func MailFileDir() string {
+	return GetEnv("MAIL_FILE_DIR", "")
+}
+
+// SMTPHost is the host of the SMTP server used by the smtp mailer
+func SMTPHost() string {
+	return GetEnv("SMTP_HOST", "localhost")
+}
+
+// SMTPPort is the port of the SMTP server used by the smtp mailer
+func SMTPPort() int {
+	return GetEnvInt("SMTP_PORT", 587)
+}
+
+// SMTPUsername is the username for SMTP authentication. Empty means no authentication
+func SMTPUsername() string {
+	return GetEnv("SMTP_USERNAME", "")
+}
+
+// SMTPPassword is the password for SMTP authentication
+func SMTPPassword() string {
+	return GetEnv("SMTP_PASSWORD", "")
+}
+
+// OIDCEnabled enables signing in with an OpenID Connect identity provider
+func OIDCEnabled() bool {
+	return GetEnvBool("OIDC_ENABLED", false)
+}
+
+// OIDCIssuer is the issuer URL of the OpenID Connect identity provider
+func OIDCIssuer() string {
+	return GetEnv("OIDC_ISSUER", "")
+}
+
+// OIDCClientID is the client ID of this app registered at the identity provider
+func OIDCClientID() string {
+	return GetEnv("OIDC_CLIENT_ID", "")
+}
+
+// OIDCClientSecret is the client secret of this app. Empty for public clients relying on PKCE only
+func OIDCClientSecret() string {
+	return GetEnv("OIDC_CLIENT_SECRET", "")
+}
+
+// OIDCRedirectURL is the callback URL registered at the identity provider
+func OIDCRedirectURL() string {
+	return GetEnv("OIDC_REDIRECT_URL", AppBaseURL()+"/api/v1/auth/oidc/callback")
+}
+
+// OIDCScopes are the space separated scopes requested from the identity provider
+func OIDCScopes() string {
+	return GetEnv("OIDC_SCOPES", "openid email profile")
+}
+
+// OIDCAutoProvision creates a new user on the first login of an unknown identity
+func OIDCAutoProvision() bool {
+	return GetEnvBool("OIDC_AUTO_PROVISION", false)
+}
+
+// PasswordMinLength is the minimum number of characters of a password
+func PasswordMinLength() int {
+	return GetEnvInt("PASSWORD_MIN_LENGTH", 8)
+}
+
+// PasswordMinCharacterClasses is the minimum number of character classes (lower case, upper case, digits, symbols) a password should contain
+func PasswordMinCharacterClasses() int {
+	return GetEnvInt("PASSWORD_MIN_CHARACTER_CLASSES", 2)
+}
+
+// PasswordBlocklistFile is the path of the file with breached passwords that are rejected. Empty disables the blocklist
+func PasswordBlocklistFile() string {
+	return GetEnv("PASSWORD_BLOCKLIST_FILE", "./resources/breached-passwords.txt")
+}
+
+// StaticDir is the directory of the files served under /static, including uploaded avatars
+func StaticDir() string {
+	return GetEnv("STATIC_DIR", "./static")
+}
+
+// AvatarMaxUploadBytes is the maximum size of an uploaded avatar image. Requests larger than the server's body limit (4 MB) are rejected anyway.
+func AvatarMaxUploadBytes() int {
+	return GetEnvInt("AVATAR_MAX_UPLOAD_BYTES", 2*1024*1024)
+}
+
+// DataExportDir is the directory where personal data export archives are stored until they expire
+func DataExportDir() string {
+	return GetEnv("DATA_EXPORT_DIR", "./exports")
+}
+
+// DataExportTTLHours is how long a personal data export archive can be downloaded
+func DataExportTTLHours() int {
+	return GetEnvInt("DATA_EXPORT_TTL_HOURS", 48)
+}
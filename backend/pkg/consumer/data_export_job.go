@@ -0,0 +1,38 @@
+package consumer
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"backend/pkg/service"
+	"log"
+	"time"
+)
+
+// StartDataExportJob periodically creates the archives of pending personal data exports, notifies their users and removes expired archives. It's a blocking function, so you should run it in a goroutine
+func (h *MessageHub) StartDataExportJob(dataExportService *service.DataExportService) {
+	ticker := time.NewTicker(config.DataExportJobIntervalSeconds * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := dataExportService.RemoveExpiredExports(); err != nil {
+			log.Printf("Couldn't remove expired data exports: %v\n", err)
+		}
+		for {
+			export, err := dataExportService.ProcessNextExport()
+			if err != nil {
+				log.Printf("Couldn't process data export: %v\n", err)
+				break
+			}
+			if export == nil {
+				break
+			}
+			option := model.MessageDataOptionDataExportReady
+			if export.Status != model.DataExportStatusReady {
+				option = model.MessageDataOptionDataExportFailed
+			}
+			h.Notify <- Notification{
+				MessageData: &model.MessageData{MessageOption: option, DataExport: export},
+				UserIDs:     []uint{export.UserID},
+			}
+		}
+	}
+}
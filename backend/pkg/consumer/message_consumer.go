@@ -1,6 +1,7 @@
 package consumer
 
 import (
+	"backend/pkg/avatar"
 	"backend/pkg/config"
 	"backend/pkg/model"
 	"backend/pkg/service"
@@ -14,9 +15,25 @@ import (
 
 // Client is for storing clients connections and keeping track of chats that the client is subscribed to
 type Client struct {
-	Conn    *websocket.Conn
-	ChatIDs map[uint]bool // Maps to keep track of which chat IDs the client is subscribed to
-	UserID  uint          // User ID of the client
+	Conn      *websocket.Conn
+	ChatIDs   map[uint]bool // Maps to keep track of which chat IDs the client is subscribed to
+	UserID    uint          // User ID of the client
+	SessionID uint          // ID of the login session the client connected with
+}
+
+// Notification is a messageData sent by the server to the clients subscribed to any of the chatrooms and to the clients of the users
+type Notification struct {
+	MessageData *model.MessageData
+	ChatroomIDs []uint
+	UserIDs     []uint
+	// SubscribeChatroomID subscribes the clients of UserIDs to the chatroom before the notification is sent, e.g. when the users joined it
+	SubscribeChatroomID uint
+}
+
+// PresenceRequest asks the hub which of the users have a connected client. The answer is sent to Reply.
+type PresenceRequest struct {
+	UserIDs []uint
+	Reply   chan map[uint]bool
 }
 
 // MessageHub is for managing clients connections and also publishing, consuming and broadcasting chat messages
@@ -24,6 +41,9 @@ type MessageHub struct {
 	Clients             map[*Client]bool       // Keeps track of all connected Clients
 	Register            chan *Client           // Channel for registering new clients
 	Unregister          chan *Client           // Channel for unregistering clients
+	CloseSessions       chan []uint            // Channel for disconnecting all clients of revoked sessions
+	Notify              chan Notification      // Channel for sending server notifications to clients
+	PresenceRequests    chan PresenceRequest   // Channel for querying which users are online
 	Broadcast           chan model.ChatMessage // Channel for broadcasting messages to clients
 	MessageQueueChannel *amqp.Channel          // connected RabbitMQ message channel for publishing/consuming chat messages
 }
@@ -33,11 +53,38 @@ func NewMessageHub(messageQueueChannel *amqp.Channel) *MessageHub {
 		Broadcast:           make(chan model.ChatMessage),
 		Register:            make(chan *Client),
 		Unregister:          make(chan *Client),
+		CloseSessions:       make(chan []uint),
+		Notify:              make(chan Notification),
+		PresenceRequests:    make(chan PresenceRequest),
 		Clients:             make(map[*Client]bool),
 		MessageQueueChannel: messageQueueChannel,
 	}
 }
 
+// GetOnlineUsers returns which of the users have at least one connected client. It must not be called from the goroutine of the consumer service.
+func (h *MessageHub) GetOnlineUsers(userIDs []uint) map[uint]bool {
+	reply := make(chan map[uint]bool, 1)
+	h.PresenceRequests <- PresenceRequest{UserIDs: userIDs, Reply: reply}
+	return <-reply
+}
+
+// NotifyUserUpdated sends the updated user to the participants of their chatrooms and to their own other devices. It must not be called from the goroutine of the consumer service.
+func (h *MessageHub) NotifyUserUpdated(chatroomService *service.ChatroomService, user *model.User) {
+	chatroomIDs, err := chatroomService.GetChatroomIDsByUserID(user.ID)
+	if err != nil {
+		log.Printf("Couldn't notify about profile update of user %v: %v\n", user.ID, err)
+		return
+	}
+	h.Notify <- Notification{
+		MessageData: &model.MessageData{
+			MessageOption: model.MessageDataOptionUserUpdated,
+			UserUpdated:   &model.UserUpdated{User: *user},
+		},
+		ChatroomIDs: chatroomIDs,
+		UserIDs:     []uint{user.ID},
+	}
+}
+
 type MessageHandler interface {
 	// HandleMessage handles the messageData and broadcasts it to the chatroom participants. Returns the updated messageData
 	HandleMessage(*model.MessageData, *service.ChatroomService, map[*Client]bool) (*model.MessageData, error)
@@ -49,9 +96,15 @@ type CreateGroupChatroomHandler struct{}
 type CreatePrivateChatroomHandler struct{}
 type UpdateGroupChatroomHandler struct{}
 type DeleteGroupChatroomHandler struct{}
+type UpdateParticipantRoleHandler struct{}
+type LeaveChatroomHandler struct{}
+type RemoveParticipantHandler struct{}
+type TransferChatroomOwnershipHandler struct{}
 type EditMessageHandler struct{}
 type DeleteMessageHandler struct{}
 type ReactToMessageHandler struct{}
+type PinMessageHandler struct{}
+type UnpinMessageHandler struct{}
 
 // StartMessageConsumerService Connects to message queue and consumes messages to broadcast them. It also listens for client registration/unregistration to add/delete the clients to broadcast.  It's a blocking function, so you should run it in a goroutine
 func (h *MessageHub) StartMessageConsumerService(chatroomService *service.ChatroomService) {
@@ -91,6 +144,31 @@ func (h *MessageHub) StartMessageConsumerService(chatroomService *service.Chatro
 				client.Conn.Close()
 				log.Printf("Client disconnected (user id: %v). Number of clients: %v", client.UserID, len(h.Clients))
 			}
+		case sessionIDs := <-h.CloseSessions:
+			for client := range h.Clients {
+				if exists(sessionIDs, client.SessionID) {
+					// the read loop of the client's websocket handler fails and unregisters the client
+					client.Conn.Close()
+					log.Printf("Closed connection of revoked session %v (user id: %v)", client.SessionID, client.UserID)
+				}
+			}
+		case notification := <-h.Notify:
+			for client := range h.Clients {
+				if notification.SubscribeChatroomID != 0 && exists(notification.UserIDs, client.UserID) {
+					client.ChatIDs[notification.SubscribeChatroomID] = true
+				}
+				if exists(notification.UserIDs, client.UserID) || isSubscribedToAny(client, notification.ChatroomIDs) {
+					sendMessageDataToClient(client, notification.MessageData, model.MesssageOption(notification.MessageData.MessageOption))
+				}
+			}
+		case presenceRequest := <-h.PresenceRequests:
+			online := make(map[uint]bool, len(presenceRequest.UserIDs))
+			for client := range h.Clients {
+				if exists(presenceRequest.UserIDs, client.UserID) {
+					online[client.UserID] = true
+				}
+			}
+			presenceRequest.Reply <- online
 		case d := <-msgs:
 			messageData := &model.MessageData{}
 			log.Printf("Received raw message: %s", string(d.Body))
@@ -98,6 +176,11 @@ func (h *MessageHub) StartMessageConsumerService(chatroomService *service.Chatro
 				log.Printf("Error unmarshalling message data: %v\n", err)
 				continue
 			}
+			// every action is authorized against the authenticated user who sent it, so actions without one are never handled
+			if messageData.ActorID == 0 {
+				log.Printf("Rejected message data with option %v: actorID is not specified\n", messageData.MessageOption)
+				continue
+			}
 			handler := getHandlerForMessageOption(model.MesssageOption(messageData.MessageOption))
 			if handler == nil {
 				log.Printf("No handler for message data option: %v\n", messageData.MessageOption)
@@ -120,6 +203,24 @@ func (h *SendMessageHandler) HandleMessage(messageData *model.MessageData, chatr
 	if messageData.SendMessage.ChatroomID == 0 {
 		return nil, fmt.Errorf("error sending message: chatroomID is not specified")
 	}
+	// the permissions are checked for the sender, so it must be the authenticated user
+	if err := checkActor(messageData, messageData.SendMessage.SenderID); err != nil {
+		return nil, fmt.Errorf("error sending message: %v", err)
+	}
+	canSend, err := chatroomService.CanSendMessage(messageData.SendMessage.ChatroomID, messageData.SendMessage.SenderID)
+	if err != nil {
+		return nil, fmt.Errorf("error sending message: %v", err)
+	}
+	if !canSend {
+		return nil, fmt.Errorf("error sending message: user %v is not a participant of chatroom %v or may not send messages to it", messageData.SendMessage.SenderID, messageData.SendMessage.ChatroomID)
+	}
+	blocked, err := chatroomService.IsBlockedInPrivateChatroom(messageData.SendMessage.ChatroomID, messageData.SendMessage.SenderID)
+	if err != nil {
+		return nil, fmt.Errorf("error sending message: %v", err)
+	}
+	if blocked {
+		return nil, fmt.Errorf("error sending message: the participants of the private chatroom %v blocked each other", messageData.SendMessage.ChatroomID)
+	}
 	message, err := chatroomService.AddMessageToChatroom(messageData.SendMessage.ChatroomID, model.ChatMessage{
 		SenderID:      messageData.SendMessage.SenderID,
 		Text:          messageData.SendMessage.Text,
@@ -130,9 +231,22 @@ func (h *SendMessageHandler) HandleMessage(messageData *model.MessageData, chatr
 	}
 	// append on response
 	messageData.SendMessage.ChatMessage = *message
+	muterIDs, err := chatroomService.GetMuterIDs(messageData.SendMessage.ChatroomID, messageData.SendMessage.SenderID)
+	if err != nil {
+		// the message is already stored, so it's still delivered, only without the muted flag
+		log.Printf("Error finding users who muted sender %v: %v\n", messageData.SendMessage.SenderID, err)
+	}
+	mutedMessageData := *messageData
+	mutedSendMessage := *messageData.SendMessage
+	mutedSendMessage.Muted = true
+	mutedMessageData.SendMessage = &mutedSendMessage
 	for client := range clients {
 		// If the client is a participant of the chatroom, send the messageData
 		if client.ChatIDs[messageData.SendMessage.ChatroomID] {
+			if exists(muterIDs, client.UserID) {
+				sendMessageDataToClient(client, &mutedMessageData, model.MessageDataOptionSendMessage)
+				continue
+			}
 			sendMessageDataToClient(client, messageData, model.MessageDataOptionSendMessage)
 		}
 	}
@@ -146,20 +260,39 @@ func (h *ViewMessageHandler) HandleMessage(messageData *model.MessageData, chatr
 	if messageData.ViewMessage.MessageID == 0 {
 		return nil, fmt.Errorf("error marking message as viewed: messageID is not specified")
 	}
-	if messageData.ViewMessage.ViewerID == 0 {
-		return nil, fmt.Errorf("error marking message as viewed: viewerID is not specified")
-	}
+	// the viewer is always the authenticated user, so that nobody can send read receipts for others
+	messageData.ViewMessage.ViewerID = messageData.ActorID
 	if messageData.ViewMessage.ChatroomID == 0 {
 		return nil, fmt.Errorf("error marking message as viewed: chatroomID is not specified")
 	}
-	updatedMessage, err := chatroomService.MarkMessageAsViewed(messageData.ViewMessage)
+	updatedMessage, err := chatroomService.MarkMessageAsViewed(messageData.ActorID, messageData.ViewMessage)
 	if err != nil {
 		return nil, fmt.Errorf("error marking message as viewed: %v", err)
 	}
 	messageData.ViewMessage.ChatMessage = *updatedMessage
+	isChannel, err := chatroomService.IsChannel(messageData.ViewMessage.ChatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("error marking message as viewed: %v", err)
+	}
+	if isChannel {
+		// channels have too many subscribers to send every view to all of them, so only the viewer's own devices are updated
+		for client := range clients {
+			if client.UserID == messageData.ViewMessage.ViewerID {
+				sendMessageDataToClient(client, messageData, model.MessageDataOptionViewMessage)
+			}
+		}
+		return messageData, nil
+	}
+	// read receipts are only exchanged between participants who both enabled them, but the viewer's own devices are always updated
+	withoutReadReceipts, err := chatroomService.GetParticipantIDsWithoutReadReceipts(messageData.ViewMessage.ChatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("error marking message as viewed: %v", err)
+	}
+	viewerSharesReceipts := !exists(withoutReadReceipts, messageData.ViewMessage.ViewerID)
 	for client := range clients {
+		isViewer := client.UserID == messageData.ViewMessage.ViewerID
 		// If the client is a participant of the chatroom
-		if client.ChatIDs[messageData.ViewMessage.ChatroomID] {
+		if client.ChatIDs[messageData.ViewMessage.ChatroomID] && (isViewer || (viewerSharesReceipts && !exists(withoutReadReceipts, client.UserID))) {
 			// send the messageData to the client
 			sendMessageDataToClient(client, messageData, model.MessageDataOptionViewMessage)
 		}
@@ -174,8 +307,12 @@ func (h *CreateGroupChatroomHandler) HandleMessage(messageData *model.MessageDat
 	if len(messageData.CreateGroupChatroom.Participants) == 0 {
 		return nil, fmt.Errorf("error creating group chatroom: participants should be specified")
 	}
-	participantsIDs := getUsersIDs(messageData.CreateGroupChatroom.Participants)
-	chatroom, err := chatroomService.CreateGroupChatroom(messageData.CreateGroupChatroom)
+	if messageData.ActorID == 0 {
+		return nil, fmt.Errorf("error creating group chatroom: actorID is not specified")
+	}
+	// the creator becomes the owner of the group
+	participantsIDs := append(getUsersIDs(messageData.CreateGroupChatroom.Participants), messageData.ActorID)
+	chatroom, err := chatroomService.CreateGroupChatroom(messageData.CreateGroupChatroom, messageData.ActorID)
 	if err != nil {
 		return nil, fmt.Errorf("error creating group chatroom: %v", err)
 	}
@@ -202,13 +339,36 @@ func (h *CreatePrivateChatroomHandler) HandleMessage(messageData *model.MessageD
 	if participant1.ID == 0 || participant2.ID == 0 {
 		return nil, fmt.Errorf("error creating private chatroom: both participants should be specified and have valid IDs")
 	}
+	if participant1.ID == participant2.ID {
+		return nil, fmt.Errorf("error creating private chatroom: participants should be different users")
+	}
+	// the participant, block and contacts checks are for the sender, so it must be the authenticated user
+	if err := checkActor(messageData, messageData.CreatePrivateChatroom.ChatMessage.SenderID); err != nil {
+		return nil, fmt.Errorf("error creating private chatroom: %v", err)
+	}
 	if participant1.ID != messageData.CreatePrivateChatroom.ChatMessage.SenderID && participant2.ID != messageData.CreatePrivateChatroom.ChatMessage.SenderID {
 		return nil, fmt.Errorf("error creating private chatroom: sender should be one of the participants")
 	}
 	if messageData.CreatePrivateChatroom.ChatMessage.Text == "" && messageData.CreatePrivateChatroom.ChatMessage.AttachmentURL == "" {
 		return nil, fmt.Errorf("error creating private chatroom: chat message should be specified")
 	}
-	chatroom, err := chatroomService.CreatePrivateChatroom(messageData.CreatePrivateChatroom)
+	blocked, err := chatroomService.IsBlockedBetween(participant1.ID, participant2.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating private chatroom: %v", err)
+	}
+	if blocked {
+		return nil, fmt.Errorf("error creating private chatroom: one of the participants blocked the other")
+	}
+	senderID := messageData.CreatePrivateChatroom.ChatMessage.SenderID
+	recipient := getOtherParticipant(senderID, participant1, participant2)
+	restricted, err := chatroomService.IsMessagingRestricted(recipient.ID, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating private chatroom: %v", err)
+	}
+	if restricted {
+		return nil, fmt.Errorf("error creating private chatroom: user %v only accepts private chatrooms from contacts", recipient.ID)
+	}
+	chatroom, err := chatroomService.CreatePrivateChatroom(messageData.ActorID, messageData.CreatePrivateChatroom)
 	if err != nil {
 		return nil, fmt.Errorf("error creating private chatroom: %v", err)
 	}
@@ -223,7 +383,7 @@ func (h *CreatePrivateChatroomHandler) HandleMessage(messageData *model.MessageD
 			// resolve chatroom name and picture for the client because the name and picture look different for each participant of a private (1 to 1) chatroom
 			otherParticipant := getOtherParticipant(client.UserID, participant1, participant2)
 			messageData.CreatePrivateChatroom.ChatroomName = extractUserName(otherParticipant)
-			messageData.CreatePrivateChatroom.ChatroomPictureURL = otherParticipant.AvatarURL
+			messageData.CreatePrivateChatroom.ChatroomPictureURL = avatar.URLForSize(otherParticipant.AvatarURL, config.ChatroomPictureAvatarSize)
 			sendMessageDataToClient(client, messageData, model.MessageDataOptionCreatePrivateChatroom)
 		}
 	}
@@ -232,6 +392,7 @@ func (h *CreatePrivateChatroomHandler) HandleMessage(messageData *model.MessageD
 	return messageData, nil
 }
 
+// HandleMessage changes the metadata and adds the participants of a group chatroom and broadcasts the changes as CHATROOM_UPDATED
 func (h *UpdateGroupChatroomHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
 	if messageData.UpdateGroupChatroom == nil {
 		return nil, fmt.Errorf("error updating group chatroom: UpdateGroupChatroom is not specified")
@@ -239,31 +400,130 @@ func (h *UpdateGroupChatroomHandler) HandleMessage(messageData *model.MessageDat
 	if messageData.UpdateGroupChatroom.ID == 0 {
 		return nil, fmt.Errorf("error updating group chatroom: chatroomID should be specified")
 	}
-	if messageData.UpdateGroupChatroom.GroupName == "" || len(messageData.UpdateGroupChatroom.Participants) == 0 {
+	if messageData.UpdateGroupChatroom.ChatroomChanges.IsEmpty() && len(messageData.UpdateGroupChatroom.Participants) == 0 {
 		return nil, fmt.Errorf("error updating group chatroom: nothing to update")
 	}
-	chatroom, err := chatroomService.UpdateGroupChatroom(messageData.UpdateGroupChatroom)
+	updated, err := chatroomService.UpdateGroupChatroom(messageData.ActorID, messageData.UpdateGroupChatroom)
 	if err != nil {
 		return nil, fmt.Errorf("error updating group chatroom: %v", err)
-
 	}
-	participantsIDs := getUsersIDs(messageData.UpdateGroupChatroom.Participants)
+	if updated.IsEmpty() {
+		return messageData, nil
+	}
+	updatedMessageData := &model.MessageData{
+		MessageOption:   model.MessageDataOptionChatroomUpdated,
+		ActorID:         messageData.ActorID,
+		ChatroomUpdated: updated,
+	}
 	for client := range clients {
 		// Only if the client is a participant of the chatroom, send the messageData to that client
-		if exists(participantsIDs, client.UserID) {
-			client.ChatIDs[chatroom.ID] = true
-			if err := client.Conn.WriteJSON(messageData); err != nil {
-				log.Printf("Error sending messageData to client %v with option %v: %v\n", client.UserID, model.MessageDataOptionSendMessage, err)
-				continue
-			}
+		if exists(updated.AddedParticipantIDs, client.UserID) || client.ChatIDs[updated.ChatroomID] {
+			client.ChatIDs[updated.ChatroomID] = true
+			sendMessageDataToClient(client, updatedMessageData, model.MessageDataOptionChatroomUpdated)
 		}
 	}
-	return messageData, nil
+	return updatedMessageData, nil
 }
 
 func (h *DeleteGroupChatroomHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
-	// TODO: implement chatroom deletion
-	return nil, nil
+	if messageData.DeleteGroupChatroom == nil {
+		return nil, fmt.Errorf("error deleting group chatroom: DeleteGroupChatroom is not specified")
+	}
+	chatroomID := messageData.DeleteGroupChatroom.ChatroomID
+	if chatroomID == 0 {
+		return nil, fmt.Errorf("error deleting group chatroom: chatroomID should be specified")
+	}
+	participantIDs, err := chatroomService.DeleteGroupChatroom(messageData.ActorID, chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting group chatroom: %v", err)
+	}
+	for client := range clients {
+		if client.ChatIDs[chatroomID] || exists(participantIDs, client.UserID) {
+			delete(client.ChatIDs, chatroomID)
+			sendMessageDataToClient(client, messageData, model.MessageDataOptionDeleteGroupChatroom)
+		}
+	}
+	return messageData, nil
+}
+
+func (h *LeaveChatroomHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.LeaveChatroom == nil {
+		return nil, fmt.Errorf("error leaving chatroom: LeaveChatroom is not specified")
+	}
+	if messageData.LeaveChatroom.ChatroomID == 0 {
+		return nil, fmt.Errorf("error leaving chatroom: chatroomID should be specified")
+	}
+	change, err := chatroomService.LeaveChatroom(messageData.ActorID, messageData.LeaveChatroom.ChatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("error leaving chatroom: %v", err)
+	}
+	messageData.LeaveChatroom.MembershipChange = *change
+	broadcastMembershipChange(clients, messageData, model.MessageDataOptionLeaveChatroom, messageData.LeaveChatroom.ChatroomID, messageData.ActorID)
+	return messageData, nil
+}
+
+func (h *RemoveParticipantHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.RemoveParticipant == nil {
+		return nil, fmt.Errorf("error removing participant: RemoveParticipant is not specified")
+	}
+	if messageData.RemoveParticipant.ChatroomID == 0 || messageData.RemoveParticipant.UserID == 0 {
+		return nil, fmt.Errorf("error removing participant: chatroomID and userID should be specified")
+	}
+	change, err := chatroomService.RemoveParticipant(messageData.ActorID, messageData.RemoveParticipant.ChatroomID, messageData.RemoveParticipant.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error removing participant: %v", err)
+	}
+	messageData.RemoveParticipant.MembershipChange = *change
+	broadcastMembershipChange(clients, messageData, model.MessageDataOptionRemoveParticipant, messageData.RemoveParticipant.ChatroomID, messageData.RemoveParticipant.UserID)
+	return messageData, nil
+}
+
+// broadcastMembershipChange sends the messageData to the clients subscribed to the chatroom, including those of the user who left it, and unsubscribes the user's clients
+func broadcastMembershipChange(clients map[*Client]bool, messageData *model.MessageData, option model.MesssageOption, chatroomID, removedUserID uint) {
+	for client := range clients {
+		if client.ChatIDs[chatroomID] {
+			sendMessageDataToClient(client, messageData, option)
+		}
+		if client.UserID == removedUserID {
+			delete(client.ChatIDs, chatroomID)
+		}
+	}
+}
+
+func (h *UpdateParticipantRoleHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.UpdateParticipantRole == nil {
+		return nil, fmt.Errorf("error updating participant role: UpdateParticipantRole is not specified")
+	}
+	if messageData.UpdateParticipantRole.ChatroomID == 0 || messageData.UpdateParticipantRole.UserID == 0 {
+		return nil, fmt.Errorf("error updating participant role: chatroomID and userID should be specified")
+	}
+	if err := chatroomService.UpdateParticipantRole(messageData.ActorID, messageData.UpdateParticipantRole); err != nil {
+		return nil, fmt.Errorf("error updating participant role: %v", err)
+	}
+	for client := range clients {
+		if client.ChatIDs[messageData.UpdateParticipantRole.ChatroomID] {
+			sendMessageDataToClient(client, messageData, model.MessageDataOptionUpdateParticipantRole)
+		}
+	}
+	return messageData, nil
+}
+
+func (h *TransferChatroomOwnershipHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.TransferChatroomOwnership == nil {
+		return nil, fmt.Errorf("error transferring chatroom ownership: TransferChatroomOwnership is not specified")
+	}
+	if messageData.TransferChatroomOwnership.ChatroomID == 0 || messageData.TransferChatroomOwnership.UserID == 0 {
+		return nil, fmt.Errorf("error transferring chatroom ownership: chatroomID and userID should be specified")
+	}
+	if err := chatroomService.TransferOwnership(messageData.ActorID, messageData.TransferChatroomOwnership); err != nil {
+		return nil, fmt.Errorf("error transferring chatroom ownership: %v", err)
+	}
+	for client := range clients {
+		if client.ChatIDs[messageData.TransferChatroomOwnership.ChatroomID] {
+			sendMessageDataToClient(client, messageData, model.MessageDataOptionTransferChatroomOwnership)
+		}
+	}
+	return messageData, nil
 }
 
 func (h *EditMessageHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
@@ -281,6 +541,47 @@ func (h *ReactToMessageHandler) HandleMessage(messageData *model.MessageData, ch
 	return nil, nil
 }
 
+// HandleMessage pins a message and sends the pinned message to the participants of its chatroom
+func (h *PinMessageHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.PinMessage == nil {
+		return nil, fmt.Errorf("error pinning message: PinMessage is not specified")
+	}
+	if messageData.PinMessage.ChatroomID == 0 || messageData.PinMessage.MessageID == 0 {
+		return nil, fmt.Errorf("error pinning message: chatroomID and messageID should be specified")
+	}
+	pinnedMessage, err := chatroomService.PinMessage(messageData.ActorID, messageData.PinMessage.ChatroomID, messageData.PinMessage.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("error pinning message: %v", err)
+	}
+	// append on response
+	messageData.PinMessage.PinnedMessage = pinnedMessage
+	for client := range clients {
+		if client.ChatIDs[messageData.PinMessage.ChatroomID] {
+			sendMessageDataToClient(client, messageData, model.MessageDataOptionPinMessage)
+		}
+	}
+	return messageData, nil
+}
+
+// HandleMessage unpins a message and notifies the participants of its chatroom
+func (h *UnpinMessageHandler) HandleMessage(messageData *model.MessageData, chatroomService *service.ChatroomService, clients map[*Client]bool) (*model.MessageData, error) {
+	if messageData.UnpinMessage == nil {
+		return nil, fmt.Errorf("error unpinning message: UnpinMessage is not specified")
+	}
+	if messageData.UnpinMessage.ChatroomID == 0 || messageData.UnpinMessage.MessageID == 0 {
+		return nil, fmt.Errorf("error unpinning message: chatroomID and messageID should be specified")
+	}
+	if err := chatroomService.UnpinMessage(messageData.ActorID, messageData.UnpinMessage.ChatroomID, messageData.UnpinMessage.MessageID); err != nil {
+		return nil, fmt.Errorf("error unpinning message: %v", err)
+	}
+	for client := range clients {
+		if client.ChatIDs[messageData.UnpinMessage.ChatroomID] {
+			sendMessageDataToClient(client, messageData, model.MessageDataOptionUnpinMessage)
+		}
+	}
+	return messageData, nil
+}
+
 func getHandlerForMessageOption(option model.MesssageOption) MessageHandler {
 	switch option {
 	case model.MessageDataOptionSendMessage:
@@ -293,11 +594,36 @@ func getHandlerForMessageOption(option model.MesssageOption) MessageHandler {
 		return &CreatePrivateChatroomHandler{}
 	case model.MessageDataOptionUpdateGroupChatroom:
 		return &UpdateGroupChatroomHandler{}
+	case model.MessageDataOptionDeleteGroupChatroom:
+		return &DeleteGroupChatroomHandler{}
+	case model.MessageDataOptionLeaveChatroom:
+		return &LeaveChatroomHandler{}
+	case model.MessageDataOptionRemoveParticipant:
+		return &RemoveParticipantHandler{}
+	case model.MessageDataOptionUpdateParticipantRole:
+		return &UpdateParticipantRoleHandler{}
+	case model.MessageDataOptionTransferChatroomOwnership:
+		return &TransferChatroomOwnershipHandler{}
+	case model.MessageDataOptionPinMessage:
+		return &PinMessageHandler{}
+	case model.MessageDataOptionUnpinMessage:
+		return &UnpinMessageHandler{}
 	default:
 		return nil
 	}
 }
 
+// checkActor checks that the user sent by the client is the authenticated user who sent the action
+func checkActor(messageData *model.MessageData, userID uint) error {
+	if messageData.ActorID == 0 {
+		return fmt.Errorf("actorID is not specified")
+	}
+	if userID != messageData.ActorID {
+		return fmt.Errorf("user %v is not the authenticated user %v", userID, messageData.ActorID)
+	}
+	return nil
+}
+
 func getOtherParticipant(userID uint, participant1 model.User, participant2 model.User) model.User {
 	if userID == participant1.ID {
 		return participant2
@@ -327,6 +653,15 @@ func getUsersIDs(users []model.User) []uint {
 	return ids
 }
 
+func isSubscribedToAny(client *Client, chatroomIDs []uint) bool {
+	for _, chatroomID := range chatroomIDs {
+		if client.ChatIDs[chatroomID] {
+			return true
+		}
+	}
+	return false
+}
+
 func exists(slice []uint, item uint) bool {
 	for _, i := range slice {
 		if i == item {
@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"backend/pkg/service"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSendMessageOnlyAdminsCanSend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	chatroomService := service.NewChatroomService(repository.NewChatroomRepository(db), nil, repository.NewBlockRepository(db), nil, nil)
+	handler := &SendMessageHandler{}
+
+	// A member who sends with the ID of an admin as sender is rejected before anything is checked or stored
+	_, err = handler.HandleMessage(&model.MessageData{
+		MessageOption: model.MessageDataOptionSendMessage,
+		ActorID:       5,
+		SendMessage:   &model.SendMessage{ChatMessage: model.ChatMessage{ChatroomID: 3, SenderID: 2, Text: "Hello"}},
+	}, chatroomService, map[*Client]bool{})
+	assert.ErrorContains(t, err, "is not the authenticated user")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A member who sends as themselves may not send to a group where only admins can send
+	mock.ExpectQuery("SELECT EXISTS \\( SELECT 1 FROM chatroom_participants cp INNER JOIN chatrooms c ON c.id = cp.chatroom_id (.+)\\)").
+		WithArgs(3, 5, "OWNER", "ADMIN").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err = handler.HandleMessage(&model.MessageData{
+		MessageOption: model.MessageDataOptionSendMessage,
+		ActorID:       5,
+		SendMessage:   &model.SendMessage{ChatMessage: model.ChatMessage{ChatroomID: 3, SenderID: 5, Text: "Hello"}},
+	}, chatroomService, map[*Client]bool{})
+	assert.ErrorContains(t, err, "may not send messages")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
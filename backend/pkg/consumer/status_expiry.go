@@ -0,0 +1,24 @@
+package consumer
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/service"
+	"log"
+	"time"
+)
+
+// StartStatusExpiryJob periodically clears the expired custom statuses and notifies the users who share a chatroom with their owners. It's a blocking function, so you should run it in a goroutine
+func (h *MessageHub) StartStatusExpiryJob(userService *service.UserService, chatroomService *service.ChatroomService) {
+	ticker := time.NewTicker(config.UserStatusExpiryIntervalSeconds * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		users, err := userService.ClearExpiredStatuses()
+		if err != nil {
+			log.Printf("Couldn't clear expired statuses: %v\n", err)
+			continue
+		}
+		for i := range users {
+			h.NotifyUserUpdated(chatroomService, &users[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// staticURLPrefix is the URL path under which the files of the static directory are served
+const staticURLPrefix = "/static/"
+
+// Archive writes a zip archive of JSON files and uploaded files. Entries are written one after the other, so only one JSONArrayWriter can be open at a time.
+type Archive struct {
+	zip *zip.Writer
+	// staticDir is the directory served under /static
+	staticDir string
+}
+
+func NewArchive(w io.Writer, staticDir string) *Archive {
+	return &Archive{zip: zip.NewWriter(w), staticDir: staticDir}
+}
+
+// WriteJSON adds a JSON file with the value to the archive
+func (a *Archive) WriteJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := a.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// CreateJSONArray adds a JSON file to the archive whose array items are written one by one, so that large arrays don't have to be kept in memory
+func (a *Archive) CreateJSONArray(name string) (*JSONArrayWriter, error) {
+	w, err := a.zip.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &JSONArrayWriter{w: w}, nil
+}
+
+// AddStaticFile copies a file served under /static into the archive. Returns false if the URL doesn't point to an existing file of the static directory.
+func (a *Archive) AddStaticFile(fileURL, name string) (bool, error) {
+	if !strings.HasPrefix(fileURL, staticURLPrefix) || strings.Contains(fileURL, "..") {
+		return false, nil
+	}
+	relativePath := strings.TrimPrefix(path.Clean(fileURL), staticURLPrefix)
+	file, err := os.Open(filepath.Join(a.staticDir, filepath.FromSlash(relativePath)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return false, nil
+	}
+
+	w, err := a.zip.Create(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Close finishes the archive. It doesn't close the underlying writer.
+func (a *Archive) Close() error {
+	return a.zip.Close()
+}
+
+// JSONArrayWriter writes the items of a JSON array in an archive file
+type JSONArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+// Write appends an item to the array
+func (j *JSONArrayWriter) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	separator := ",\n  "
+	if j.count == 0 {
+		separator = "\n  "
+	}
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	j.count++
+	return nil
+}
+
+// Close ends the array. It must be called before the next file is added to the archive.
+func (j *JSONArrayWriter) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
@@ -0,0 +1,68 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readArchiveFile(t *testing.T, reader *zip.Reader, name string) []byte {
+	file, err := reader.Open(name)
+	if err != nil {
+		t.Fatalf("missing archive file %v: %v", name, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("couldn't read archive file %v: %v", name, err)
+	}
+	return data
+}
+
+func TestArchive(t *testing.T) {
+	staticDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(staticDir, "files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "files", "photo.jpg"), []byte("photo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	archive := NewArchive(&buffer, staticDir)
+	assert.NoError(t, archive.WriteJSON("profile.json", map[string]string{"nickname": "jane"}))
+	empty, err := archive.CreateJSONArray("empty.json")
+	assert.NoError(t, err)
+	assert.NoError(t, empty.Close())
+	items, err := archive.CreateJSONArray("items.json")
+	assert.NoError(t, err)
+	assert.NoError(t, items.Write(map[string]int{"id": 1}))
+	assert.NoError(t, items.Write(map[string]int{"id": 2}))
+	assert.NoError(t, items.Close())
+
+	included, err := archive.AddStaticFile("/static/files/photo.jpg", "attachments/photo.jpg")
+	assert.NoError(t, err)
+	assert.True(t, included)
+	for _, url := range []string{"https://example.com/photo.jpg", "/static/files/missing.jpg", "/static/../secret.txt", "/static/files"} {
+		included, err := archive.AddStaticFile(url, "attachments/other")
+		assert.NoError(t, err)
+		assert.False(t, included, url)
+	}
+	assert.NoError(t, archive.Close())
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, reader.File, 4)
+	var emptyItems, parsedItems []map[string]int
+	assert.NoError(t, json.Unmarshal(readArchiveFile(t, reader, "empty.json"), &emptyItems))
+	assert.Empty(t, emptyItems)
+	assert.NoError(t, json.Unmarshal(readArchiveFile(t, reader, "items.json"), &parsedItems))
+	assert.Equal(t, []map[string]int{{"id": 1}, {"id": 2}}, parsedItems)
+	assert.Equal(t, "photo", string(readArchiveFile(t, reader, "attachments/photo.jpg")))
+}
@@ -0,0 +1,61 @@
+package dataexport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage stores the export archives in a directory which is not served publicly
+type Storage struct {
+	dir string
+}
+
+func NewStorage(dir string) *Storage {
+	return &Storage{dir: dir}
+}
+
+// Save writes the archive of the export with the given write function and returns its path. The archive only appears under its final name once it's complete.
+func (s *Storage) Save(exportID uint, write func(w io.Writer) error) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", fmt.Errorf("couldn't create export directory: %v", err)
+	}
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(s.dir, fmt.Sprintf("export_%v_%v.zip", exportID, hex.EncodeToString(randomBytes)))
+
+	file, err := os.CreateTemp(s.dir, "export_*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create export archive: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if err := write(file); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("couldn't write export archive: %v", err)
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return "", fmt.Errorf("couldn't write export archive: %v", err)
+	}
+	return filePath, nil
+}
+
+// Remove deletes an archive. Paths outside of the storage directory are ignored.
+func (s *Storage) Remove(filePath string) error {
+	if filePath == "" || filepath.Dir(filePath) != filepath.Clean(s.dir) || strings.Contains(filePath, "..") {
+		return nil
+	}
+	err := os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
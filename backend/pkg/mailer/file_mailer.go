@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes emails to a directory (one file per email) and to the log instead of sending them. Use it in development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+
+	mu    sync.Mutex
+	count int
+}
+
+// NewFileMailer creates a new instance of FileMailer. If dir is empty, the emails are only written to the log.
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the mail to the log and to a new file in the configured directory
+func (m *FileMailer) Send(mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	message := buildMessage(m.from, mail)
+	log.Printf("Mail to %v:\n%s\n", mail.To, message)
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	m.count++
+	fileName := fmt.Sprintf("%v-%04d.eml", time.Now().UTC().Format("20060102T150405"), m.count)
+	if err := os.WriteFile(filepath.Join(m.dir, fileName), message, 0o644); err != nil {
+		return fmt.Errorf("failed to write mail to file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailerSend(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "no-reply@example.com")
+
+	err := mailer.Send(Mail{To: "user1@example.com", Subject: "Confirm your email address", Body: "link"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(content), "To: user1@example.com\r\n"))
+	assert.True(t, strings.Contains(string(content), "Subject: Confirm your email address\r\n"))
+	assert.True(t, strings.HasSuffix(string(content), "\r\n\r\nlink"))
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"backend/pkg/config"
+	"fmt"
+)
+
+// Mail is an outgoing plain text email
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	// Send delivers the mail or returns an error if it couldn't be delivered
+	Send(mail Mail) error
+}
+
+// NewMailerFromConfig creates the mailer selected by the MAIL_DRIVER environment variable
+func NewMailerFromConfig() (Mailer, error) {
+	switch config.MailDriver() {
+	case "smtp":
+		return NewSMTPMailer(config.SMTPHost(), config.SMTPPort(), config.SMTPUsername(), config.SMTPPassword(), config.MailFrom()), nil
+	case "file":
+		return NewFileMailer(config.MailFileDir(), config.MailFrom()), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %v", config.MailDriver())
+	}
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer creates a new instance of SMTPMailer. Authentication is skipped if username is empty.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+// Send sends the mail through the configured SMTP server
+func (m *SMTPMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	addr := fmt.Sprintf("%v:%v", m.host, m.port)
+	if err := smtp.SendMail(addr, auth, m.from, []string{mail.To}, buildMessage(m.from, mail)); err != nil {
+		return fmt.Errorf("failed to send mail to %v: %v", mail.To, err)
+	}
+	return nil
+}
+
+// buildMessage builds an RFC 822 message from the mail
+func buildMessage(from string, mail Mail) []byte {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("From: %v\r\n", from))
+	sb.WriteString(fmt.Sprintf("To: %v\r\n", mail.To))
+	sb.WriteString(fmt.Sprintf("Subject: %v\r\n", mail.Subject))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(mail.Body)
+	return []byte(sb.String())
+}
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// APIKey is a long-lived credential of a bot user. It is valid only for its scopes and chatrooms. Only the hash of the key is stored.
+type APIKey struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"userID"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	ChatroomIDs []uint     `json:"chatroomIDs"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+}
+
+// HasScope checks whether the key grants the action
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsChatroom checks whether the key can be used in the chatroom
+func (k *APIKey) AllowsChatroom(chatroomID uint) bool {
+	for _, id := range k.ChatroomIDs {
+		if id == chatroomID {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// APIKeyScopeSendMessages allows sending messages to the chatrooms of the key
+	APIKeyScopeSendMessages = "messages:send"
+	// APIKeyScopeReadMessages allows reading the message history of the chatrooms of the key
+	APIKeyScopeReadMessages = "messages:read"
+	// APIKeyScopeReadChatrooms allows reading the details and participants of the chatrooms of the key
+	APIKeyScopeReadChatrooms = "chatrooms:read"
+)
+
+// APIKeyScopes are all the scopes an API key can be granted
+var APIKeyScopes = []string{APIKeyScopeSendMessages, APIKeyScopeReadMessages, APIKeyScopeReadChatrooms}
+
+type CreateBotRequest struct {
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarURL"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name        string     `json:"name"`
+	Scopes      []string   `json:"scopes"`
+	ChatroomIDs []uint     `json:"chatroomIDs"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// CreatedAPIKey is returned only once when the key is created. The key itself can't be retrieved later.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -10,3 +10,48 @@ type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+type EmailVerificationConfirmRequest struct {
+	Token string `json:"token"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// LoginResponse is returned on login. If two-factor authentication is enabled for the user, only ChallengeToken is set and the login should be completed with a TwoFactorLoginRequest.
+type LoginResponse struct {
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+// TwoFactorLoginRequest completes the login of a user with two-factor authentication enabled. Code is either a TOTP code or a recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type TwoFactorEnrolment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthURI"`
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorReauthRequest re-authenticates the user before changing two-factor settings. Code is either a TOTP code or a recovery code.
+type TwoFactorReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
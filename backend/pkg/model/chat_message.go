@@ -13,4 +13,46 @@ type ChatMessage struct {
 	Viewed        bool      `json:"viewed"`
 	Edited        bool      `json:"edited"`
 	Deleted       bool      `json:"deleted"`
+	// Kind is USER for messages written by the sender or SYSTEM for membership changes, whose sender is the acting user
+	Kind string `json:"kind"`
+	// SystemEvent is only set for SYSTEM messages
+	SystemEvent *SystemEvent `json:"systemEvent,omitempty"`
+	// Views is the number of subscribers who read the message. It's only set for messages of channels.
+	Views int `json:"views,omitempty"`
+}
+
+// Kinds of chat messages
+const (
+	ChatMessageKindUser   = "USER"
+	ChatMessageKindSystem = "SYSTEM"
+)
+
+// SystemEvent describes the membership change of a system message, so that clients can render it themselves
+type SystemEvent struct {
+	// Type is MEMBER_ADDED, MEMBER_REMOVED, MEMBER_LEFT or MEMBER_JOINED
+	Type string `json:"type"`
+	// UserID is the participant the event is about
+	UserID uint `json:"userID"`
+}
+
+// Types of system events
+const (
+	SystemEventMemberAdded   = "MEMBER_ADDED"
+	SystemEventMemberRemoved = "MEMBER_REMOVED"
+	SystemEventMemberLeft    = "MEMBER_LEFT"
+	// SystemEventMemberJoined is used when a user joined with an invite, so the sender is the user
+	SystemEventMemberJoined = "MEMBER_JOINED"
+)
+
+// SendMessageRequest is used to send a message through the REST API
+type SendMessageRequest struct {
+	Text          string `json:"text"`
+	AttachmentURL string `json:"attachmentURL"`
+}
+
+// PinnedMessage is a message pinned to its chatroom
+type PinnedMessage struct {
+	Message    ChatMessage `json:"message"`
+	PinnedByID uint        `json:"pinnedByID"`
+	PinnedAt   time.Time   `json:"pinnedAt"`
 }
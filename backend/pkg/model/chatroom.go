@@ -5,12 +5,110 @@ import (
 )
 
 type Chatroom struct {
-	ID           uint          `json:"id,omitempty"`
-	IsGroup      bool          `json:"isGroup"`
-	GroupName    string        `json:"groupName,omitempty"`
-	CreatedAt    time.Time     `json:"createdAt,omitempty"`
-	Messages     []ChatMessage `json:"messages,omitempty"`
-	Participants []User        `json:"participants,omitempty"`
+	ID          uint      `json:"id,omitempty"`
+	IsGroup     bool      `json:"isGroup"`
+	GroupName   string    `json:"groupName,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Topic       string    `json:"topic,omitempty"`
+	AvatarURL   string    `json:"avatarURL,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	// IsChannel is set for group chatrooms in which only owners and admins post and the other participants subscribe
+	IsChannel bool `json:"isChannel,omitempty"`
+	// Settings is only set for group chatrooms
+	Settings     *GroupSettings `json:"settings,omitempty"`
+	Messages     []ChatMessage  `json:"messages,omitempty"`
+	Participants []User         `json:"participants,omitempty"`
+	// SubscriberCount is the number of participants of a channel
+	SubscriberCount int `json:"subscriberCount,omitempty"`
+	// PinnedMessages are the pinned messages, newest pin first. They are only set when getting a single chatroom.
+	PinnedMessages []PinnedMessage `json:"pinnedMessages,omitempty"`
+}
+
+// GroupSettings are the settings of a group chatroom which owners and admins can change
+type GroupSettings struct {
+	// OnlyAdminsCanSend lets only owners and admins send messages
+	OnlyAdminsCanSend bool `json:"onlyAdminsCanSend"`
+	// MembersCanEditInfo lets members change the name, description, topic and avatar of the group
+	MembersCanEditInfo bool `json:"membersCanEditInfo"`
+	// MembersCanPin lets members pin and unpin messages
+	MembersCanPin bool `json:"membersCanPin"`
+	// Public lists the group in the chatroom directory where anyone can join it
+	Public bool `json:"public"`
+	// JoinRequiresApproval lets users who join from the directory only send a join request which owners and admins approve
+	JoinRequiresApproval bool `json:"joinRequiresApproval"`
+}
+
+// ChatroomChanges are changes of the metadata of a group chatroom. Only the fields which are set change.
+type ChatroomChanges struct {
+	GroupName   *string               `json:"groupName,omitempty"`
+	Description *string               `json:"description,omitempty"`
+	Topic       *string               `json:"topic,omitempty"`
+	AvatarURL   *string               `json:"avatarURL,omitempty"`
+	Settings    *GroupSettingsChanges `json:"settings,omitempty"`
+}
+
+type GroupSettingsChanges struct {
+	OnlyAdminsCanSend    *bool `json:"onlyAdminsCanSend,omitempty"`
+	MembersCanEditInfo   *bool `json:"membersCanEditInfo,omitempty"`
+	MembersCanPin        *bool `json:"membersCanPin,omitempty"`
+	Public               *bool `json:"public,omitempty"`
+	JoinRequiresApproval *bool `json:"joinRequiresApproval,omitempty"`
+}
+
+// ChangesInfo tells whether the name, description, topic or avatar change
+func (c ChatroomChanges) ChangesInfo() bool {
+	return c.GroupName != nil || c.Description != nil || c.Topic != nil || c.AvatarURL != nil
+}
+
+// IsEmpty tells whether nothing changes
+func (c ChatroomChanges) IsEmpty() bool {
+	return !c.ChangesInfo() && (c.Settings == nil || c.Settings.isEmpty())
+}
+
+// Apply applies the changes to the chatroom and returns the changes which differ from the current values
+func (c *Chatroom) Apply(changes ChatroomChanges) ChatroomChanges {
+	diff := ChatroomChanges{
+		GroupName:   applyString(&c.GroupName, changes.GroupName),
+		Description: applyString(&c.Description, changes.Description),
+		Topic:       applyString(&c.Topic, changes.Topic),
+		AvatarURL:   applyString(&c.AvatarURL, changes.AvatarURL),
+	}
+	if changes.Settings != nil {
+		if c.Settings == nil {
+			c.Settings = &GroupSettings{}
+		}
+		settingsDiff := GroupSettingsChanges{
+			OnlyAdminsCanSend:    applyBool(&c.Settings.OnlyAdminsCanSend, changes.Settings.OnlyAdminsCanSend),
+			MembersCanEditInfo:   applyBool(&c.Settings.MembersCanEditInfo, changes.Settings.MembersCanEditInfo),
+			MembersCanPin:        applyBool(&c.Settings.MembersCanPin, changes.Settings.MembersCanPin),
+			Public:               applyBool(&c.Settings.Public, changes.Settings.Public),
+			JoinRequiresApproval: applyBool(&c.Settings.JoinRequiresApproval, changes.Settings.JoinRequiresApproval),
+		}
+		if !settingsDiff.isEmpty() {
+			diff.Settings = &settingsDiff
+		}
+	}
+	return diff
+}
+
+func (c *GroupSettingsChanges) isEmpty() bool {
+	return c.OnlyAdminsCanSend == nil && c.MembersCanEditInfo == nil && c.MembersCanPin == nil && c.Public == nil && c.JoinRequiresApproval == nil
+}
+
+func applyString(current *string, change *string) *string {
+	if change == nil || *change == *current {
+		return nil
+	}
+	*current = *change
+	return change
+}
+
+func applyBool(current *bool, change *bool) *bool {
+	if change == nil || *change == *current {
+		return nil
+	}
+	*current = *change
+	return change
 }
 
 // ChatroomForUser is the model for chatrooms from the perspective of a user because same chatroom can have different data for different users
@@ -20,4 +118,74 @@ type ChatroomForUser struct {
 	ChatroomName       string `json:"chatroomName,omitempty"`
 	ChatroomPictureURL string `json:"chatroomPictureURL,omitempty"`
 	UnreadCount        int    `json:"unreadCount"`
+	// UserSettings are the settings of the chatroom which only apply to the user
+	UserSettings ChatroomUserSettings `json:"userSettings"`
+	// LastMessage is the preview of the latest message in the chat list. It is omitted for chatrooms without messages.
+	LastMessage *ChatMessage `json:"lastMessage,omitempty"`
+	// LastActivityAt is the time of the latest message or, without messages, the creation of the chatroom
+	LastActivityAt   time.Time `json:"lastActivityAt,omitempty"`
+	ParticipantCount int       `json:"participantCount,omitempty"`
+	// OtherParticipant is the participant of a private chatroom who isn't the user
+	OtherParticipant *User `json:"otherParticipant,omitempty"`
+}
+
+// ChatList is a page of the chat list of a user
+type ChatList struct {
+	Chatrooms []ChatroomForUser `json:"chatrooms"`
+	// NextCursor fetches the next page. It is omitted on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// PublicChatroom is a public group chatroom as listed in the chatroom directory
+type PublicChatroom struct {
+	ID                   uint      `json:"id"`
+	GroupName            string    `json:"groupName"`
+	Description          string    `json:"description,omitempty"`
+	Topic                string    `json:"topic,omitempty"`
+	AvatarURL            string    `json:"avatarURL,omitempty"`
+	IsChannel            bool      `json:"isChannel,omitempty"`
+	JoinRequiresApproval bool      `json:"joinRequiresApproval"`
+	MemberCount          int       `json:"memberCount"`
+	CreatedAt            time.Time `json:"createdAt"`
+}
+
+// PublicChatroomPage is a page of the chatroom directory
+type PublicChatroomPage struct {
+	Chatrooms []PublicChatroom `json:"chatrooms"`
+	// NextCursor fetches the next page. It is omitted on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ChatroomUserSettings are the settings of a chatroom which a participant changes only for themselves
+type ChatroomUserSettings struct {
+	// Archived hides the chatroom from the chat list. A new message unarchives it unless the chatroom is muted.
+	Archived bool `json:"archived"`
+	// MutedUntil is set while new messages of the chatroom don't notify the user
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	// PinnedAt is set when the chatroom is pinned to the top of the chat list
+	PinnedAt *time.Time `json:"pinnedAt,omitempty"`
+	// MarkedUnread is set when the user marked the chatroom as unread. Viewing a message of the chatroom clears it.
+	MarkedUnread bool `json:"markedUnread"`
+}
+
+// ChatroomUserSettingsChanges are changes of the settings of a chatroom for a user. Only the fields which are set change.
+type ChatroomUserSettingsChanges struct {
+	Archived *bool `json:"archived,omitempty"`
+	// MutedUntil mutes the chatroom until the given time. A time which already passed unmutes it.
+	MutedUntil   *time.Time `json:"mutedUntil,omitempty"`
+	Pinned       *bool      `json:"pinned,omitempty"`
+	MarkedUnread *bool      `json:"markedUnread,omitempty"`
+}
+
+// IsEmpty tells whether nothing changes
+func (c ChatroomUserSettingsChanges) IsEmpty() bool {
+	return c.Archived == nil && c.MutedUntil == nil && c.Pinned == nil && c.MarkedUnread == nil
+}
+
+// ChatroomFilter selects the chatrooms of the chat list of a user
+type ChatroomFilter struct {
+	// Archived lists the archived chatrooms instead of the others
+	Archived bool
+	// Unread lists only the chatrooms which have unread messages or are marked as unread
+	Unread bool
 }
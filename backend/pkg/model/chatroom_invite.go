@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+// ChatroomInvite is a link which lets users join a group chatroom. Only the hash of its token is stored.
+type ChatroomInvite struct {
+	ID          uint   `json:"id"`
+	ChatroomID  uint   `json:"chatroomID"`
+	CreatedByID uint   `json:"createdByID"`
+	Prefix      string `json:"prefix"`
+	// MaxUses is how many users can redeem the invite. It is unlimited if not set.
+	MaxUses  *int `json:"maxUses,omitempty"`
+	UseCount int  `json:"useCount"`
+	// RequiresApproval makes redeeming the invite create a join request which an admin has to approve
+	RequiresApproval bool       `json:"requiresApproval"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// CreatedChatroomInvite is returned once when the invite is created. The token can't be retrieved later.
+type CreatedChatroomInvite struct {
+	ChatroomInvite
+	Token string `json:"token"`
+}
+
+type CreateChatroomInviteRequest struct {
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	MaxUses          *int       `json:"maxUses,omitempty"`
+	RequiresApproval bool       `json:"requiresApproval"`
+}
+
+// Statuses of join requests
+const (
+	JoinRequestStatusPending  = "PENDING"
+	JoinRequestStatusApproved = "APPROVED"
+	JoinRequestStatusDeclined = "DECLINED"
+)
+
+// ChatroomJoinRequest is a request of a user to join a group chatroom, which an admin has to approve
+type ChatroomJoinRequest struct {
+	ID         uint `json:"id"`
+	ChatroomID uint `json:"chatroomID"`
+	UserID     uint `json:"userID"`
+	// InviteID is nil for requests to join a public chatroom from the directory
+	InviteID    *uint      `json:"inviteID,omitempty"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	// User is only filled when listing requests
+	User *User `json:"user,omitempty"`
+}
+
+// RedeemedChatroomInvite is the result of redeeming an invite or joining a public chatroom: either the user joined or a join request is pending
+type RedeemedChatroomInvite struct {
+	ChatroomID uint `json:"chatroomID"`
+	// Joined is set if the user became a participant
+	Joined bool `json:"joined"`
+	// JoinRequest is set if the invite or the public chatroom requires approval
+	JoinRequest *ChatroomJoinRequest `json:"joinRequest,omitempty"`
+	// SystemMessage announces the join in the chatroom
+	SystemMessage *ChatMessage `json:"systemMessage,omitempty"`
+}
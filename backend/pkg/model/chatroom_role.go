@@ -0,0 +1,59 @@
+package model
+
+// Roles of the participants of a group chatroom. Every group has exactly one owner.
+const (
+	ChatroomRoleOwner  = "OWNER"
+	ChatroomRoleAdmin  = "ADMIN"
+	ChatroomRoleMember = "MEMBER"
+)
+
+// Actions on a group chatroom which depend on the role of the acting participant
+const (
+	ChatroomPermissionRename            = "RENAME"
+	ChatroomPermissionAddMembers        = "ADD_MEMBERS"
+	ChatroomPermissionRemoveMembers     = "REMOVE_MEMBERS"
+	ChatroomPermissionDeleteGroup       = "DELETE_GROUP"
+	ChatroomPermissionPinMessages       = "PIN_MESSAGES"
+	ChatroomPermissionChangeSettings    = "CHANGE_SETTINGS"
+	ChatroomPermissionManageAdmins      = "MANAGE_ADMINS"
+	ChatroomPermissionTransferOwnership = "TRANSFER_OWNERSHIP"
+)
+
+// chatroomPermissions is the permission matrix of the roles. Members can only send messages.
+var chatroomPermissions = map[string]map[string]bool{
+	ChatroomRoleOwner: {
+		ChatroomPermissionRename:            true,
+		ChatroomPermissionAddMembers:        true,
+		ChatroomPermissionRemoveMembers:     true,
+		ChatroomPermissionDeleteGroup:       true,
+		ChatroomPermissionPinMessages:       true,
+		ChatroomPermissionChangeSettings:    true,
+		ChatroomPermissionManageAdmins:      true,
+		ChatroomPermissionTransferOwnership: true,
+	},
+	ChatroomRoleAdmin: {
+		ChatroomPermissionRename:         true,
+		ChatroomPermissionAddMembers:     true,
+		ChatroomPermissionRemoveMembers:  true,
+		ChatroomPermissionPinMessages:    true,
+		ChatroomPermissionChangeSettings: true,
+	},
+	ChatroomRoleMember: {},
+}
+
+// chatroomRoleRanks orders the roles. Participants can only remove participants of a lower rank.
+var chatroomRoleRanks = map[string]int{
+	ChatroomRoleMember: 1,
+	ChatroomRoleAdmin:  2,
+	ChatroomRoleOwner:  3,
+}
+
+// HasChatroomPermission checks whether a participant with the role may do the action
+func HasChatroomPermission(role, permission string) bool {
+	return chatroomPermissions[role][permission]
+}
+
+// OutranksChatroomRole checks whether the role is higher than the other role
+func OutranksChatroomRole(role, other string) bool {
+	return chatroomRoleRanks[role] > chatroomRoleRanks[other]
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// Statuses of contact requests
+const (
+	ContactRequestStatusPending   = "PENDING"
+	ContactRequestStatusAccepted  = "ACCEPTED"
+	ContactRequestStatusDeclined  = "DECLINED"
+	ContactRequestStatusCancelled = "CANCELLED"
+)
+
+// ContactRequest is a request of the sender to become a contact of the recipient
+type ContactRequest struct {
+	ID          uint       `json:"id"`
+	SenderID    uint       `json:"senderID"`
+	RecipientID uint       `json:"recipientID"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	// Sender and Recipient are only filled when listing requests
+	Sender    *User `json:"sender,omitempty"`
+	Recipient *User `json:"recipient,omitempty"`
+}
+
+// Contact is a user in the contacts of another user
+type Contact struct {
+	User
+	// Online tells whether the contact has a connected client
+	Online bool `json:"online"`
+	// ContactSince is when the contact request was accepted
+	ContactSince time.Time `json:"contactSince"`
+}
+
+// SendContactRequestRequest is used to send a contact request
+type SendContactRequestRequest struct {
+	UserID uint `json:"userID"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Statuses of personal data exports
+const (
+	DataExportStatusPending    = "PENDING"
+	DataExportStatusProcessing = "PROCESSING"
+	DataExportStatusReady      = "READY"
+	DataExportStatusFailed     = "FAILED"
+	DataExportStatusExpired    = "EXPIRED"
+)
+
+// DataExport is a request of a user for an archive of their personal data
+type DataExport struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"userID"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// ExpiresAt is when the archive of a READY export is removed
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ChatroomMembership is a chatroom the user participates in, as included in personal data exports
+type ChatroomMembership struct {
+	ChatroomID  uint      `json:"chatroomID"`
+	IsGroup     bool      `json:"isGroup"`
+	GroupName   string    `json:"groupName,omitempty"`
+	UnreadCount int       `json:"unreadCount"`
+	CreatedAt   time.Time `json:"chatroomCreatedAt"`
+}
+
+// MessageView is a message viewed by the user, as included in personal data exports
+type MessageView struct {
+	MessageID  uint      `json:"messageID"`
+	ChatroomID uint      `json:"chatroomID"`
+	ViewedAt   time.Time `json:"viewedAt"`
+}
+
+// ExportedAttachment is an attachment of a message sent by the user. ArchivePath is set if the file is included in the archive.
+type ExportedAttachment struct {
+	MessageID     uint   `json:"messageID"`
+	AttachmentURL string `json:"attachmentURL"`
+	ArchivePath   string `json:"archivePath,omitempty"`
+}
@@ -4,13 +4,25 @@ package model
 type MessageData struct {
 	// new implementation
 	MessageOption string `json:"messageOption,omitempty"`
+	// ActorID is the user who sent the action. It is set by the server, a value sent by the client is overwritten.
+	ActorID uint `json:"actorID,omitempty"`
 	// chatroom actions:
 	// CreateGroupChatroom is used to create a group chatroom
 	CreateGroupChatroom *CreateGroupChatroom `json:"createGroupChatroom,omitempty"`
 	// UpdateGroupChatroom is used to update a group chatroom
 	UpdateGroupChatroom *UpdateGroupChatroom `json:"updateGroupChatroom,omitempty"`
+	// ChatroomUpdated notifies the participants about the changed metadata and participants of a group chatroom (only sent by the server)
+	ChatroomUpdated *ChatroomUpdated `json:"chatroomUpdated,omitempty"`
 	// DeleteGroupChatroom is used to delete a group chatroom
 	DeleteGroupChatroom *DeleteGroupChatroom `json:"deleteGroupChatroom,omitempty"`
+	// UpdateParticipantRole is used to promote a participant of a group chatroom to admin or to demote an admin
+	UpdateParticipantRole *UpdateParticipantRole `json:"updateParticipantRole,omitempty"`
+	// TransferChatroomOwnership is used by the owner of a group chatroom to make another participant the owner
+	TransferChatroomOwnership *TransferChatroomOwnership `json:"transferChatroomOwnership,omitempty"`
+	// LeaveChatroom is used to leave a group chatroom
+	LeaveChatroom *LeaveChatroom `json:"leaveChatroom,omitempty"`
+	// RemoveParticipant is used to remove a participant from a group chatroom
+	RemoveParticipant *RemoveParticipant `json:"removeParticipant,omitempty"`
 	// CreatePrivateChatroom is used to create a private 1-to-1 chatroom
 	CreatePrivateChatroom *CreatePrivateChatroom `json:"createPrivateChatroom,omitempty"`
 	// message actions:
@@ -24,15 +36,37 @@ type MessageData struct {
 	DeleteMessage *DeleteMessage `json:"deleteMessage,omitempty"`
 	// ReactToMessage is used to react to a message
 	ReactToMessage *ReactToMessage `json:"reactToMessage,omitempty"`
+	// PinMessage is used to pin a message to its chatroom
+	PinMessage *PinMessage `json:"pinMessage,omitempty"`
+	// UnpinMessage is used to unpin a pinned message
+	UnpinMessage *UnpinMessage `json:"unpinMessage,omitempty"`
+	// user notifications (only sent by the server):
+	// UserUpdated notifies that a user changed their profile
+	UserUpdated *UserUpdated `json:"userUpdated,omitempty"`
+	// UserDeleted notifies that a user deleted their account
+	UserDeleted *UserDeleted `json:"userDeleted,omitempty"`
+	// ContactRequest notifies the sender and the recipient about a new or answered contact request
+	ContactRequest *ContactRequest `json:"contactRequest,omitempty"`
+	// ParticipantJoined notifies the participants of a group chatroom and the new participant that a user joined with an invite
+	ParticipantJoined *ParticipantJoined `json:"participantJoined,omitempty"`
+	// JoinRequest notifies the owners and admins of a group chatroom about a new join request, and them and the user that the request was declined
+	JoinRequest *ChatroomJoinRequest `json:"joinRequest,omitempty"`
+	// ChatroomUserSettingsUpdated syncs the changed settings of a chatroom to the other devices of the user
+	ChatroomUserSettingsUpdated *ChatroomUserSettingsUpdated `json:"chatroomUserSettingsUpdated,omitempty"`
+	// DataExport notifies the user that their personal data export has finished
+	DataExport *DataExport `json:"dataExport,omitempty"`
 }
 
 // TODO: currently we are using MessageData for both listening for actions and broadcasting. Instead use MessageData only for actions (requests from client to server) and implement a separate struct for broadcasting notifications (response from server to clients)
 
 type SendMessage struct {
 	ChatMessage
+	// Muted is set on response for the recipients who muted the sender or the chatroom, so that their clients don't notify about the message
+	Muted bool `json:"muted,omitempty"`
 }
 
 type ViewMessage struct {
+	// ViewerID is set by the server to the authenticated user, a value sent by the client is overwritten
 	ViewerID   uint `json:"viewerID,omitempty"`
 	MessageID  uint `json:"messageID,omitempty"`
 	ChatroomID uint `json:"chatroomID,omitempty"`
@@ -54,6 +88,23 @@ type ReactToMessage struct {
 	Reaction  string `json:"reaction,omitempty"` // TODO: Implement reactions
 }
 
+type PinMessage struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	MessageID  uint `json:"messageID,omitempty"`
+	// append on response:
+	PinnedMessage *PinnedMessage `json:"pinnedMessage,omitempty"`
+}
+
+type UnpinMessage struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	MessageID  uint `json:"messageID,omitempty"`
+}
+
+type ChatroomUserSettingsUpdated struct {
+	ChatroomID uint                 `json:"chatroomID,omitempty"`
+	Settings   ChatroomUserSettings `json:"settings"`
+}
+
 type CreatePrivateChatroom struct {
 	// Participants is a list of user IDs of the participants in the private chatroom (should be exactly 2 participants)
 	Participants [2]User `json:"participants,omitempty"`
@@ -61,6 +112,8 @@ type CreatePrivateChatroom struct {
 	ChatMessage ChatMessage `json:"chatMessage,omitempty"`
 	// append on response:
 	ChatroomForUser
+	// Existing is set if the users already had a private chatroom. The message was added to it instead of creating another one.
+	Existing bool `json:"existing,omitempty"`
 }
 
 type CreateGroupChatroom struct {
@@ -68,13 +121,82 @@ type CreateGroupChatroom struct {
 }
 
 type UpdateGroupChatroom struct {
-	Chatroom
+	ID uint `json:"id,omitempty"`
+	// ChatroomChanges are the metadata to change. Fields which are not set keep their value.
+	ChatroomChanges
+	// Participants are added to the chatroom
+	Participants []User `json:"participants,omitempty"`
+}
+
+// ChatroomUpdated notifies the participants about the changes of a group chatroom
+type ChatroomUpdated struct {
+	ChatroomID uint `json:"chatroomID"`
+	// Changes contains only the metadata whose value actually changed
+	Changes ChatroomChanges `json:"changes"`
+	// AddedParticipantIDs are the users who were added to the chatroom
+	AddedParticipantIDs []uint `json:"addedParticipantIDs,omitempty"`
+	// SystemMessages announce the added participants
+	SystemMessages []ChatMessage `json:"systemMessages,omitempty"`
+}
+
+// IsEmpty tells whether the update didn't change anything
+func (u *ChatroomUpdated) IsEmpty() bool {
+	return u.Changes.IsEmpty() && len(u.AddedParticipantIDs) == 0
 }
 
 type DeleteGroupChatroom struct {
 	ChatroomID uint `json:"chatroomID,omitempty"`
 }
 
+type UpdateParticipantRole struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	UserID     uint `json:"userID,omitempty"`
+	// Role is the new role of the participant: ADMIN or MEMBER
+	Role string `json:"role,omitempty"`
+}
+
+type TransferChatroomOwnership struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	// UserID is the participant who becomes the owner. The previous owner becomes an admin.
+	UserID uint `json:"userID,omitempty"`
+}
+
+type LeaveChatroom struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	// append on response:
+	MembershipChange
+}
+
+type RemoveParticipant struct {
+	ChatroomID uint `json:"chatroomID,omitempty"`
+	UserID     uint `json:"userID,omitempty"`
+	// append on response:
+	MembershipChange
+}
+
+// MembershipChange is the result of a participant leaving or being removed from a group chatroom
+type MembershipChange struct {
+	// SystemMessage is the system message about the change. It is not set if the chatroom was deleted because its last participant left.
+	SystemMessage *ChatMessage `json:"systemMessage,omitempty"`
+	// NewOwnerID is set if the owner left and another participant became the owner
+	NewOwnerID uint `json:"newOwnerID,omitempty"`
+}
+
+type ParticipantJoined struct {
+	ChatroomID    uint        `json:"chatroomID"`
+	UserID        uint        `json:"userID"`
+	SystemMessage ChatMessage `json:"systemMessage"`
+}
+
+type UserUpdated struct {
+	User User `json:"user"`
+}
+
+type UserDeleted struct {
+	UserID      uint   `json:"userID"`
+	ChatroomIDs []uint `json:"chatroomIDs"`
+}
+
 type MesssageOption string
 
 const (
@@ -88,6 +210,10 @@ const (
 	MessageDataOptionDeleteMessage = "DELETE_MESSAGE"
 	// MessageDataOptionReactToMessage is used to react to a message
 	MessageDataOptionReactToMessage = "REACT_TO_MESSAGE"
+	// MessageDataOptionPinMessage is used to pin a message to its chatroom
+	MessageDataOptionPinMessage = "PIN_MESSAGE"
+	// MessageDataOptionUnpinMessage is used to unpin a pinned message
+	MessageDataOptionUnpinMessage = "UNPIN_MESSAGE"
 	// MessageDataOptionCreatePrivateChatroom is used to create a private chatroom
 	MessageDataOptionCreatePrivateChatroom = "CREATE_PRIVATE_CHATROOM"
 	MessageDataOptionUpdatePrivateChatroom = "UPDATE_PRIVATE_CHATROOM"
@@ -95,6 +221,40 @@ const (
 	MessageDataOptionCreateGroupChatroom = "CREATE_GROUP_CHATROOM"
 	// MessageDataOptionUpdateGroupChatroom is used to update a group chatroom
 	MessageDataOptionUpdateGroupChatroom = "UPDATE_GROUP_CHATROOM"
+	// MessageDataOptionChatroomUpdated is sent by the server when the metadata or the participants of a group chatroom changed
+	MessageDataOptionChatroomUpdated = "CHATROOM_UPDATED"
 	// MessageDataOptionDeleteGroupChatroom is used to delete a group chatroom
 	MessageDataOptionDeleteGroupChatroom = "DELETE_GROUP_CHATROOM"
+	// MessageDataOptionUpdateParticipantRole is used to promote or demote a participant of a group chatroom
+	MessageDataOptionUpdateParticipantRole = "UPDATE_PARTICIPANT_ROLE"
+	// MessageDataOptionTransferChatroomOwnership is used to transfer the ownership of a group chatroom
+	MessageDataOptionTransferChatroomOwnership = "TRANSFER_CHATROOM_OWNERSHIP"
+	// MessageDataOptionLeaveChatroom is used to leave a group chatroom
+	MessageDataOptionLeaveChatroom = "LEAVE_CHATROOM"
+	// MessageDataOptionRemoveParticipant is used to remove a participant from a group chatroom
+	MessageDataOptionRemoveParticipant = "REMOVE_PARTICIPANT"
+	// MessageDataOptionParticipantJoined is sent by the server when a user joined a group chatroom with an invite
+	MessageDataOptionParticipantJoined = "PARTICIPANT_JOINED"
+	// MessageDataOptionJoinRequestCreated is sent by the server to the owners and admins of a group chatroom when a user requests to join it
+	MessageDataOptionJoinRequestCreated = "JOIN_REQUEST_CREATED"
+	// MessageDataOptionJoinRequestDeclined is sent by the server when a request to join a group chatroom is declined
+	MessageDataOptionJoinRequestDeclined = "JOIN_REQUEST_DECLINED"
+	// MessageDataOptionUserUpdated is sent by the server when a user changes their profile
+	MessageDataOptionUserUpdated = "USER_UPDATED"
+	// MessageDataOptionUserDeleted is sent by the server when a user deletes their account
+	MessageDataOptionUserDeleted = "USER_DELETED"
+	// MessageDataOptionContactRequestSent is sent by the server when a contact request is sent
+	MessageDataOptionContactRequestSent = "CONTACT_REQUEST_SENT"
+	// MessageDataOptionContactRequestAccepted is sent by the server when a contact request is accepted
+	MessageDataOptionContactRequestAccepted = "CONTACT_REQUEST_ACCEPTED"
+	// MessageDataOptionContactRequestDeclined is sent by the server when a contact request is declined
+	MessageDataOptionContactRequestDeclined = "CONTACT_REQUEST_DECLINED"
+	// MessageDataOptionContactRequestCancelled is sent by the server when a contact request is cancelled by its sender
+	MessageDataOptionContactRequestCancelled = "CONTACT_REQUEST_CANCELLED"
+	// MessageDataOptionChatroomUserSettingsUpdated is sent by the server to the devices of a user who changed their settings of a chatroom
+	MessageDataOptionChatroomUserSettingsUpdated = "CHATROOM_USER_SETTINGS_UPDATED"
+	// MessageDataOptionDataExportReady is sent by the server when a personal data export can be downloaded
+	MessageDataOptionDataExportReady = "DATA_EXPORT_READY"
+	// MessageDataOptionDataExportFailed is sent by the server when a personal data export couldn't be created
+	MessageDataOptionDataExportFailed = "DATA_EXPORT_FAILED"
 )
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Session is created on every login and represents a device where the user is logged in
+type Session struct {
+	ID           uint      `json:"id"`
+	UserID       uint      `json:"userID"`
+	DeviceName   string    `json:"deviceName"`
+	UserAgent    string    `json:"userAgent"`
+	IPAddress    string    `json:"ipAddress"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	// Current is true for the session of the request
+	Current bool `json:"current"`
+}
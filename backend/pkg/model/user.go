@@ -5,10 +5,127 @@ import (
 )
 
 type User struct {
-	ID           uint      `json:"id"`
-	Nickname     string    `json:"nickname"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // omit in serialisation
-	AvatarURL    string    `json:"avatarURL"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID               uint      `json:"id"`
+	Nickname         string    `json:"nickname"`
+	Email            string    `json:"email"`
+	PasswordHash     string    `json:"-"` // omit in serialisation
+	AvatarURL        string    `json:"avatarURL"`
+	EmailVerified    bool      `json:"emailVerified"`
+	TwoFactorEnabled bool      `json:"twoFactorEnabled"`
+	IsBot            bool      `json:"isBot"`
+	CreatedAt        time.Time `json:"createdAt"`
+	// Status is the custom status of the user. It is omitted if the user has no status or it has expired.
+	Status *UserStatus `json:"status,omitempty"`
+	// LastSeenAt is when the user was last online. It is only set where the privacy settings of both users allow it.
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	// Role is the role of the user in a group chatroom. It is only set for the participants of a group chatroom.
+	Role string `json:"role,omitempty"`
+}
+
+// UserStatus is a custom status set by the user, like "In a meeting"
+type UserStatus struct {
+	Emoji string `json:"emoji,omitempty"`
+	Text  string `json:"text,omitempty"`
+	// ExpiresAt is when the status is cleared. The status is kept until it is changed if not set.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// NewUserStatus returns the status with the given fields or nil if the status is empty or has expired
+func NewUserStatus(emoji, text string, expiresAt *time.Time) *UserStatus {
+	if emoji == "" && text == "" {
+		return nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil
+	}
+	return &UserStatus{Emoji: emoji, Text: text, ExpiresAt: expiresAt}
+}
+
+// UpdateProfileRequest is used to update the profile of the authenticated user. Only the specified fields are updated.
+type UpdateProfileRequest struct {
+	Nickname  *string `json:"nickname,omitempty"`
+	AvatarURL *string `json:"avatarURL,omitempty"`
+}
+
+// SetUserStatusRequest is used to set the custom status of the authenticated user
+type SetUserStatusRequest struct {
+	Emoji     string     `json:"emoji"`
+	Text      string     `json:"text"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ChangePasswordRequest is used to change the password of the authenticated user. Users without a password set one with a ConfirmationToken instead of the current password.
+type ChangePasswordRequest struct {
+	CurrentPassword   string `json:"currentPassword,omitempty"`
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+	NewPassword       string `json:"newPassword"`
+}
+
+// DeleteAccountRequest is used to delete the account of the authenticated user. Code is required if two-factor authentication is enabled.
+// Users without a password send a ConfirmationToken instead.
+type DeleteAccountRequest struct {
+	Password          string `json:"password,omitempty"`
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+	Code              string `json:"code,omitempty"`
+}
+
+// DeletedAccount describes what was affected by an account deletion
+type DeletedAccount struct {
+	// ChatroomIDs are the chatrooms the user was removed from
+	ChatroomIDs []uint
+	// SessionIDs are the revoked sessions of the user
+	SessionIDs []uint
+}
+
+// DeletedUserNickname is the nickname of anonymised accounts
+const DeletedUserNickname = "Deleted user"
+
+// UserSettings are the preferences of a user
+type UserSettings struct {
+	// OnlyContactsCanMessage prevents users who aren't contacts from starting a private chatroom with the user
+	OnlyContactsCanMessage bool `json:"onlyContactsCanMessage"`
+	// ReadReceipts tells the senders when the user viewed their messages. Users who disable read receipts don't see the read receipts of others either.
+	ReadReceipts bool `json:"readReceipts"`
+	// LastSeenVisibility is who can see when the user was last online: EVERYONE, CONTACTS or NOBODY. Users only see the last seen time of those who could see theirs.
+	LastSeenVisibility string `json:"lastSeenVisibility"`
+}
+
+// Who can see the last seen time of a user
+const (
+	LastSeenVisibilityEveryone = "EVERYONE"
+	LastSeenVisibilityContacts = "CONTACTS"
+	LastSeenVisibilityNobody   = "NOBODY"
+)
+
+// UpdateUserSettingsRequest is used to update the settings of the authenticated user. Only the specified fields are updated.
+type UpdateUserSettingsRequest struct {
+	OnlyContactsCanMessage *bool   `json:"onlyContactsCanMessage,omitempty"`
+	ReadReceipts           *bool   `json:"readReceipts,omitempty"`
+	LastSeenVisibility     *string `json:"lastSeenVisibility,omitempty"`
+}
+
+// UserPage is a page of users, e.g. search results or directory entries
+type UserPage struct {
+	Users []User `json:"users"`
+	// NextCursor fetches the next page. It is omitted on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Sort orders of the user directory
+const (
+	UserDirectorySortNickname  = "nickname"
+	UserDirectorySortCreatedAt = "createdAt"
+)
+
+// UserDirectoryFilter selects and orders the users of the user directory. Filters which are nil are not applied.
+type UserDirectoryFilter struct {
+	// Sort is UserDirectorySortNickname (case-insensitive) or UserDirectorySortCreatedAt
+	Sort       string
+	Descending bool
+	// CreatedSince only includes users who registered at or after the time
+	CreatedSince *time.Time
+	HasAvatar    *bool
+	IsBot        *bool
+	// IsActive only includes users who used the app within the last config.UserActiveWithinDays days (true) or who didn't (false)
+	IsActive *bool
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"userID"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// UserToken is a one-time token sent to a user (e.g. by email) to confirm an action. Only the hash of the token is stored.
+type UserToken struct {
+	ID        uint
+	UserID    uint
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+const (
+	// UserTokenPurposeEmailVerification is used for tokens confirming the user's email address
+	UserTokenPurposeEmailVerification = "EMAIL_VERIFICATION"
+	// UserTokenPurposePasswordReset is used for tokens allowing to set a new password
+	UserTokenPurposePasswordReset = "PASSWORD_RESET"
+	// UserTokenPurposeIdentityConfirmation is used for tokens confirming the identity of users without a password, e.g. who signed up with OIDC
+	UserTokenPurposeIdentityConfirmation = "IDENTITY_CONFIRMATION"
+)
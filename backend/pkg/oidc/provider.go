@@ -0,0 +1,284 @@
+// Package oidc implements the OpenID Connect authorization code flow with PKCE for signing in with an external identity provider.
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Config contains the settings of the identity provider and of this app as its client
+type Config struct {
+	// Issuer is the issuer URL of the provider. The discovery document is fetched from {Issuer}/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL of this app registered at the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// Claims are the claims of a verified ID token that are used to link and provision users
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Picture           string
+}
+
+// Provider talks to an OpenID Connect identity provider. Provider metadata and signing keys are fetched lazily and cached.
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // some providers send it as a string
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+	Picture           string      `json:"picture"`
+}
+
+// NewProvider creates a new instance of Provider. If httpClient is nil, a client with a default timeout is used.
+func NewProvider(config Config, httpClient *http.Client) *Provider {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, httpClient: httpClient}
+}
+
+// Issuer returns the issuer URL of the provider. It identifies the provider of linked identities.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// AuthCodeURL returns the URL of the provider's login page the user should be redirected to
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	md, err := p.getMetadata()
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return md.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange exchanges the authorization code for tokens and returns the verified claims of the ID token
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (*Claims, error) {
+	md, err := p.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	request, err := http.NewRequest(http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %v", err)
+	}
+	defer response.Body.Close()
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("failed to exchange authorization code: %v %v (status %v)", tokens.Error, tokens.ErrorDescription, response.StatusCode)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response doesn't contain an id token")
+	}
+	return p.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+// VerifyIDToken verifies the signature, issuer, audience, expiry and nonce of the ID token and returns its claims
+func (p *Provider) VerifyIDToken(rawIDToken, nonce string) (*Claims, error) {
+	md, err := p.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	_, err = parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(md.JwksURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+	if !claims.VerifyIssuer(md.Issuer, true) {
+		return nil, fmt.Errorf("invalid id token: unexpected issuer %v", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, fmt.Errorf("invalid id token: unexpected audience %v", claims.Audience)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("invalid id token: expiry is missing")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid id token: subject is missing")
+	}
+	return &Claims{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+		Picture:           claims.Picture,
+	}, nil
+}
+
+// getMetadata returns the cached discovery document or fetches it
+func (p *Provider) getMetadata() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	md := &metadata{}
+	if err := p.getJSON(p.config.Issuer+"/.well-known/openid-configuration", md); err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %v", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("failed to discover provider: issuer %v doesn't match the configured issuer %v", md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JwksURI == "" {
+		return nil, fmt.Errorf("failed to discover provider: incomplete discovery document")
+	}
+	p.metadata = md
+	return md, nil
+}
+
+// getKey returns the signing key with the given key ID. The key set is refetched when the key is unknown, so that key rotation is picked up.
+func (p *Provider) getKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(jwksURI, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// a token without key ID can only be verified if the provider publishes a single key
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %v", kid)
+}
+
+func (p *Provider) getJSON(url string, target interface{}) error {
+	response, err := p.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v from %v", response.StatusCode, url)
+	}
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus of key %v: %v", jwk.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent of key %v: %v", jwk.Kid, err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
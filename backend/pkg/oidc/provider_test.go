@@ -0,0 +1,160 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIssuer is a minimal local OpenID Connect provider that issues ID tokens for a single authorization code
+type mockIssuer struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	code          string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		clientID, clientSecret, _ := r.BasicAuth()
+		if r.Form.Get("code") != m.code || CodeChallenge(r.Form.Get("code_verifier")) != m.codeChallenge || clientID != "chat-app" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test-key"
+		idToken, _ := token.SignedString(m.key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": idToken, "token_type": "Bearer"})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func newTestProvider(m *mockIssuer) *Provider {
+	return NewProvider(Config{
+		Issuer:       m.server.URL,
+		ClientID:     "chat-app",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/v1/auth/oidc/callback",
+	}, m.server.Client())
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := newTestProvider(m)
+
+	verifier, err := GenerateRandomString()
+	assert.NoError(t, err)
+	authURL, err := provider.AuthCodeURL("state", "nonce", CodeChallenge(verifier))
+	assert.NoError(t, err)
+	parsedURL, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/authorize", parsedURL.Path)
+	assert.Equal(t, "S256", parsedURL.Query().Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", parsedURL.Query().Get("scope"))
+
+	// the provider remembers the challenge and redirects back with a code
+	m.code = "code"
+	m.codeChallenge = parsedURL.Query().Get("code_challenge")
+	m.claims = jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "chat-app",
+		"sub":            "employee-42",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "employee@example.com",
+		"email_verified": true,
+		"name":           "Employee",
+	}
+
+	claims, err := provider.Exchange("code", verifier, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, "employee-42", claims.Subject)
+	assert.Equal(t, "employee@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "Employee", claims.Name)
+
+	// a wrong code verifier is rejected by the provider
+	_, err = provider.Exchange("code", "other-verifier", "nonce")
+	assert.Error(t, err)
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := newTestProvider(m)
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(m.key)
+		return signed
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"iss": m.server.URL, "aud": "chat-app", "sub": "employee-42", "exp": time.Now().Add(time.Minute).Unix(), "nonce": "nonce"}
+	}
+
+	_, err := provider.VerifyIDToken(sign(valid()), "nonce")
+	assert.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(sign(valid()), "other-nonce")
+	assert.Error(t, err)
+
+	claims := valid()
+	claims["aud"] = "other-client"
+	_, err = provider.VerifyIDToken(sign(claims), "nonce")
+	assert.Error(t, err)
+
+	claims = valid()
+	claims["iss"] = "https://evil.example.com"
+	_, err = provider.VerifyIDToken(sign(claims), "nonce")
+	assert.Error(t, err)
+
+	claims = valid()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = provider.VerifyIDToken(sign(claims), "nonce")
+	assert.Error(t, err)
+
+	// tokens signed with a shared secret instead of the provider's key are rejected
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("secret"))
+	_, err = provider.VerifyIDToken(hmacToken, "nonce")
+	assert.Error(t, err)
+}
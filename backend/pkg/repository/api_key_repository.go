@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	_ "github.com/lib/pq"
+)
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository with the given database connection.
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// CreateAPIKey stores a new API key with the given hash and returns it
+func (r *APIKeyRepository) CreateAPIKey(apiKey model.APIKey, keyHash string) (*model.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, chatroom_ids, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, user_id, name, key_prefix, scopes, chatroom_ids, created_at, last_used_at, expires_at, revoked_at
+	`
+	row := r.db.QueryRow(query, apiKey.UserID, apiKey.Name, apiKey.Prefix, keyHash, pq.Array(apiKey.Scopes), pq.Array(toInt64s(apiKey.ChatroomIDs)), apiKey.ExpiresAt)
+	newKey, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %v", err)
+	}
+	return newKey, nil
+}
+
+// FindActiveAPIKeyByHash finds a key that is neither revoked nor expired by its hash. Returns nil if there is no such key.
+func (r *APIKeyRepository) FindActiveAPIKeyByHash(keyHash string) (*model.APIKey, error) {
+	query := `
+		SELECT k.id, k.user_id, k.name, k.key_prefix, k.scopes, k.chatroom_ids, k.created_at, k.last_used_at, k.expires_at, k.revoked_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW()) AND u.is_bot = TRUE
+	`
+	apiKey, err := scanAPIKey(r.db.QueryRow(query, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find api key: %v", err)
+	}
+	return apiKey, nil
+}
+
+// FindAPIKeysByUserID returns all keys of the bot including revoked ones, newest first
+func (r *APIKeyRepository) FindAPIKeysByUserID(userID uint) ([]model.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, key_prefix, scopes, chatroom_ids, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find api keys: %v", err)
+	}
+	defer rows.Close()
+
+	apiKeys := []model.APIKey{}
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key data: %v", err)
+		}
+		apiKeys = append(apiKeys, *apiKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find api keys: %v", err)
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey revokes the key of the bot. Returns false if there is no such active key.
+func (r *APIKeyRepository) RevokeAPIKey(userID, keyID uint) (bool, error) {
+	result, err := r.db.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", keyID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke api key: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// TouchAPIKey records the usage of the key. The last usage is updated at most once a minute.
+func (r *APIKeyRepository) TouchAPIKey(keyID uint) error {
+	_, err := r.db.Exec("UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')", keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update api key usage: %v", err)
+	}
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	var chatroomIDs pq.Int64Array
+	err := row.Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Name, &apiKey.Prefix, pq.Array(&apiKey.Scopes), &chatroomIDs,
+		&apiKey.CreatedAt, &apiKey.LastUsedAt, &apiKey.ExpiresAt, &apiKey.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	apiKey.ChatroomIDs = make([]uint, len(chatroomIDs))
+	for i, id := range chatroomIDs {
+		apiKey.ChatroomIDs[i] = uint(id)
+	}
+	return &apiKey, nil
+}
+
+// toInt64s converts IDs to []int64 for compatibility with PostgreSQL arrays
+func toInt64s(ids []uint) []int64 {
+	result := make([]int64, len(ids))
+	for i, id := range ids {
+		result[i] = int64(id)
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"backend/pkg/model"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindActiveAPIKeyByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewAPIKeyRepository(db)
+
+	createdAt := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM api_keys k JOIN users u ON u.id = k.user_id WHERE k.key_hash = \\$1 AND k.revoked_at IS NULL").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "user_id", "name", "key_prefix", "scopes", "chatroom_ids", "created_at", "last_used_at", "expires_at", "revoked_at"},
+		).AddRow(1, 7, "ci", "cak_abcdefgh", "{messages:send,chatrooms:read}", "{3,5}", createdAt, nil, nil, nil))
+
+	apiKey, err := repo.FindActiveAPIKeyByHash("hash")
+	assert.NoError(t, err)
+	assert.NotNil(t, apiKey)
+	assert.Equal(t, uint(7), apiKey.UserID)
+	assert.Equal(t, []string{"messages:send", "chatrooms:read"}, apiKey.Scopes)
+	assert.Equal(t, []uint{3, 5}, apiKey.ChatroomIDs)
+	assert.True(t, apiKey.HasScope(model.APIKeyScopeSendMessages))
+	assert.False(t, apiKey.HasScope(model.APIKeyScopeReadMessages))
+	assert.True(t, apiKey.AllowsChatroom(5))
+	assert.False(t, apiKey.AllowsChatroom(4))
+	assert.Nil(t, apiKey.LastUsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"fmt"
+)
+
+// BlockRepository stores the users blocked and muted by other users
+type BlockRepository struct {
+	db *sql.DB
+}
+
+func NewBlockRepository(db *sql.DB) *BlockRepository {
+	return &BlockRepository{db: db}
+}
+
+// BlockUser blocks the user in one transaction, also removing the users from each other's contacts and cancelling pending contact requests between them.
+// Blocking an already blocked user does nothing.
+func (r *BlockRepository) BlockUser(blockerID, blockedID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = r.BlockUserTx(tx, blockerID, blockedID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *BlockRepository) BlockUserTx(tx *sql.Tx, blockerID, blockedID uint) error {
+	statements := []string{
+		"INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		"DELETE FROM contacts WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)",
+		`UPDATE contact_requests SET status = 'CANCELLED', responded_at = NOW()
+		WHERE status = 'PENDING' AND ((sender_id = $1 AND recipient_id = $2) OR (sender_id = $2 AND recipient_id = $1))`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, blockerID, blockedID); err != nil {
+			return fmt.Errorf("failed to block user: %v", err)
+		}
+	}
+	return nil
+}
+
+// UnblockUser removes the block. Returns false if the user wasn't blocked.
+func (r *BlockRepository) UnblockUser(blockerID, blockedID uint) (bool, error) {
+	return r.delete("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+}
+
+// FindBlockedUsers returns the users blocked by the user, most recently blocked first
+func (r *BlockRepository) FindBlockedUsers(blockerID uint) ([]model.User, error) {
+	query := `
+		SELECT u.id, u.nickname, u.avatar_url, u.is_bot, u.created_at
+		FROM user_blocks b
+		INNER JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+	return r.findUsers(query, blockerID)
+}
+
+// IsBlockedBetween checks whether either of the users blocked the other one
+func (r *BlockRepository) IsBlockedBetween(user1ID, user2ID uint) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+	var blocked bool
+	if err := r.db.QueryRow(query, user1ID, user2ID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to check block: %v", err)
+	}
+	return blocked, nil
+}
+
+// IsBlockedInPrivateChatroom checks whether the chatroom is private and the sender and the other participant blocked each other in any direction
+func (r *BlockRepository) IsBlockedInPrivateChatroom(chatroomID, senderID uint) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM chatrooms c
+			INNER JOIN chatroom_participants cp ON cp.chatroom_id = c.id AND cp.user_id <> $2
+			INNER JOIN user_blocks b ON (b.blocker_id = cp.user_id AND b.blocked_id = $2) OR (b.blocker_id = $2 AND b.blocked_id = cp.user_id)
+			WHERE c.id = $1 AND c.is_group = FALSE
+		)
+	`
+	var blocked bool
+	if err := r.db.QueryRow(query, chatroomID, senderID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to check block: %v", err)
+	}
+	return blocked, nil
+}
+
+// MuteUser mutes the user. Muting an already muted user does nothing.
+func (r *BlockRepository) MuteUser(muterID, mutedID uint) error {
+	_, err := r.db.Exec("INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", muterID, mutedID)
+	if err != nil {
+		return fmt.Errorf("failed to mute user: %v", err)
+	}
+	return nil
+}
+
+// UnmuteUser removes the mute. Returns false if the user wasn't muted.
+func (r *BlockRepository) UnmuteUser(muterID, mutedID uint) (bool, error) {
+	return r.delete("DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2", muterID, mutedID)
+}
+
+// FindMutedUsers returns the users muted by the user, most recently muted first
+func (r *BlockRepository) FindMutedUsers(muterID uint) ([]model.User, error) {
+	query := `
+		SELECT u.id, u.nickname, u.avatar_url, u.is_bot, u.created_at
+		FROM user_mutes m
+		INNER JOIN users u ON u.id = m.muted_id
+		WHERE m.muter_id = $1
+		ORDER BY m.created_at DESC
+	`
+	return r.findUsers(query, muterID)
+}
+
+// FindMuterIDs returns the IDs of the participants of the chatroom who muted the user or muted the chatroom
+func (r *BlockRepository) FindMuterIDs(chatroomID, mutedID uint) ([]uint, error) {
+	query := `
+		SELECT m.muter_id
+		FROM user_mutes m
+		INNER JOIN chatroom_participants cp ON cp.user_id = m.muter_id AND cp.chatroom_id = $1
+		WHERE m.muted_id = $2
+		UNION
+		SELECT user_id FROM chatroom_participants
+		WHERE chatroom_id = $1 AND user_id != $2 AND muted_until > NOW()
+	`
+	rows, err := r.db.Query(query, chatroomID, mutedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find muters: %v", err)
+	}
+	defer rows.Close()
+
+	muterIDs := []uint{}
+	for rows.Next() {
+		var muterID uint
+		if err := rows.Scan(&muterID); err != nil {
+			return nil, err
+		}
+		muterIDs = append(muterIDs, muterID)
+	}
+	return muterIDs, rows.Err()
+}
+
+func (r *BlockRepository) delete(query string, args ...interface{}) (bool, error) {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *BlockRepository) findUsers(query string, args ...interface{}) ([]model.User, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %v", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		var avatarURL sql.NullString
+		if err := rows.Scan(&user.ID, &user.Nickname, &avatarURL, &user.IsBot, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		user.AvatarURL = avatarURL.String
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
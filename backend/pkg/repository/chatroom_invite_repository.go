@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	// ErrChatroomInviteNotFound is returned when the invite doesn't exist, was revoked, has expired or has been used up
+	ErrChatroomInviteNotFound = errors.New("invite not found")
+	// ErrAlreadyParticipant is returned when the user redeeming an invite already participates in the chatroom
+	ErrAlreadyParticipant = errors.New("user is already a participant")
+	// ErrJoinRequestNotFound is returned when the join request doesn't exist or isn't pending
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	// ErrPublicChatroomNotFound is returned when joining a chatroom which doesn't exist or isn't public
+	ErrPublicChatroomNotFound = errors.New("public chatroom not found")
+)
+
+type ChatroomInviteRepository struct {
+	db *sql.DB
+	// chatroomRepo adds the participants and their system messages
+	chatroomRepo *ChatroomRepository
+}
+
+// NewChatroomInviteRepository creates a new instance of ChatroomInviteRepository with the given database connection.
+func NewChatroomInviteRepository(db *sql.DB, chatroomRepo *ChatroomRepository) *ChatroomInviteRepository {
+	return &ChatroomInviteRepository{db: db, chatroomRepo: chatroomRepo}
+}
+
+const chatroomInviteColumns = "id, chatroom_id, created_by, prefix, max_uses, use_count, requires_approval, expires_at, revoked_at, created_at"
+
+// CreateInvite stores a new invite with the given token hash and returns it
+func (r *ChatroomInviteRepository) CreateInvite(invite model.ChatroomInvite, tokenHash string) (*model.ChatroomInvite, error) {
+	query := `
+		INSERT INTO chatroom_invites (chatroom_id, created_by, token_hash, prefix, max_uses, requires_approval, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + chatroomInviteColumns
+	newInvite, err := scanChatroomInvite(r.db.QueryRow(query, invite.ChatroomID, invite.CreatedByID, tokenHash, invite.Prefix, invite.MaxUses, invite.RequiresApproval, invite.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %v", err)
+	}
+	return newInvite, nil
+}
+
+// FindInvitesByChatroomID returns the invites of the chatroom which weren't revoked, newest first
+func (r *ChatroomInviteRepository) FindInvitesByChatroomID(chatroomID uint) ([]model.ChatroomInvite, error) {
+	query := `SELECT ` + chatroomInviteColumns + ` FROM chatroom_invites WHERE chatroom_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(query, chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invites: %v", err)
+	}
+	defer rows.Close()
+
+	invites := []model.ChatroomInvite{}
+	for rows.Next() {
+		invite, err := scanChatroomInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %v", err)
+		}
+		invites = append(invites, *invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find invites: %v", err)
+	}
+	return invites, nil
+}
+
+// RevokeInvite revokes an invite of the chatroom. Returns ErrChatroomInviteNotFound if there is no such invite or it was already revoked.
+func (r *ChatroomInviteRepository) RevokeInvite(chatroomID, inviteID uint) error {
+	result, err := r.db.Exec("UPDATE chatroom_invites SET revoked_at = NOW() WHERE id = $1 AND chatroom_id = $2 AND revoked_at IS NULL", inviteID, chatroomID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite: %v", err)
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite: %v", err)
+	}
+	if revoked == 0 {
+		return ErrChatroomInviteNotFound
+	}
+	return nil
+}
+
+// RedeemInvite uses the invite with the token hash for the user. The user joins the chatroom or, if the invite requires approval, a join request is created.
+func (r *ChatroomInviteRepository) RedeemInvite(tokenHash string, userID uint) (*model.RedeemedChatroomInvite, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	redeemed, err := r.RedeemInviteTx(tx, tokenHash, userID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return redeemed, nil
+}
+
+// RedeemInviteTx redeems an invite in a transaction. Returns ErrChatroomInviteNotFound if the invite can't be used anymore and ErrAlreadyParticipant if the user already participates.
+// A pending join request of the user is returned again without using the invite another time.
+func (r *ChatroomInviteRepository) RedeemInviteTx(tx *sql.Tx, tokenHash string, userID uint) (*model.RedeemedChatroomInvite, error) {
+	// the invite is locked, so that concurrent redemptions can't exceed the maximum number of uses
+	query := `
+		SELECT ` + chatroomInviteColumns + ` FROM chatroom_invites
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) AND (max_uses IS NULL OR use_count < max_uses)
+		FOR UPDATE
+	`
+	invite, err := scanChatroomInvite(tx.QueryRow(query, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChatroomInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invite: %v", err)
+	}
+
+	redeemed, pendingBefore, err := r.joinOrRequestTx(tx, invite.ChatroomID, userID, &invite.ID, invite.RequiresApproval)
+	if err != nil || pendingBefore {
+		return redeemed, err
+	}
+
+	if _, err := tx.Exec("UPDATE chatroom_invites SET use_count = use_count + 1 WHERE id = $1", invite.ID); err != nil {
+		return nil, fmt.Errorf("failed to update invite usage: %v", err)
+	}
+	return redeemed, nil
+}
+
+// JoinPublicChatroom lets the user join a public chatroom, or creates a join request if the chatroom requires approval
+func (r *ChatroomInviteRepository) JoinPublicChatroom(chatroomID, userID uint) (*model.RedeemedChatroomInvite, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	joined, err := r.JoinPublicChatroomTx(tx, chatroomID, userID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return joined, nil
+}
+
+// JoinPublicChatroomTx joins a public chatroom in a transaction. Returns ErrPublicChatroomNotFound if the chatroom isn't public and ErrAlreadyParticipant if the user already participates.
+// A pending join request of the user is returned again.
+func (r *ChatroomInviteRepository) JoinPublicChatroomTx(tx *sql.Tx, chatroomID, userID uint) (*model.RedeemedChatroomInvite, error) {
+	// the chatroom is locked, so that it can't be made private while the user joins
+	var requiresApproval bool
+	err := tx.QueryRow("SELECT join_requires_approval FROM chatrooms WHERE id = $1 AND is_public FOR SHARE", chatroomID).Scan(&requiresApproval)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPublicChatroomNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find public chatroom: %v", err)
+	}
+	joined, _, err := r.joinOrRequestTx(tx, chatroomID, userID, nil, requiresApproval)
+	return joined, err
+}
+
+// joinOrRequestTx adds the user to the chatroom or, if approval is required, creates a join request made with the invite, which is nil for public chatrooms.
+// Returns whether the user already had a pending join request, which is returned instead of creating another one.
+func (r *ChatroomInviteRepository) joinOrRequestTx(tx *sql.Tx, chatroomID, userID uint, inviteID *uint, requiresApproval bool) (*model.RedeemedChatroomInvite, bool, error) {
+	var isParticipant bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM chatroom_participants WHERE chatroom_id = $1 AND user_id = $2)", chatroomID, userID).Scan(&isParticipant)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check chatroom participant: %v", err)
+	}
+	if isParticipant {
+		return nil, false, ErrAlreadyParticipant
+	}
+
+	joined := &model.RedeemedChatroomInvite{ChatroomID: chatroomID}
+	if !requiresApproval {
+		message, err := r.addJoinedParticipantTx(tx, chatroomID, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		joined.Joined = true
+		joined.SystemMessage = &message
+		return joined, false, nil
+	}
+
+	pending, err := scanJoinRequest(tx.QueryRow("SELECT "+joinRequestColumns+" FROM chatroom_join_requests WHERE chatroom_id = $1 AND user_id = $2 AND status = $3",
+		chatroomID, userID, model.JoinRequestStatusPending))
+	if err == nil {
+		joined.JoinRequest = pending
+		return joined, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to find join request: %v", err)
+	}
+	joined.JoinRequest, err = scanJoinRequest(tx.QueryRow("INSERT INTO chatroom_join_requests (chatroom_id, user_id, invite_id) VALUES ($1, $2, $3) RETURNING "+joinRequestColumns,
+		chatroomID, userID, inviteID))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create join request: %v", err)
+	}
+	return joined, false, nil
+}
+
+const joinRequestColumns = "id, chatroom_id, user_id, invite_id, status, created_at, responded_at"
+
+// FindPendingJoinRequests returns the pending join requests of the chatroom with the requesting users, oldest first
+func (r *ChatroomInviteRepository) FindPendingJoinRequests(chatroomID uint) ([]model.ChatroomJoinRequest, error) {
+	query := `
+		SELECT jr.id, jr.chatroom_id, jr.user_id, jr.invite_id, jr.status, jr.created_at, jr.responded_at, ` + userColumns + `
+		FROM chatroom_join_requests jr
+		INNER JOIN users u ON u.id = jr.user_id
+		WHERE jr.chatroom_id = $1 AND jr.status = $2
+		ORDER BY jr.created_at, jr.id
+	`
+	rows, err := r.db.Query(query, chatroomID, model.JoinRequestStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find join requests: %v", err)
+	}
+	defer rows.Close()
+
+	requests := []model.ChatroomJoinRequest{}
+	for rows.Next() {
+		var request model.ChatroomJoinRequest
+		var user model.User
+		var status userStatusRow
+		err := rows.Scan(&request.ID, &request.ChatroomID, &request.UserID, &request.InviteID, &request.Status, &request.CreatedAt, &request.RespondedAt,
+			&user.ID, &user.Nickname, &user.Email, &user.AvatarURL, &user.IsBot, &user.CreatedAt, &status.emoji, &status.text, &status.expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan join request: %v", err)
+		}
+		user.Status = status.toModel()
+		request.User = &user
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find join requests: %v", err)
+	}
+	return requests, nil
+}
+
+// ApproveJoinRequest approves a pending join request of the chatroom and adds the user to the chatroom. Returns the request and the system message announcing the join.
+func (r *ChatroomInviteRepository) ApproveJoinRequest(chatroomID, requestID, approverID uint) (*model.ChatroomJoinRequest, *model.ChatMessage, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, message, err := r.ApproveJoinRequestTx(tx, chatroomID, requestID, approverID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return request, message, nil
+}
+
+func (r *ChatroomInviteRepository) ApproveJoinRequestTx(tx *sql.Tx, chatroomID, requestID, approverID uint) (*model.ChatroomJoinRequest, *model.ChatMessage, error) {
+	request, err := respondToJoinRequest(tx, chatroomID, requestID, approverID, model.JoinRequestStatusApproved)
+	if err != nil {
+		return nil, nil, err
+	}
+	message, err := r.addJoinedParticipantTx(tx, chatroomID, request.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return request, &message, nil
+}
+
+// DeclineJoinRequest declines a pending join request of the chatroom
+func (r *ChatroomInviteRepository) DeclineJoinRequest(chatroomID, requestID, approverID uint) (*model.ChatroomJoinRequest, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := respondToJoinRequest(tx, chatroomID, requestID, approverID, model.JoinRequestStatusDeclined)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	return request, tx.Commit()
+}
+
+// respondToJoinRequest sets the status of a pending join request. Returns ErrJoinRequestNotFound if there is no such pending request.
+func respondToJoinRequest(tx *sql.Tx, chatroomID, requestID, responderID uint, status string) (*model.ChatroomJoinRequest, error) {
+	query := `
+		UPDATE chatroom_join_requests SET status = $4, responded_at = NOW(), responded_by = $3
+		WHERE id = $1 AND chatroom_id = $2 AND status = $5
+		RETURNING ` + joinRequestColumns
+	request, err := scanJoinRequest(tx.QueryRow(query, requestID, chatroomID, responderID, status, model.JoinRequestStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update join request: %v", err)
+	}
+	return request, nil
+}
+
+// addJoinedParticipantTx adds the user to the chatroom and returns the system message announcing the join
+func (r *ChatroomInviteRepository) addJoinedParticipantTx(tx *sql.Tx, chatroomID, userID uint) (model.ChatMessage, error) {
+	addedIDs, err := r.chatroomRepo.AddParticipantsToChatroom(tx, chatroomID, []uint{userID})
+	if err != nil {
+		return model.ChatMessage{}, err
+	}
+	if len(addedIDs) == 0 {
+		return model.ChatMessage{}, ErrAlreadyParticipant
+	}
+	return r.chatroomRepo.addSystemMessageTx(tx, chatroomID, userID, model.SystemEventMemberJoined, userID)
+}
+
+func scanChatroomInvite(row rowScanner) (*model.ChatroomInvite, error) {
+	var invite model.ChatroomInvite
+	err := row.Scan(&invite.ID, &invite.ChatroomID, &invite.CreatedByID, &invite.Prefix, &invite.MaxUses, &invite.UseCount, &invite.RequiresApproval,
+		&invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func scanJoinRequest(row rowScanner) (*model.ChatroomJoinRequest, error) {
+	var request model.ChatroomJoinRequest
+	err := row.Scan(&request.ID, &request.ChatroomID, &request.UserID, &request.InviteID, &request.Status, &request.CreatedAt, &request.RespondedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedeemInvite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomInviteRepository(db, NewChatroomRepository(db))
+	inviteColumns := []string{"id", "chatroom_id", "created_by", "prefix", "max_uses", "use_count", "requires_approval", "expires_at", "revoked_at", "created_at"}
+	timestamp := time.Now()
+
+	// The user joins the chatroom, a system message is added and the use is counted
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_invites WHERE token_hash = \\$1 (.+) FOR UPDATE").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(inviteColumns).AddRow(3, 1, 2, "abcdefgh", 5, 4, false, nil, nil, timestamp))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatroom_participants WHERE chatroom_id = \\$1 AND user_id = \\$2\\)").
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO chatroom_participants \\(chatroom_id, user_id\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT").
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectQuery("SELECT \\(SELECT nickname FROM users WHERE id = \\$1\\), \\(SELECT nickname FROM users WHERE id = \\$2\\)").
+		WithArgs(7, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"actor", "user"}).AddRow("Bob", "Bob"))
+	mock.ExpectQuery("INSERT INTO messages \\(chatroom_id, sender_user_id, text, kind, system_event, system_user_id\\)").
+		WithArgs(1, 7, "Bob joined", "SYSTEM", "MEMBER_JOINED", 7).
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"},
+		).AddRow(9, 1, 7, "Bob joined", nil, timestamp, false, false, false, "SYSTEM", "MEMBER_JOINED", 7))
+	mock.ExpectExec("UPDATE chatroom_invites SET use_count = use_count \\+ 1 WHERE id = \\$1").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	redeemed, err := repo.RedeemInvite("hash", 7)
+	assert.NoError(t, err)
+	assert.True(t, redeemed.Joined)
+	assert.Equal(t, uint(1), redeemed.ChatroomID)
+	assert.Nil(t, redeemed.JoinRequest)
+	assert.Equal(t, "Bob joined", redeemed.SystemMessage.Text)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// An expired, revoked or used up invite isn't found
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_invites WHERE token_hash = \\$1 (.+) FOR UPDATE").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(inviteColumns))
+	mock.ExpectRollback()
+
+	_, err = repo.RedeemInvite("hash", 7)
+	assert.ErrorIs(t, err, ErrChatroomInviteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A pending join request is returned again without using the invite
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_invites WHERE token_hash = \\$1 (.+) FOR UPDATE").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(inviteColumns).AddRow(3, 1, 2, "abcdefgh", nil, 1, true, nil, nil, timestamp))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatroom_participants WHERE chatroom_id = \\$1 AND user_id = \\$2\\)").
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_join_requests WHERE chatroom_id = \\$1 AND user_id = \\$2 AND status = \\$3").
+		WithArgs(1, 7, "PENDING").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "invite_id", "status", "created_at", "responded_at"}).
+			AddRow(4, 1, 7, 3, "PENDING", timestamp, nil))
+	mock.ExpectCommit()
+
+	redeemed, err = repo.RedeemInvite("hash", 7)
+	assert.NoError(t, err)
+	assert.False(t, redeemed.Joined)
+	assert.Equal(t, uint(4), redeemed.JoinRequest.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJoinPublicChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomInviteRepository(db, NewChatroomRepository(db))
+	timestamp := time.Now()
+
+	// A chatroom which requires approval gets a join request without an invite
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT join_requires_approval FROM chatrooms WHERE id = \\$1 AND is_public FOR SHARE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"join_requires_approval"}).AddRow(true))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatroom_participants WHERE chatroom_id = \\$1 AND user_id = \\$2\\)").
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_join_requests WHERE chatroom_id = \\$1 AND user_id = \\$2 AND status = \\$3").
+		WithArgs(1, 7, "PENDING").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "invite_id", "status", "created_at", "responded_at"}))
+	mock.ExpectQuery("INSERT INTO chatroom_join_requests \\(chatroom_id, user_id, invite_id\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs(1, 7, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "invite_id", "status", "created_at", "responded_at"}).
+			AddRow(5, 1, 7, nil, "PENDING", timestamp, nil))
+	mock.ExpectCommit()
+
+	joined, err := repo.JoinPublicChatroom(1, 7)
+	assert.NoError(t, err)
+	assert.False(t, joined.Joined)
+	assert.Equal(t, uint(5), joined.JoinRequest.ID)
+	assert.Nil(t, joined.JoinRequest.InviteID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A private chatroom isn't found
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT join_requires_approval FROM chatrooms WHERE id = \\$1 AND is_public FOR SHARE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"join_requires_approval"}))
+	mock.ExpectRollback()
+
+	_, err = repo.JoinPublicChatroom(2, 7)
+	assert.ErrorIs(t, err, ErrPublicChatroomNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
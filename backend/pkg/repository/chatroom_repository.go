@@ -3,12 +3,21 @@ package repository
 import (
 	"backend/pkg/model"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// ErrParticipantNotFound is returned when the user is not a participant of the chatroom or doesn't have the expected role
+var ErrParticipantNotFound = errors.New("participant not found")
+
+// ErrNotPrivateChatroomParticipant is returned when a user acts in the private chatroom of two other users
+var ErrNotPrivateChatroomParticipant = errors.New("user is not a participant of the private chatroom")
+
 type ChatroomRepository struct {
 	db *sql.DB
 }
@@ -18,77 +27,45 @@ func NewChatroomRepository(db *sql.DB) *ChatroomRepository {
 	return &ChatroomRepository{db: db}
 }
 
-// FindByID finds a chatroom by its ID. Returns nil if chatroom is not found.
+// FindByID finds a chatroom by its ID with a page of its messages and, unless it is a channel, its participants. Returns nil if chatroom is not found.
+// Channels can have many subscribers, so they only have the subscriber count.
 func (r *ChatroomRepository) FindByID(chatroomID, userID uint, messagesPage, messagesPageSize int) (*model.ChatroomForUser, error) {
-	// Calculate offset based on messagesPage number and messagesPage size
-	offset := (messagesPage - 1) * messagesPageSize
-
 	query := `
-        SELECT c.id, c.is_group, c.group_name, c.created_at,
-               m.id, m.chatroom_id, m.sender_user_id, m.text, m.attachment_url, m.timestamp, m.viewed, m.deleted, m.edited,
-               u.id, u.nickname, u.email, u.avatar_url, u.created_at
+        SELECT c.id, c.is_group, c.group_name, c.created_at, c.description, c.topic, c.avatar_url, c.only_admins_can_send, c.members_can_edit_info, c.members_can_pin,
+               c.is_public, c.join_requires_approval, c.is_channel, ` + subscriberCountColumn + `
         FROM chatrooms c
-        LEFT JOIN (
-            SELECT * FROM messages
-            WHERE chatroom_id = $1
-            ORDER BY timestamp DESC
-            LIMIT $2 OFFSET $3
-        ) m ON c.id = m.chatroom_id
-        LEFT JOIN chatroom_participants cp ON c.id = cp.chatroom_id
-        LEFT JOIN users u ON cp.user_id = u.id
         WHERE c.id = $1
     `
 
-	rows, err := r.db.Query(query, chatroomID, messagesPageSize, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find chatroom by id: %v", err)
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		// No rows were returned, so no chatroom with the given ID exists
-		return nil, nil
-	}
-
 	chatroom := &model.ChatroomForUser{
 		Chatroom: model.Chatroom{},
 		UserID:   userID,
 	}
-
-	var messages []model.ChatMessage
-	var participants []model.User
-
-	for rows.Next() {
-		var message model.ChatMessage
-		var participant model.User
-		var groupName sql.NullString
-		var attachmentURL sql.NullString
-
-		err := rows.Scan(&chatroom.ID, &chatroom.IsGroup, &groupName, &chatroom.CreatedAt,
-			&message.ID, &message.ChatroomID, &message.SenderID, &message.Text, &attachmentURL, &message.TimeStamp, &message.Viewed, &message.Deleted, &message.Edited,
-			&participant.ID, &participant.Nickname, &participant.Email, &participant.AvatarURL, &participant.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan chatroom data: %v", err)
-		}
-
-		if groupName.Valid {
-			chatroom.GroupName = groupName.String
-		}
-
-		if attachmentURL.Valid {
-			message.AttachmentURL = attachmentURL.String
-		}
-
-		messages = append(messages, message)
-		participants = append(participants, participant)
+	var groupName sql.NullString
+	var settings model.GroupSettings
+	var subscriberCount int
+	err := r.db.QueryRow(query, chatroomID).Scan(&chatroom.ID, &chatroom.IsGroup, &groupName, &chatroom.CreatedAt,
+		&chatroom.Description, &chatroom.Topic, &chatroom.AvatarURL, &settings.OnlyAdminsCanSend, &settings.MembersCanEditInfo, &settings.MembersCanPin,
+		&settings.Public, &settings.JoinRequiresApproval,
+		&chatroom.IsChannel, &subscriberCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
 	}
-
-	if err := rows.Err(); err != nil {
+	if err != nil {
 		return nil, fmt.Errorf("failed to find chatroom by id: %v", err)
 	}
-
-	chatroom.Messages = messages
-	chatroom.Participants = participants
+	chatroom.GroupName = groupName.String
+	if chatroom.IsGroup {
+		chatroom.Settings = &settings
+	}
+	if chatroom.IsChannel {
+		chatroom.SubscriberCount = subscriberCount
+	} else if chatroom.Participants, err = r.GetParticipantsForChatroom(chatroomID); err != nil {
+		return nil, err
+	}
+	if chatroom.Messages, err = r.FindMessagesByChatroomID(chatroomID, messagesPage, messagesPageSize); err != nil {
+		return nil, err
+	}
 
 	return chatroom, nil
 }
@@ -96,7 +73,14 @@ func (r *ChatroomRepository) FindByID(chatroomID, userID uint, messagesPage, mes
 // GetParticipantsForChatroom Retrieves participants for a chatroom
 func (r *ChatroomRepository) GetParticipantsForChatroom(chatroomID uint) ([]model.User, error) {
 	// Query to select participants for a chatroom
-	query := "SELECT u.id, u.nickname, u.email, u.avatar_url, u.created_at FROM users u JOIN chatroom_participants cp ON u.id = cp.user_id WHERE cp.chatroom_id = $1"
+	query := `
+		SELECT u.id, u.nickname, u.email, u.avatar_url, u.created_at, u.status_emoji, u.status_text, u.status_expires_at,
+		       CASE WHEN c.is_group THEN cp.role ELSE '' END
+		FROM users u
+		JOIN chatroom_participants cp ON u.id = cp.user_id
+		JOIN chatrooms c ON c.id = cp.chatroom_id
+		WHERE cp.chatroom_id = $1
+	`
 
 	rows, err := r.db.Query(query, chatroomID)
 	if err != nil {
@@ -109,10 +93,12 @@ func (r *ChatroomRepository) GetParticipantsForChatroom(chatroomID uint) ([]mode
 	// Iterate through the rows and scan participant data into variables
 	for rows.Next() {
 		var participant model.User
-		err := rows.Scan(&participant.ID, &participant.Nickname, &participant.Email, &participant.AvatarURL, &participant.CreatedAt)
+		var status userStatusRow
+		err := rows.Scan(&participant.ID, &participant.Nickname, &participant.Email, &participant.AvatarURL, &participant.CreatedAt, &status.emoji, &status.text, &status.expiresAt, &participant.Role)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan participant data: %v", err)
 		}
+		participant.Status = status.toModel()
 		// Append participant to the slice
 		participants = append(participants, participant)
 	}
@@ -130,9 +116,9 @@ func (r *ChatroomRepository) FindMessagesByChatroomID(chatroomID uint, page, pag
 
 	// Query to select messages for a chatroom with pagination. We first sort messages in desc order and cut the desired part out and sort that part back to ascending order.
 	query := `
-			SELECT id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited
+			SELECT ` + messageColumns + `
 			FROM (
-				SELECT id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited
+				SELECT ` + messageColumns + `
 				FROM messages
 				WHERE chatroom_id = $1
 				ORDER BY timestamp DESC
@@ -152,18 +138,10 @@ func (r *ChatroomRepository) FindMessagesByChatroomID(chatroomID uint, page, pag
 
 	// Iterate through the rows and scan message data into variables
 	for rows.Next() {
-		var message model.ChatMessage
-		var attachmentURLNullable sql.NullString
-
-		err := rows.Scan(&message.ID, &message.ChatroomID, &message.SenderID, &message.Text, &attachmentURLNullable, &message.TimeStamp, &message.Viewed, &message.Deleted, &message.Edited)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message data: %v", err)
 		}
-		var attachmentURLString string
-		if attachmentURLNullable.Valid {
-			attachmentURLString = attachmentURLNullable.String
-		}
-		message.AttachmentURL = attachmentURLString
 		// Append message to the slice
 		messages = append(messages, message)
 	}
@@ -174,15 +152,68 @@ func (r *ChatroomRepository) FindMessagesByChatroomID(chatroomID uint, page, pag
 	return messages, nil
 }
 
-// FindChatroomsByUserID retrieves all the chatrooms that a user belongs to and calculates the unread count for each chatroom.
-func (r *ChatroomRepository) FindChatroomsByUserID(userID uint, page, pageSize int) ([]model.ChatroomForUser, error) {
-	query := `
-		SELECT c.id, c.is_group, c.group_name, c.created_at, cp.unread_count
-		FROM chatrooms c
-		INNER JOIN chatroom_participants cp ON c.id = cp.chatroom_id
-		WHERE cp.user_id = $1
-	`
-	rows, err := r.db.Query(query, userID)
+// ChatListCursor is the position of the last chatroom of a chat list page. Time is when the chatroom was pinned or, if it isn't pinned, its last activity.
+type ChatListCursor struct {
+	Pinned bool      `json:"p,omitempty"`
+	Time   time.Time `json:"t"`
+	ID     uint      `json:"i"`
+}
+
+// NewChatListCursor returns the cursor positioned at the chatroom
+func NewChatListCursor(chatroom model.ChatroomForUser) ChatListCursor {
+	if chatroom.UserSettings.PinnedAt != nil {
+		return ChatListCursor{Pinned: true, Time: *chatroom.UserSettings.PinnedAt, ID: chatroom.ID}
+	}
+	return ChatListCursor{Time: chatroom.LastActivityAt, ID: chatroom.ID}
+}
+
+// lastMessageColumns are the messageColumns of the last message lm of the chatroom c. Chatrooms without messages get a message with ID 0.
+// A message in a channel counts as viewed once the read cursor of a subscriber other than the sender passed it.
+const lastMessageColumns = `COALESCE(lm.id, 0), COALESCE(lm.chatroom_id, 0), COALESCE(lm.sender_user_id, 0), COALESCE(lm.text, ''), lm.attachment_url,
+		COALESCE(lm.timestamp, c.created_at),
+		CASE WHEN c.is_channel THEN EXISTS (
+			SELECT 1 FROM chatroom_participants rc WHERE rc.chatroom_id = c.id AND rc.last_read_message_id >= lm.id AND rc.user_id != lm.sender_user_id
+		) ELSE COALESCE(lm.viewed, FALSE) END,
+		COALESCE(lm.deleted, FALSE), COALESCE(lm.edited, FALSE), COALESCE(lm.kind, 'USER'), lm.system_event, lm.system_user_id`
+
+// chatListSortKey sorts pinned chatrooms first by when they were pinned and the others by their last activity, which is the time of the last message or the creation of chatrooms without messages
+const chatListSortKey = "(cp.pinned_at IS NOT NULL), COALESCE(cp.pinned_at, lm.timestamp, c.created_at), c.id"
+
+// FindChatroomsByUserID retrieves up to limit chatrooms of the user's chat list selected by the filter, starting after the cursor if given.
+// Pinned chatrooms come first, most recently pinned first, followed by the other chatrooms with the latest activity first.
+// The chatrooms come with their last message, unread count, participant count, the other participant of private chatrooms and the user's settings, all in a single query.
+func (r *ChatroomRepository) FindChatroomsByUserID(userID uint, filter model.ChatroomFilter, after *ChatListCursor, limit int) ([]model.ChatroomForUser, error) {
+	conditions := []string{"cp.user_id = $1", "cp.archived = $2", "(NOT $3 OR " + unreadCountColumn + " > 0 OR cp.marked_unread)"}
+	args := []interface{}{userID, filter.Archived, filter.Unread}
+	if after != nil {
+		conditions = append(conditions, "("+chatListSortKey+") < ($4, $5, $6)")
+		args = append(args, after.Pinned, after.Time, after.ID)
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT %v,
+		       c.id, c.is_group, c.group_name, c.created_at, c.description, c.topic, c.avatar_url, c.only_admins_can_send, c.members_can_edit_info, c.members_can_pin,
+		       c.is_public, c.join_requires_approval, c.is_channel, %v, %v,
+		       %v,
+		       ou.id, ou.nickname, ou.email, ou.avatar_url
+		FROM chatroom_participants cp
+		INNER JOIN chatrooms c ON c.id = cp.chatroom_id
+		LEFT JOIN LATERAL (
+			SELECT %v FROM messages WHERE chatroom_id = c.id ORDER BY id DESC LIMIT 1
+		) lm ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT u.id, u.nickname, u.email, COALESCE(u.avatar_url, '') AS avatar_url
+			FROM chatroom_participants op
+			INNER JOIN users u ON u.id = op.user_id
+			WHERE NOT c.is_group AND op.chatroom_id = c.id AND op.user_id != cp.user_id
+			LIMIT 1
+		) ou ON TRUE
+		WHERE %v
+		ORDER BY (cp.pinned_at IS NOT NULL) DESC, COALESCE(cp.pinned_at, lm.timestamp, c.created_at) DESC, c.id DESC
+		LIMIT $%d
+	`, lastMessageColumns, subscriberCountColumn, unreadCountColumn, userSettingsColumns, messageColumns, strings.Join(conditions, " AND "), len(args))
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find chatrooms by user id: %v", err)
 	}
@@ -193,29 +224,38 @@ func (r *ChatroomRepository) FindChatroomsByUserID(userID uint, page, pageSize i
 	for rows.Next() {
 		var chatroom model.ChatroomForUser
 		var groupNameNullable sql.NullString
-
-		if err := rows.Scan(&chatroom.ID, &chatroom.IsGroup, &groupNameNullable, &chatroom.CreatedAt, &chatroom.UnreadCount); err != nil {
+		var settings model.GroupSettings
+		var userSettings chatroomUserSettingsRow
+		var other otherParticipantRow
+
+		lastMessage, err := scanMessage(extraColumnsScanner{row: rows, extra: []interface{}{
+			&chatroom.ID, &chatroom.IsGroup, &groupNameNullable, &chatroom.CreatedAt,
+			&chatroom.Description, &chatroom.Topic, &chatroom.AvatarURL, &settings.OnlyAdminsCanSend, &settings.MembersCanEditInfo, &settings.MembersCanPin,
+			&settings.Public, &settings.JoinRequiresApproval,
+			&chatroom.IsChannel, &chatroom.ParticipantCount, &chatroom.UnreadCount,
+			&userSettings.archived, &userSettings.mutedUntil, &userSettings.pinnedAt, &userSettings.markedUnread,
+			&other.id, &other.nickname, &other.email, &other.avatarURL,
+		}})
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan chatroom data: %v", err)
 		}
-
-		if groupNameNullable.Valid {
-			chatroom.GroupName = groupNameNullable.String
+		chatroom.UserID = userID
+		chatroom.UserSettings = userSettings.toModel()
+		chatroom.LastActivityAt = lastMessage.TimeStamp
+		if lastMessage.ID != 0 {
+			chatroom.LastMessage = &lastMessage
 		}
-
-		// Retrieve messages for the chatroom
-		messages, err := r.FindMessagesByChatroomID(chatroom.ID, page, pageSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find chatrooms by user id: %v", err)
+		chatroom.OtherParticipant = other.toModel()
+		if chatroom.IsGroup {
+			chatroom.Settings = &settings
+		}
+		if chatroom.IsChannel {
+			chatroom.SubscriberCount = chatroom.ParticipantCount
 		}
-		chatroom.Messages = messages
 
-		// Retrieve participants for the chatroom
-		participants, err := r.GetParticipantsForChatroom(chatroom.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find chatrooms by user id: %v", err)
+		if groupNameNullable.Valid {
+			chatroom.GroupName = groupNameNullable.String
 		}
-		chatroom.Participants = participants
-		chatroom.UserID = userID
 
 		// Append chatroom to the slice
 		chatrooms = append(chatrooms, chatroom)
@@ -228,6 +268,21 @@ func (r *ChatroomRepository) FindChatroomsByUserID(userID uint, page, pageSize i
 	return chatrooms, nil
 }
 
+// otherParticipantRow holds the nullable columns of the other participant of a private chatroom
+type otherParticipantRow struct {
+	id        sql.NullInt64
+	nickname  sql.NullString
+	email     sql.NullString
+	avatarURL sql.NullString
+}
+
+func (o otherParticipantRow) toModel() *model.User {
+	if !o.id.Valid {
+		return nil
+	}
+	return &model.User{ID: uint(o.id.Int64), Nickname: o.nickname.String, Email: o.email.String, AvatarURL: o.avatarURL.String}
+}
+
 func (r *ChatroomRepository) AddMessageToChatroom(chatroomID uint, message model.ChatMessage) (*model.ChatMessage, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -250,30 +305,28 @@ func (r *ChatroomRepository) AddMessageToChatroom(chatroomID uint, message model
 	return &newMessage, nil
 }
 // AddMessageToChatroomTx adds a message to a chatroom in a transaction. It also updates the unread count for all participants in the chatroom except the sender.
+// Channels only store the message, because their subscribers have read cursors instead of views and unread counts.
 func (r *ChatroomRepository) AddMessageToChatroomTx(tx *sql.Tx, chatroomID uint, message model.ChatMessage) (model.ChatMessage, error) {
 	// Check if chatroom exists
-	var exists bool
-	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM chatrooms WHERE id = $1)", chatroomID).Scan(&exists)
+	var isChannel bool
+	err := tx.QueryRow("SELECT is_channel FROM chatrooms WHERE id = $1", chatroomID).Scan(&isChannel)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ChatMessage{}, fmt.Errorf("chatroom with id %v does not exist", chatroomID)
+	}
 	if err != nil {
 		return model.ChatMessage{}, fmt.Errorf("failed to check if chatroom exists: %v", err)
 	}
-	if !exists {
-		return model.ChatMessage{}, fmt.Errorf("chatroom with id %v does not exist", chatroomID)
-	}
 	query := `
 		INSERT INTO messages (chatroom_id, sender_user_id, text, attachment_url)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited
+		RETURNING ` + messageColumns + `
 	`
-	var newMessage model.ChatMessage
-	var attachmentURL sql.NullString
-	err = tx.QueryRow(query, chatroomID, message.SenderID, message.Text, message.AttachmentURL).Scan(
-		&newMessage.ID, &newMessage.ChatroomID, &newMessage.SenderID, &newMessage.Text, &attachmentURL, &newMessage.TimeStamp, &newMessage.Viewed, &newMessage.Deleted, &newMessage.Edited)
+	newMessage, err := scanMessage(tx.QueryRow(query, chatroomID, message.SenderID, message.Text, message.AttachmentURL))
 	if err != nil {
 		return model.ChatMessage{}, err
 	}
-	if attachmentURL.Valid {
-		newMessage.AttachmentURL = attachmentURL.String
+	if isChannel {
+		return newMessage, nil
 	}
 
 	// Insert a record into the message_views table for each user in the chatroom, except for the user who created the message
@@ -285,8 +338,12 @@ func (r *ChatroomRepository) AddMessageToChatroomTx(tx *sql.Tx, chatroomID uint,
 		return model.ChatMessage{}, err
 	}
 
-	// When a new message is added update the unread count for all participants in the chatroom except the sender
-	_, err = tx.Exec("UPDATE chatroom_participants SET unread_count = unread_count + 1 WHERE chatroom_id = $1 AND user_id != $2", chatroomID, message.SenderID)
+	// When a new message is added update the unread count for all participants in the chatroom except the sender and those who muted the sender.
+	// The message also unarchives the chatroom for them unless they muted it.
+	_, err = tx.Exec(`
+		UPDATE chatroom_participants SET unread_count = unread_count + 1, archived = archived AND COALESCE(muted_until > NOW(), FALSE)
+		WHERE chatroom_id = $1 AND user_id != $2 AND user_id NOT IN (SELECT muter_id FROM user_mutes WHERE muted_id = $2)`,
+		chatroomID, message.SenderID)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return model.ChatMessage{}, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
@@ -297,7 +354,7 @@ func (r *ChatroomRepository) AddMessageToChatroomTx(tx *sql.Tx, chatroomID uint,
 	return newMessage, nil
 }
 
-// CreatePrivateChatroom Create private chatroom between two users returning the newly created chatroom
+// CreatePrivateChatroom returns the private chatroom between two users, creating it if they don't have one yet
 func (r *ChatroomRepository) CreatePrivateChatroom(user1ID, user2ID uint) (*model.Chatroom, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -321,27 +378,49 @@ func (r *ChatroomRepository) CreatePrivateChatroom(user1ID, user2ID uint) (*mode
 }
 
 func (r *ChatroomRepository) CreatePrivateChatroomTx(tx *sql.Tx, user1ID, user2ID uint) (*model.Chatroom, error) {
+	chatroom, _, err := r.findOrCreatePrivateChatroomTx(tx, user1ID, user2ID)
+	return chatroom, err
+}
+
+// findOrCreatePrivateChatroomTx returns the private chatroom between two users and whether it was created now. Every unordered pair of users has at most one private chatroom.
+func (r *ChatroomRepository) findOrCreatePrivateChatroomTx(tx *sql.Tx, user1ID, user2ID uint) (*model.Chatroom, bool, error) {
+	if user1ID == user2ID {
+		return nil, false, fmt.Errorf("a private chatroom should be between two different users")
+	}
+	if user1ID > user2ID {
+		user1ID, user2ID = user2ID, user1ID
+	}
+	// a concurrent insert of the same pair makes this one wait and then do nothing, so the chatroom is found afterwards
 	query := `
-		INSERT INTO chatrooms (is_group)
-		VALUES (false)
+		INSERT INTO chatrooms (is_group, private_user1_id, private_user2_id)
+		VALUES (false, $1, $2)
+		ON CONFLICT (private_user1_id, private_user2_id) DO NOTHING
 		RETURNING id, is_group, created_at
 	`
 	var chatroom model.Chatroom
-	err := tx.QueryRow(query).Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.CreatedAt)
+	err := tx.QueryRow(query, user1ID, user2ID).Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow("SELECT id, is_group, created_at FROM chatrooms WHERE private_user1_id = $1 AND private_user2_id = $2", user1ID, user2ID).
+			Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.CreatedAt)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to find private chatroom: %v", err)
+		}
+		return &chatroom, false, nil
+	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Add participants to the chatroom
-	if err := r.AddParticipantsToChatroom(tx, chatroom.ID, []uint{user1ID, user2ID}); err != nil {
-		return nil, err
+	if _, err := r.AddParticipantsToChatroom(tx, chatroom.ID, []uint{user1ID, user2ID}); err != nil {
+		return nil, false, err
 	}
 
-	return &chatroom, nil
+	return &chatroom, true, nil
 }
 
-// AddParticipantsToChatroom adds participants to a chatroom in a transaction
-func (r *ChatroomRepository) AddParticipantsToChatroom(tx *sql.Tx, id uint, uints []uint) error {
+// AddParticipantsToChatroom adds participants to a chatroom in a transaction and returns the IDs of the added users. Users who already participate are skipped.
+func (r *ChatroomRepository) AddParticipantsToChatroom(tx *sql.Tx, id uint, uints []uint) ([]uint, error) {
 	// Prepare the base of the query
 	query := "INSERT INTO chatroom_participants (chatroom_id, user_id) VALUES "
 
@@ -355,19 +434,21 @@ func (r *ChatroomRepository) AddParticipantsToChatroom(tx *sql.Tx, id uint, uint
 		values = append(values, userID)
 	}
 
+	query += " ON CONFLICT (chatroom_id, user_id) DO NOTHING RETURNING user_id"
+
 	// Add chatroom_id to the beginning of values
 	values = append([]interface{}{id}, values...)
 
 	// Execute the query with the arguments
-	_, err := tx.Exec(query, values...)
+	addedIDs, err := queryIDs(tx, query, values...)
 	if err != nil {
-		return fmt.Errorf("failed to add participants to chatroom: %v", err)
+		return nil, fmt.Errorf("failed to add participants to chatroom: %v", err)
 	}
 
-	return nil
+	return addedIDs, nil
 }
 
-// CreatePrivateChatroomWithMessage creates a private chatroom between two users and adds a message to it.
+// CreatePrivateChatroomWithMessage adds a message to the private chatroom between two users, creating the chatroom if they don't have one yet.
 func (r *ChatroomRepository) CreatePrivateChatroomWithMessage(user1ID, user2ID uint, message model.ChatMessage) (*model.ChatMessage, error) {
 	// Start a new transaction
 	tx, err := r.db.Begin()
@@ -394,8 +475,14 @@ func (r *ChatroomRepository) CreatePrivateChatroomWithMessage(user1ID, user2ID u
 	return &newMessage, nil
 }
 
-// CreatePrivateChatroomWithCreateOptions creates a private chatroom between two users and adds a message to it.
-func (r *ChatroomRepository) CreatePrivateChatroomWithCreateOptions(createOptions *model.CreatePrivateChatroom) (*model.Chatroom, error) {
+// CreatePrivateChatroomWithCreateOptions adds the first message to the private chatroom between two users, creating the chatroom if they don't have one yet.
+// Existing is set in the options if the chatroom already existed. Returns ErrNotPrivateChatroomParticipant unless the actor is one of the users and sends the message.
+func (r *ChatroomRepository) CreatePrivateChatroomWithCreateOptions(actorID uint, createOptions *model.CreatePrivateChatroom) (*model.Chatroom, error) {
+	// the existing chatroom of the pair is returned, so other users must never reach it
+	if (actorID != createOptions.Participants[0].ID && actorID != createOptions.Participants[1].ID) || actorID != createOptions.ChatMessage.SenderID {
+		return nil, ErrNotPrivateChatroomParticipant
+	}
+
 	// Start a new transaction
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -422,11 +509,12 @@ func (r *ChatroomRepository) CreatePrivateChatroomWithCreateOptions(createOption
 }
 
 func (r *ChatroomRepository) CreatePrivateChatroomWithCreateOptionsTx(tx *sql.Tx, createOptions *model.CreatePrivateChatroom) (model.Chatroom, error) {
-	// Create a private chatroom between two users
-	chatroom, err := r.CreatePrivateChatroomTx(tx, createOptions.Participants[0].ID, createOptions.Participants[1].ID)
+	// Find or create the private chatroom between two users
+	chatroom, created, err := r.findOrCreatePrivateChatroomTx(tx, createOptions.Participants[0].ID, createOptions.Participants[1].ID)
 	if err != nil {
 		return model.Chatroom{}, fmt.Errorf("failed to create private chatroom: %v", err)
 	}
+	createOptions.Existing = !created
 
 	// Add message to the chatroom
 	newMessage, err := r.AddMessageToChatroomTx(
@@ -464,14 +552,14 @@ func (r *ChatroomRepository) CreatePrivateChatroomWithMessageTx(tx *sql.Tx, user
 	return newMessage, nil
 }
 
-// CreateGroupChatroom creates a group chatroom with the given name and participants.
-func (r *ChatroomRepository) CreateGroupChatroom(groupName string, participants []uint) (*model.Chatroom, error) {
+// CreateGroupChatroom creates a group chatroom with the given name and participants. The owner must be one of the participants.
+func (r *ChatroomRepository) CreateGroupChatroom(groupName string, isChannel bool, ownerID uint, participants []uint) (*model.Chatroom, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	chatroom, err := r.CreateGroupChatroomTx(tx, groupName, participants)
+	chatroom, err := r.CreateGroupChatroomTx(tx, groupName, isChannel, ownerID, participants)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
@@ -487,34 +575,38 @@ func (r *ChatroomRepository) CreateGroupChatroom(groupName string, participants
 	return chatroom, nil
 }
 
-func (r *ChatroomRepository) CreateGroupChatroomTx(tx *sql.Tx, groupName string, participants []uint) (*model.Chatroom, error) {
+func (r *ChatroomRepository) CreateGroupChatroomTx(tx *sql.Tx, groupName string, isChannel bool, ownerID uint, participants []uint) (*model.Chatroom, error) {
 	query := `
-		INSERT INTO chatrooms (is_group, group_name)
-		VALUES (true, $1)
-		RETURNING id, is_group, created_at
+		INSERT INTO chatrooms (is_group, group_name, is_channel)
+		VALUES (true, $1, $2)
+		RETURNING id, is_group, is_channel, created_at
 	`
-	var chatroom model.Chatroom
-	err := tx.QueryRow(query, groupName).Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.CreatedAt)
+	chatroom := model.Chatroom{GroupName: groupName, Settings: &model.GroupSettings{}}
+	err := tx.QueryRow(query, groupName, isChannel).Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.IsChannel, &chatroom.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
 	// Add participants to the chatroom
-	if err := r.AddParticipantsToChatroom(tx, chatroom.ID, participants); err != nil {
+	if _, err := r.AddParticipantsToChatroom(tx, chatroom.ID, participants); err != nil {
 		return nil, err
 	}
+	if _, err := tx.Exec("UPDATE chatroom_participants SET role = $3 WHERE chatroom_id = $1 AND user_id = $2", chatroom.ID, ownerID, model.ChatroomRoleOwner); err != nil {
+		return nil, fmt.Errorf("failed to set owner of chatroom: %v", err)
+	}
 
 	return &chatroom, nil
 }
 
-// UpdateGroupChatroom updates a group chatroom with the given options.
-func (r *ChatroomRepository) UpdateGroupChatroom(options *model.UpdateGroupChatroom) (*model.Chatroom, error) {
+// UpdateGroupChatroom changes the metadata which is set in the options and adds the participants on behalf of the actor.
+// The result contains only the metadata which actually changed, the added participants and the system messages about them.
+func (r *ChatroomRepository) UpdateGroupChatroom(actorID uint, options *model.UpdateGroupChatroom) (*model.ChatroomUpdated, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	chatroom, err := r.UpdateGroupChatroomTx(tx, options)
+	updated, err := r.UpdateGroupChatroomTx(tx, actorID, options)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
@@ -527,28 +619,78 @@ func (r *ChatroomRepository) UpdateGroupChatroom(options *model.UpdateGroupChatr
 		return nil, err
 	}
 
-	return chatroom, nil
+	return updated, nil
 }
 
-func (r *ChatroomRepository) UpdateGroupChatroomTx(tx *sql.Tx, options *model.UpdateGroupChatroom) (*model.Chatroom, error) {
-	query := `
-		UPDATE chatrooms
-		SET group_name = $1
-		WHERE id = $2
-		RETURNING id, is_group, created_at
-	`
-	var chatroom model.Chatroom
-	err := tx.QueryRow(query, options.GroupName, options.ID).Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.CreatedAt)
+func (r *ChatroomRepository) UpdateGroupChatroomTx(tx *sql.Tx, actorID uint, options *model.UpdateGroupChatroom) (*model.ChatroomUpdated, error) {
+	// the chatroom is locked, so that the changes are compared with the values which are overwritten
+	chatroom, err := scanGroupChatroom(tx.QueryRow(`SELECT `+groupChatroomColumns+` FROM chatrooms WHERE id = $1 AND is_group = TRUE FOR UPDATE`, options.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("group chatroom with id %v not found", options.ID)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to find group chatroom: %v", err)
+	}
+
+	updated := &model.ChatroomUpdated{ChatroomID: chatroom.ID, Changes: chatroom.Apply(options.ChatroomChanges)}
+	if !updated.Changes.IsEmpty() {
+		query := `
+			UPDATE chatrooms
+			SET group_name = $2, description = $3, topic = $4, avatar_url = $5, only_admins_can_send = $6, members_can_edit_info = $7, members_can_pin = $8,
+			    is_public = $9, join_requires_approval = $10
+			WHERE id = $1
+		`
+		_, err := tx.Exec(query, chatroom.ID, chatroom.GroupName, chatroom.Description, chatroom.Topic, chatroom.AvatarURL,
+			chatroom.Settings.OnlyAdminsCanSend, chatroom.Settings.MembersCanEditInfo, chatroom.Settings.MembersCanPin, chatroom.Settings.Public, chatroom.Settings.JoinRequiresApproval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update group chatroom: %v", err)
+		}
 	}
 
 	// Add participants to the chatroom
 	usersIDs := getUsersIDs(options.Participants)
-	if err := r.AddParticipantsToChatroom(tx, chatroom.ID, usersIDs); err != nil {
+	if len(usersIDs) == 0 {
+		return updated, nil
+	}
+	addedIDs, err := r.AddParticipantsToChatroom(tx, chatroom.ID, usersIDs)
+	if err != nil {
 		return nil, err
 	}
+	updated.AddedParticipantIDs = addedIDs
+	for _, userID := range addedIDs {
+		message, err := r.addSystemMessageTx(tx, chatroom.ID, actorID, model.SystemEventMemberAdded, userID)
+		if err != nil {
+			return nil, err
+		}
+		updated.SystemMessages = append(updated.SystemMessages, message)
+	}
+
+	return updated, nil
+}
 
+const groupChatroomColumns = "id, is_group, is_channel, group_name, description, topic, avatar_url, created_at, only_admins_can_send, members_can_edit_info, members_can_pin, is_public, join_requires_approval"
+
+// FindGroupChatroom returns the metadata and settings of a group chatroom without its messages and participants. Returns nil if there is no such group chatroom.
+func (r *ChatroomRepository) FindGroupChatroom(chatroomID uint) (*model.Chatroom, error) {
+	chatroom, err := scanGroupChatroom(r.db.QueryRow(`SELECT `+groupChatroomColumns+` FROM chatrooms WHERE id = $1 AND is_group = TRUE`, chatroomID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find group chatroom: %v", err)
+	}
+	return chatroom, nil
+}
+
+func scanGroupChatroom(row rowScanner) (*model.Chatroom, error) {
+	chatroom := model.Chatroom{Settings: &model.GroupSettings{}}
+	var groupName sql.NullString
+	err := row.Scan(&chatroom.ID, &chatroom.IsGroup, &chatroom.IsChannel, &groupName, &chatroom.Description, &chatroom.Topic, &chatroom.AvatarURL, &chatroom.CreatedAt,
+		&chatroom.Settings.OnlyAdminsCanSend, &chatroom.Settings.MembersCanEditInfo, &chatroom.Settings.MembersCanPin, &chatroom.Settings.Public, &chatroom.Settings.JoinRequiresApproval)
+	if err != nil {
+		return nil, err
+	}
+	chatroom.GroupName = groupName.String
 	return &chatroom, nil
 }
 
@@ -588,44 +730,654 @@ func (r *ChatroomRepository) MarkMessageAsViewed(chatroomID, messageID, userID u
 	return message, nil
 }
 
+// MarkMessageAsViewedTx marks the message as viewed by the viewer.
+// Returns ErrParticipantNotFound if the viewer is not a participant of the chatroom or the message isn't in the chatroom.
 func (r *ChatroomRepository) MarkMessageAsViewedTx(tx *sql.Tx, chatroomID, messageID, viewerID uint) (*model.ChatMessage, error) {
 	// Insert a record into the message_views table
-	insertQuery := "INSERT INTO message_views (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
-	_, err := tx.Exec(insertQuery, messageID, viewerID)
+	insertQuery := `
+		INSERT INTO message_views (message_id, user_id)
+		SELECT $1, $2 WHERE EXISTS (SELECT 1 FROM messages WHERE id = $1 AND chatroom_id = $3)
+			AND EXISTS (SELECT 1 FROM chatroom_participants WHERE chatroom_id = $3 AND user_id = $2)
+		ON CONFLICT DO NOTHING`
+	result, err := tx.Exec(insertQuery, messageID, viewerID, chatroomID)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
 
-	// Update the unread count for the viewer
-	_, err = tx.Exec("UPDATE chatroom_participants SET unread_count = GREATEST(0, unread_count - 1) WHERE chatroom_id = $1 AND user_id = $2", chatroomID, viewerID)
+	// Update the unread count for the viewer unless the message was already viewed. Messages of muted senders weren't counted as unread.
+	if inserted > 0 {
+		_, err = tx.Exec(`
+			UPDATE chatroom_participants SET unread_count = GREATEST(0, unread_count - 1) WHERE chatroom_id = $1 AND user_id = $2
+			AND NOT EXISTS (SELECT 1 FROM messages m INNER JOIN user_mutes um ON um.muted_id = m.sender_user_id WHERE m.id = $3 AND um.muter_id = $2)`,
+			chatroomID, viewerID, messageID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Viewing a message of a chatroom which the viewer marked as unread makes it read again
+	_, err = tx.Exec("UPDATE chatroom_participants SET marked_unread = FALSE WHERE chatroom_id = $1 AND user_id = $2 AND marked_unread", chatroomID, viewerID)
 	if err != nil {
 		return nil, err
 	}
-	// Update the viewed field in the messages table and return the updated message
+	// Update the viewed field in the messages table and return the updated message. Viewers who disabled read receipts don't mark the message as viewed for the sender.
 	updateQuery := `
 		UPDATE messages 
-		SET viewed = true 
-		WHERE id = $1 
-		RETURNING id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited
+		SET viewed = viewed OR (SELECT read_receipts_enabled FROM users WHERE id = $2)
+		WHERE id = $1 AND chatroom_id = $3 AND EXISTS (SELECT 1 FROM chatroom_participants WHERE chatroom_id = $3 AND user_id = $2)
+		RETURNING ` + messageColumns + `
 	`
-	row := tx.QueryRow(updateQuery, messageID)
-
-	var message model.ChatMessage
-	var attachmentURL sql.NullString
-	err = row.Scan(&message.ID, &message.ChatroomID, &message.SenderID, &message.Text, &attachmentURL, &message.TimeStamp, &message.Viewed, &message.Deleted, &message.Edited)
+	message, err := scanMessage(tx.QueryRow(updateQuery, messageID, viewerID, chatroomID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrParticipantNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if attachmentURL.Valid {
-		message.AttachmentURL = attachmentURL.String
+	return &message, nil
+}
+
+// AreReadReceiptsEnabled checks whether the user shares and sees read receipts
+func (r *ChatroomRepository) AreReadReceiptsEnabled(userID uint) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow("SELECT read_receipts_enabled FROM users WHERE id = $1", userID).Scan(&enabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to check read receipts: %v", err)
+	}
+	return enabled, nil
+}
+
+// FindParticipantIDsWithoutReadReceipts returns the participants of the chatroom who disabled read receipts
+func (r *ChatroomRepository) FindParticipantIDsWithoutReadReceipts(chatroomID uint) ([]uint, error) {
+	query := `
+		SELECT cp.user_id FROM chatroom_participants cp
+		INNER JOIN users u ON u.id = cp.user_id
+		WHERE cp.chatroom_id = $1 AND u.read_receipts_enabled = FALSE
+	`
+	rows, err := r.db.Query(query, chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find participants without read receipts: %v", err)
+	}
+	defer rows.Close()
+
+	userIDs := []uint{}
+	for rows.Next() {
+		var userID uint
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find participants without read receipts: %v", err)
+	}
+	return userIDs, nil
+}
+
+// IsParticipant checks whether the user is a participant of the chatroom
+func (r *ChatroomRepository) IsParticipant(chatroomID, userID uint) (bool, error) {
+	var isParticipant bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM chatroom_participants WHERE chatroom_id = $1 AND user_id = $2)", chatroomID, userID).Scan(&isParticipant)
+	if err != nil {
+		return false, fmt.Errorf("failed to check chatroom participant: %v", err)
 	}
+	return isParticipant, nil
+}
+
+// CanSendMessage checks whether the user is a participant of the chatroom who may send messages. Only owners and admins can send messages to channels and groups which restrict sending.
+func (r *ChatroomRepository) CanSendMessage(chatroomID, userID uint) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM chatroom_participants cp
+			INNER JOIN chatrooms c ON c.id = cp.chatroom_id
+			WHERE cp.chatroom_id = $1 AND cp.user_id = $2 AND (NOT c.is_group OR NOT (c.only_admins_can_send OR c.is_channel) OR cp.role IN ($3, $4))
+		)
+	`
+	var canSend bool
+	err := r.db.QueryRow(query, chatroomID, userID, model.ChatroomRoleOwner, model.ChatroomRoleAdmin).Scan(&canSend)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether participant can send messages: %v", err)
+	}
+	return canSend, nil
+}
+
+// PublicChatroomCursor is the position of the last chatroom of a directory page. Name is lower cased.
+type PublicChatroomCursor struct {
+	Name string `json:"n"`
+	ID   uint   `json:"i"`
+}
+
+// FindPublicChatroomsPage returns up to limit public chatrooms whose name or description contain the search term, ordered by name and starting after the cursor if given.
+// An empty term matches all public chatrooms. Chatrooms which aren't public are never included.
+func (r *ChatroomRepository) FindPublicChatroomsPage(term string, after *PublicChatroomCursor, limit int) ([]model.PublicChatroom, error) {
+	conditions := []string{"c.is_public"}
+	args := []interface{}{}
+	addArg := func(arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if term != "" {
+		// LIKE with a leading wildcard is served by the trigram index
+		conditions = append(conditions, "LOWER(c.group_name || ' ' || c.description) LIKE '%' || "+addArg(escapeLike(strings.ToLower(term)))+" || '%'")
+	}
+	if after != nil {
+		conditions = append(conditions, fmt.Sprintf("(LOWER(c.group_name), c.id) > (%v, %v)", addArg(after.Name), addArg(after.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT c.id, c.group_name, c.description, c.topic, c.avatar_url, c.is_channel, c.join_requires_approval, %v, c.created_at
+		FROM chatrooms c
+		WHERE %v
+		ORDER BY LOWER(c.group_name), c.id
+		LIMIT %v
+	`, subscriberCountColumn, strings.Join(conditions, " AND "), addArg(limit))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find public chatrooms: %v", err)
+	}
+	defer rows.Close()
+
+	chatrooms := []model.PublicChatroom{}
+	for rows.Next() {
+		var chatroom model.PublicChatroom
+		err := rows.Scan(&chatroom.ID, &chatroom.GroupName, &chatroom.Description, &chatroom.Topic, &chatroom.AvatarURL, &chatroom.IsChannel, &chatroom.JoinRequiresApproval,
+			&chatroom.MemberCount, &chatroom.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan public chatroom: %v", err)
+		}
+		chatrooms = append(chatrooms, chatroom)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find public chatrooms: %v", err)
+	}
+	return chatrooms, nil
+}
+
+// FindParticipantIDsWithRoles returns the participants of the group chatroom who have one of the roles
+func (r *ChatroomRepository) FindParticipantIDsWithRoles(chatroomID uint, roles ...string) ([]uint, error) {
+	rows, err := r.db.Query("SELECT user_id FROM chatroom_participants WHERE chatroom_id = $1 AND role = ANY($2)", chatroomID, pq.Array(roles))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find participants by role: %v", err)
+	}
+	defer rows.Close()
+
+	userIDs := []uint{}
+	for rows.Next() {
+		var userID uint
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// subscriberCountColumn is the number of participants of the chatroom c
+const subscriberCountColumn = "(SELECT COUNT(*) FROM chatroom_participants WHERE chatroom_id = c.id)"
+
+// unreadCountColumn is the unread count of the participant cp in the chatroom c. Channels count the messages after the read cursor which were sent since the subscriber joined.
+const unreadCountColumn = `CASE WHEN c.is_channel THEN (
+			SELECT COUNT(*) FROM messages m
+			WHERE m.chatroom_id = c.id AND m.id > cp.last_read_message_id AND m.timestamp > cp.joined_at AND m.kind = 'USER' AND m.sender_user_id != cp.user_id
+		) ELSE cp.unread_count END`
+
+// IsChannel checks whether the chatroom is a channel
+func (r *ChatroomRepository) IsChannel(chatroomID uint) (bool, error) {
+	var isChannel bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM chatrooms WHERE id = $1 AND is_channel)", chatroomID).Scan(&isChannel)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether chatroom is a channel: %v", err)
+	}
+	return isChannel, nil
+}
 
+// AdvanceReadCursor marks the messages of the channel up to the given message as read by the subscriber and returns the message with its views.
+// The cursor never moves back. Returns ErrParticipantNotFound if the user is not a subscriber or the message isn't in the channel.
+func (r *ChatroomRepository) AdvanceReadCursor(chatroomID, messageID, userID uint) (*model.ChatMessage, error) {
+	result, err := r.db.Exec(`
+		UPDATE chatroom_participants SET last_read_message_id = GREATEST(last_read_message_id, $3), marked_unread = FALSE
+		WHERE chatroom_id = $1 AND user_id = $2 AND EXISTS (SELECT 1 FROM messages WHERE id = $3 AND chatroom_id = $1)`,
+		chatroomID, userID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to advance read cursor: %v", err)
+	}
+	if err := expectParticipantUpdated(result); err != nil {
+		return nil, err
+	}
+	views, err := r.FindChannelViews(chatroomID, []uint{messageID})
+	if err != nil {
+		return nil, err
+	}
+	message, err := scanMessage(r.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = $1", messageID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find message: %v", err)
+	}
+	message.Views = views[messageID]
 	return &message, nil
 }
 
+// FindChannelViews returns the number of subscribers other than the sender who read each of the messages of the channel
+func (r *ChatroomRepository) FindChannelViews(chatroomID uint, messageIDs []uint) (map[uint]int, error) {
+	query := `
+		SELECT m.id, COUNT(cp.user_id)
+		FROM messages m
+		LEFT JOIN chatroom_participants cp ON cp.chatroom_id = m.chatroom_id AND cp.last_read_message_id >= m.id AND cp.user_id != m.sender_user_id
+		WHERE m.chatroom_id = $1 AND m.id = ANY($2)
+		GROUP BY m.id
+	`
+	rows, err := r.db.Query(query, chatroomID, pq.Array(toInt64s(messageIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channel views: %v", err)
+	}
+	defer rows.Close()
+
+	views := make(map[uint]int, len(messageIDs))
+	for rows.Next() {
+		var messageID uint
+		var count int
+		if err := rows.Scan(&messageID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan channel views: %v", err)
+		}
+		views[messageID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find channel views: %v", err)
+	}
+	return views, nil
+}
+
+// userSettingsColumns are the columns of the settings of a chatroom for a participant, scanned with chatroomUserSettingsRow
+const userSettingsColumns = "cp.archived, cp.muted_until, cp.pinned_at, cp.marked_unread"
+
+type chatroomUserSettingsRow struct {
+	archived     bool
+	mutedUntil   sql.NullTime
+	pinnedAt     sql.NullTime
+	markedUnread bool
+}
+
+// toModel returns the settings without the mute if it has expired
+func (s chatroomUserSettingsRow) toModel() model.ChatroomUserSettings {
+	settings := model.ChatroomUserSettings{Archived: s.archived, MarkedUnread: s.markedUnread}
+	if s.mutedUntil.Valid && s.mutedUntil.Time.After(time.Now()) {
+		settings.MutedUntil = &s.mutedUntil.Time
+	}
+	if s.pinnedAt.Valid {
+		settings.PinnedAt = &s.pinnedAt.Time
+	}
+	return settings
+}
+
+// FindUserSettings returns the settings of the chatroom for the participant. Returns ErrParticipantNotFound if the user is not a participant.
+func (r *ChatroomRepository) FindUserSettings(chatroomID, userID uint) (*model.ChatroomUserSettings, error) {
+	query := "SELECT " + userSettingsColumns + " FROM chatroom_participants cp WHERE cp.chatroom_id = $1 AND cp.user_id = $2"
+	var row chatroomUserSettingsRow
+	err := r.db.QueryRow(query, chatroomID, userID).Scan(&row.archived, &row.mutedUntil, &row.pinnedAt, &row.markedUnread)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrParticipantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chatroom settings of user: %v", err)
+	}
+	settings := row.toModel()
+	return &settings, nil
+}
+
+// UpdateUserSettings changes the settings of the chatroom for the participant and returns the new settings.
+// Pinning an already pinned chatroom keeps its position. Returns ErrParticipantNotFound if the user is not a participant.
+func (r *ChatroomRepository) UpdateUserSettings(chatroomID, userID uint, changes model.ChatroomUserSettingsChanges) (*model.ChatroomUserSettings, error) {
+	query := `
+		UPDATE chatroom_participants cp SET
+			archived = COALESCE($3, cp.archived),
+			muted_until = CASE WHEN $4::timestamptz IS NULL THEN cp.muted_until WHEN $4::timestamptz > NOW() THEN $4::timestamptz END,
+			pinned_at = CASE WHEN $5::boolean IS NULL THEN cp.pinned_at WHEN $5::boolean THEN COALESCE(cp.pinned_at, NOW()) END,
+			marked_unread = COALESCE($6, cp.marked_unread)
+		WHERE cp.chatroom_id = $1 AND cp.user_id = $2
+		RETURNING ` + userSettingsColumns + `
+	`
+	var row chatroomUserSettingsRow
+	err := r.db.QueryRow(query, chatroomID, userID, changes.Archived, changes.MutedUntil, changes.Pinned, changes.MarkedUnread).
+		Scan(&row.archived, &row.mutedUntil, &row.pinnedAt, &row.markedUnread)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrParticipantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update chatroom settings of user: %v", err)
+	}
+	settings := row.toModel()
+	return &settings, nil
+}
+
+// FindChatroomIDsByUserID returns the IDs of all chatrooms the user participates in
+func (r *ChatroomRepository) FindChatroomIDsByUserID(userID uint) ([]uint, error) {
+	rows, err := r.db.Query("SELECT chatroom_id FROM chatroom_participants WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chatrooms of user: %v", err)
+	}
+	defer rows.Close()
+
+	chatroomIDs := []uint{}
+	for rows.Next() {
+		var chatroomID uint
+		if err := rows.Scan(&chatroomID); err != nil {
+			return nil, err
+		}
+		chatroomIDs = append(chatroomIDs, chatroomID)
+	}
+	return chatroomIDs, rows.Err()
+}
+
 func (r *ChatroomRepository) GetUnreadCount(chatroomID, userID uint) (int, error) {
 	var count int
 	err := r.db.QueryRow("SELECT COUNT(*) FROM messages WHERE chatroom_id = $1 AND id NOT IN (SELECT message_id FROM message_views WHERE user_id = $2)", chatroomID, userID).Scan(&count)
 	return count, err
 }
+
+// FindGroupParticipantRole returns the role of the user in the group chatroom. Returns an empty string if the chatroom is not a group or the user is not a participant.
+func (r *ChatroomRepository) FindGroupParticipantRole(chatroomID, userID uint) (string, error) {
+	query := `
+		SELECT cp.role FROM chatroom_participants cp
+		INNER JOIN chatrooms c ON c.id = cp.chatroom_id
+		WHERE cp.chatroom_id = $1 AND cp.user_id = $2 AND c.is_group = TRUE
+	`
+	var role string
+	err := r.db.QueryRow(query, chatroomID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find participant role: %v", err)
+	}
+	return role, nil
+}
+
+// UpdateParticipantRole changes the role of a participant who is not the owner of the chatroom.
+// Returns ErrParticipantNotFound if the user is not a participant or is the owner.
+func (r *ChatroomRepository) UpdateParticipantRole(chatroomID, userID uint, role string) error {
+	result, err := r.db.Exec("UPDATE chatroom_participants SET role = $3 WHERE chatroom_id = $1 AND user_id = $2 AND role <> $4",
+		chatroomID, userID, role, model.ChatroomRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to update participant role: %v", err)
+	}
+	return expectParticipantUpdated(result)
+}
+
+// TransferOwnership makes the new owner the owner of the chatroom and the previous owner an admin
+func (r *ChatroomRepository) TransferOwnership(chatroomID, ownerID, newOwnerID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = r.TransferOwnershipTx(tx, chatroomID, ownerID, newOwnerID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TransferOwnershipTx transfers the ownership of the chatroom in a transaction.
+// Returns ErrParticipantNotFound if the owner is not the owner anymore or the new owner is not a participant.
+func (r *ChatroomRepository) TransferOwnershipTx(tx *sql.Tx, chatroomID, ownerID, newOwnerID uint) error {
+	// the previous owner is demoted first, because a chatroom can only have one owner
+	result, err := tx.Exec("UPDATE chatroom_participants SET role = $3 WHERE chatroom_id = $1 AND user_id = $2 AND role = $4",
+		chatroomID, ownerID, model.ChatroomRoleAdmin, model.ChatroomRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to demote owner: %v", err)
+	}
+	if err := expectParticipantUpdated(result); err != nil {
+		return err
+	}
+	result, err = tx.Exec("UPDATE chatroom_participants SET role = $3 WHERE chatroom_id = $1 AND user_id = $2",
+		chatroomID, newOwnerID, model.ChatroomRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to promote new owner: %v", err)
+	}
+	return expectParticipantUpdated(result)
+}
+
+// DeleteGroupChatroom deletes a group chatroom with its messages and returns the IDs of its participants
+func (r *ChatroomRepository) DeleteGroupChatroom(chatroomID uint) ([]uint, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	participantIDs, err := r.DeleteGroupChatroomTx(tx, chatroomID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return participantIDs, nil
+}
+
+func (r *ChatroomRepository) DeleteGroupChatroomTx(tx *sql.Tx, chatroomID uint) ([]uint, error) {
+	rows, err := tx.Query("DELETE FROM chatroom_participants WHERE chatroom_id = $1 RETURNING user_id", chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete chatroom participants: %v", err)
+	}
+	participantIDs := []uint{}
+	for rows.Next() {
+		var userID uint
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan participant: %v", err)
+		}
+		participantIDs = append(participantIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete chatroom participants: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM message_views WHERE message_id IN (SELECT id FROM messages WHERE chatroom_id = $1)", chatroomID); err != nil {
+		return nil, fmt.Errorf("failed to delete message views: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE chatroom_id = $1", chatroomID); err != nil {
+		return nil, fmt.Errorf("failed to delete messages: %v", err)
+	}
+	result, err := tx.Exec("DELETE FROM chatrooms WHERE id = $1 AND is_group = TRUE", chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete chatroom: %v", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return nil, fmt.Errorf("group chatroom %v not found", chatroomID)
+	}
+	return participantIDs, nil
+}
+
+// expectParticipantUpdated returns ErrParticipantNotFound if the statement didn't update any participant
+func expectParticipantUpdated(result sql.Result) error {
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update participant: %v", err)
+	}
+	if updated == 0 {
+		return ErrParticipantNotFound
+	}
+	return nil
+}
+
+// RemoveParticipant removes a participant from a group chatroom on behalf of the actor, who is the participant when leaving.
+// Returns ErrParticipantNotFound if the user is not a participant.
+func (r *ChatroomRepository) RemoveParticipant(chatroomID, userID, actorID uint) (*model.MembershipChange, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := r.RemoveParticipantTx(tx, chatroomID, userID, actorID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// RemoveParticipantTx removes a participant in a transaction and adds a system message about it. If the owner leaves, the
+// longest standing admin or otherwise member becomes the owner. The chatroom is deleted when its last participant leaves.
+func (r *ChatroomRepository) RemoveParticipantTx(tx *sql.Tx, chatroomID, userID, actorID uint) (*model.MembershipChange, error) {
+	var role string
+	err := tx.QueryRow("DELETE FROM chatroom_participants WHERE chatroom_id = $1 AND user_id = $2 RETURNING role", chatroomID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrParticipantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove participant: %v", err)
+	}
+
+	var remaining int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM chatroom_participants WHERE chatroom_id = $1", chatroomID).Scan(&remaining); err != nil {
+		return nil, fmt.Errorf("failed to count participants: %v", err)
+	}
+	if remaining == 0 {
+		if _, err := r.DeleteGroupChatroomTx(tx, chatroomID); err != nil {
+			return nil, err
+		}
+		return &model.MembershipChange{}, nil
+	}
+
+	event := model.SystemEventMemberRemoved
+	if actorID == userID {
+		event = model.SystemEventMemberLeft
+	}
+	message, err := r.addSystemMessageTx(tx, chatroomID, actorID, event, userID)
+	if err != nil {
+		return nil, err
+	}
+	change := &model.MembershipChange{SystemMessage: &message}
+
+	if role == model.ChatroomRoleOwner {
+		newOwners, err := promoteOwnerSuccessorsTx(tx, []uint{chatroomID})
+		if err != nil {
+			return nil, err
+		}
+		change.NewOwnerID = newOwners[chatroomID]
+	}
+	return change, nil
+}
+
+// addSystemMessageTx adds a system message about a membership change of the user, sent by the actor. System messages don't count as unread.
+func (r *ChatroomRepository) addSystemMessageTx(tx *sql.Tx, chatroomID, actorID uint, event string, userID uint) (model.ChatMessage, error) {
+	var actorName, userName string
+	err := tx.QueryRow("SELECT (SELECT nickname FROM users WHERE id = $1), (SELECT nickname FROM users WHERE id = $2)", actorID, userID).Scan(&actorName, &userName)
+	if err != nil {
+		return model.ChatMessage{}, fmt.Errorf("failed to find names for system message: %v", err)
+	}
+	query := `
+		INSERT INTO messages (chatroom_id, sender_user_id, text, kind, system_event, system_user_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + messageColumns + `
+	`
+	message, err := scanMessage(tx.QueryRow(query, chatroomID, actorID, systemMessageText(event, actorName, userName), model.ChatMessageKindSystem, event, userID))
+	if err != nil {
+		return model.ChatMessage{}, fmt.Errorf("failed to add system message: %v", err)
+	}
+	return message, nil
+}
+
+// systemMessageText is the text of a system message for clients which don't render the system event themselves
+func systemMessageText(event, actorName, userName string) string {
+	switch event {
+	case model.SystemEventMemberAdded:
+		return fmt.Sprintf("%v added %v", actorName, userName)
+	case model.SystemEventMemberRemoved:
+		return fmt.Sprintf("%v removed %v", actorName, userName)
+	case model.SystemEventMemberLeft:
+		return fmt.Sprintf("%v left", userName)
+	case model.SystemEventMemberJoined:
+		return fmt.Sprintf("%v joined", userName)
+	}
+	return ""
+}
+
+// promoteOwnerSuccessorsTx makes the longest standing admin, or otherwise member, the owner of those of the group chatrooms which have no owner.
+// Returns the new owners by chatroom ID.
+func promoteOwnerSuccessorsTx(tx *sql.Tx, chatroomIDs []uint) (map[uint]uint, error) {
+	query := `
+		UPDATE chatroom_participants cp SET role = $2
+		FROM (
+			SELECT DISTINCT ON (cp.chatroom_id) cp.chatroom_id, cp.user_id
+			FROM chatroom_participants cp
+			INNER JOIN chatrooms c ON c.id = cp.chatroom_id
+			WHERE cp.chatroom_id = ANY($1) AND c.is_group = TRUE
+			  AND NOT EXISTS (SELECT 1 FROM chatroom_participants o WHERE o.chatroom_id = cp.chatroom_id AND o.role = $2)
+			ORDER BY cp.chatroom_id, cp.role = $3 DESC, cp.joined_at, cp.user_id
+		) successors
+		WHERE cp.chatroom_id = successors.chatroom_id AND cp.user_id = successors.user_id
+		RETURNING cp.chatroom_id, cp.user_id
+	`
+	rows, err := tx.Query(query, pq.Array(toInt64s(chatroomIDs)), model.ChatroomRoleOwner, model.ChatroomRoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to promote new owners: %v", err)
+	}
+	defer rows.Close()
+
+	newOwners := map[uint]uint{}
+	for rows.Next() {
+		var chatroomID, userID uint
+		if err := rows.Scan(&chatroomID, &userID); err != nil {
+			return nil, fmt.Errorf("failed to scan new owner: %v", err)
+		}
+		newOwners[chatroomID] = userID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to promote new owners: %v", err)
+	}
+	return newOwners, nil
+}
+
+// messageColumns are the columns of the messages table read by scanMessage
+const messageColumns = "id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited, kind, system_event, system_user_id"
+
+// scanMessage scans a row selected with messageColumns
+func scanMessage(row rowScanner) (model.ChatMessage, error) {
+	var message model.ChatMessage
+	var attachmentURL sql.NullString
+	var system systemEventRow
+	err := row.Scan(&message.ID, &message.ChatroomID, &message.SenderID, &message.Text, &attachmentURL, &message.TimeStamp, &message.Viewed, &message.Deleted, &message.Edited,
+		&message.Kind, &system.event, &system.userID)
+	if err != nil {
+		return model.ChatMessage{}, err
+	}
+	message.AttachmentURL = attachmentURL.String
+	message.SystemEvent = system.toModel()
+	return message, nil
+}
+
+// systemEventRow holds the nullable system event columns of a message
+type systemEventRow struct {
+	event  sql.NullString
+	userID sql.NullInt64
+}
+
+func (s systemEventRow) toModel() *model.SystemEvent {
+	if !s.event.Valid {
+		return nil
+	}
+	return &model.SystemEvent{Type: s.event.String, UserID: uint(s.userID.Int64)}
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"backend/pkg/model"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -21,15 +22,18 @@ func TestMarkMessageAsViewed(t *testing.T) {
 	// Prepare the mock database for the expected query
 	timestamp := time.Now()
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO message_views").WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO message_views \\(message_id, user_id\\) SELECT \\$1, \\$2 WHERE EXISTS").WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec("UPDATE chatroom_participants SET unread_count = GREATEST\\(0, unread_count - 1\\) WHERE chatroom_id = \\$1 AND user_id = \\$2").
-		WithArgs(1, 1).
+		WithArgs(1, 1, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectQuery("UPDATE messages SET viewed = true WHERE id = \\$1 RETURNING id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited").
-		WithArgs(1).
+	mock.ExpectExec("UPDATE chatroom_participants SET marked_unread = FALSE WHERE chatroom_id = \\$1 AND user_id = \\$2 AND marked_unread").
+		WithArgs(1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("UPDATE messages SET viewed = viewed OR \\(SELECT read_receipts_enabled FROM users WHERE id = \\$2\\) WHERE id = \\$1 AND chatroom_id = \\$3 AND EXISTS (.+) RETURNING id, chatroom_id, sender_user_id, text, attachment_url, timestamp, viewed, deleted, edited, kind, system_event, system_user_id").
+		WithArgs(1, 1, 1).
 		WillReturnRows(sqlmock.NewRows(
-			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited"},
-		).AddRow(1, 1, 1, "Hello world!", nil, timestamp, true, false, false))
+			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"},
+		).AddRow(1, 1, 1, "Hello world!", nil, timestamp, true, false, false, "USER", nil, nil))
 	mock.ExpectCommit()
 
 	// Call the method and check the result getting converted to a ChatMessage
@@ -42,4 +46,350 @@ func TestMarkMessageAsViewed(t *testing.T) {
 	assert.Equal(t, timestamp, message.TimeStamp)
 	assert.Equal(t, "Hello world!", message.Text)
 	assert.True(t, message.Viewed)
+	assert.Equal(t, "USER", message.Kind)
+	assert.Nil(t, message.SystemEvent)
+}
+
+func TestMarkMessageAsViewedOutsideChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// A message of another chatroom is neither viewed nor returned
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO message_views").WithArgs(8, 1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE chatroom_participants SET marked_unread = FALSE").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("UPDATE messages SET viewed").WithArgs(8, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"}))
+	mock.ExpectRollback()
+
+	message, err := repo.MarkMessageAsViewed(2, 8, 1)
+	assert.ErrorIs(t, err, ErrParticipantNotFound)
+	assert.Nil(t, message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferOwnership(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// The owner is demoted before the new owner is promoted, because a chatroom can only have one owner
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE chatroom_participants SET role = \\$3 WHERE chatroom_id = \\$1 AND user_id = \\$2 AND role = \\$4").
+		WithArgs(1, 2, "ADMIN", "OWNER").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE chatroom_participants SET role = \\$3 WHERE chatroom_id = \\$1 AND user_id = \\$2").
+		WithArgs(1, 3, "OWNER").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.TransferOwnership(1, 2, 3))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Nothing changes if the new owner is not a participant
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE chatroom_participants SET role = \\$3 WHERE chatroom_id = \\$1 AND user_id = \\$2 AND role = \\$4").
+		WithArgs(1, 2, "ADMIN", "OWNER").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE chatroom_participants SET role = \\$3 WHERE chatroom_id = \\$1 AND user_id = \\$2").
+		WithArgs(1, 4, "OWNER").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, repo.TransferOwnership(1, 2, 4), ErrParticipantNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveParticipant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// The owner leaves: a system message is added and the longest standing admin or member becomes the owner
+	timestamp := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM chatroom_participants WHERE chatroom_id = \\$1 AND user_id = \\$2 RETURNING role").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("OWNER"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM chatroom_participants").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT \\(SELECT nickname FROM users WHERE id = \\$1\\), \\(SELECT nickname FROM users WHERE id = \\$2\\)").
+		WithArgs(2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"actor", "user"}).AddRow("Alice", "Alice"))
+	mock.ExpectQuery("INSERT INTO messages \\(chatroom_id, sender_user_id, text, kind, system_event, system_user_id\\)").
+		WithArgs(1, 2, "Alice left", "SYSTEM", "MEMBER_LEFT", 2).
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"},
+		).AddRow(9, 1, 2, "Alice left", nil, timestamp, false, false, false, "SYSTEM", "MEMBER_LEFT", 2))
+	mock.ExpectQuery("UPDATE chatroom_participants cp SET role = \\$2").
+		WithArgs(sqlmock.AnyArg(), "OWNER", "ADMIN").
+		WillReturnRows(sqlmock.NewRows([]string{"chatroom_id", "user_id"}).AddRow(1, 5))
+	mock.ExpectCommit()
+
+	change, err := repo.RemoveParticipant(1, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), change.NewOwnerID)
+	assert.Equal(t, "SYSTEM", change.SystemMessage.Kind)
+	assert.Equal(t, &model.SystemEvent{Type: "MEMBER_LEFT", UserID: 2}, change.SystemMessage.SystemEvent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateGroupChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// Only the fields which are set and differ from the current values are in the changes
+	groupName, topic, onlyAdminsCanSend := "Hikers", "Next trip: Saturday", true
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM chatrooms WHERE id = \\$1 AND is_group = TRUE FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "is_group", "is_channel", "group_name", "description", "topic", "avatar_url", "created_at", "only_admins_can_send", "members_can_edit_info", "members_can_pin", "is_public", "join_requires_approval"},
+		).AddRow(1, true, false, "Hikers", "We hike", "", "", time.Now(), false, false, false, true, false))
+	mock.ExpectExec("UPDATE chatrooms SET group_name = \\$2, description = \\$3, topic = \\$4, avatar_url = \\$5, only_admins_can_send = \\$6, members_can_edit_info = \\$7, members_can_pin = \\$8, is_public = \\$9, join_requires_approval = \\$10 WHERE id = \\$1").
+		WithArgs(1, "Hikers", "We hike", "Next trip: Saturday", "", true, false, false, true, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	updated, err := repo.UpdateGroupChatroom(2, &model.UpdateGroupChatroom{
+		ID: 1,
+		ChatroomChanges: model.ChatroomChanges{
+			GroupName: &groupName,
+			Topic:     &topic,
+			Settings:  &model.GroupSettingsChanges{OnlyAdminsCanSend: &onlyAdminsCanSend},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Changes.GroupName)
+	assert.Nil(t, updated.Changes.Description)
+	assert.Equal(t, "Next trip: Saturday", *updated.Changes.Topic)
+	assert.Equal(t, &model.GroupSettingsChanges{OnlyAdminsCanSend: &onlyAdminsCanSend}, updated.Changes.Settings)
+	assert.Empty(t, updated.AddedParticipantIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePrivateChatroomWithExistingChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// The users are ordered, the insert conflicts with their existing chatroom and the message is added to it
+	timestamp := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO chatrooms \\(is_group, private_user1_id, private_user2_id\\) VALUES \\(false, \\$1, \\$2\\) ON CONFLICT").
+		WithArgs(3, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_group", "created_at"}))
+	mock.ExpectQuery("SELECT id, is_group, created_at FROM chatrooms WHERE private_user1_id = \\$1 AND private_user2_id = \\$2").
+		WithArgs(3, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_group", "created_at"}).AddRow(5, false, timestamp))
+	mock.ExpectQuery("SELECT is_channel FROM chatrooms WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"is_channel"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO messages").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"},
+		).AddRow(9, 5, 7, "Hi again", nil, timestamp, false, false, false, "USER", nil, nil))
+	mock.ExpectExec("INSERT INTO message_views \\(message_id, user_id\\) SELECT").
+		WithArgs(9, 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE chatroom_participants SET unread_count = unread_count \\+ 1").
+		WithArgs(5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	createOptions := &model.CreatePrivateChatroom{
+		Participants: [2]model.User{{ID: 7}, {ID: 3}},
+		ChatMessage:  model.ChatMessage{SenderID: 7, Text: "Hi again"},
+	}
+	chatroom, err := repo.CreatePrivateChatroomWithCreateOptions(7, createOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), chatroom.ID)
+	assert.True(t, createOptions.Existing)
+	assert.Equal(t, uint(9), chatroom.Messages[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Another user can't add a message to the existing chatroom of the pair, even as one of them
+	createOptions = &model.CreatePrivateChatroom{
+		Participants: [2]model.User{{ID: 7}, {ID: 3}},
+		ChatMessage:  model.ChatMessage{SenderID: 7, Text: "Hi again"},
+	}
+	_, err = repo.CreatePrivateChatroomWithCreateOptions(4, createOptions)
+	assert.ErrorIs(t, err, ErrNotPrivateChatroomParticipant)
+	assert.False(t, createOptions.Existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserSettings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// Only the settings which are set change and an expired mute isn't returned
+	pinnedAt := time.Now()
+	archived, pinned := true, true
+	mock.ExpectQuery("UPDATE chatroom_participants cp SET (.+) WHERE cp.chatroom_id = \\$1 AND cp.user_id = \\$2 RETURNING cp.archived, cp.muted_until, cp.pinned_at, cp.marked_unread").
+		WithArgs(1, 2, true, nil, true, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"archived", "muted_until", "pinned_at", "marked_unread"}).AddRow(true, pinnedAt.Add(-time.Hour), pinnedAt, false))
+
+	settings, err := repo.UpdateUserSettings(1, 2, model.ChatroomUserSettingsChanges{Archived: &archived, Pinned: &pinned})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ChatroomUserSettings{Archived: true, PinnedAt: &pinnedAt}, settings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Users who are not participants don't have settings
+	mock.ExpectQuery("UPDATE chatroom_participants cp SET").
+		WithArgs(1, 3, true, nil, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"archived", "muted_until", "pinned_at", "marked_unread"}))
+
+	_, err = repo.UpdateUserSettings(1, 3, model.ChatroomUserSettingsChanges{Archived: &archived})
+	assert.ErrorIs(t, err, ErrParticipantNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddMessageToChannel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// Posts to channels don't insert views or update unread counts of the subscribers
+	timestamp := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_channel FROM chatrooms WHERE id = \\$1").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"is_channel"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO messages").
+		WithArgs(4, 2, "Office closed on Friday", "").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"},
+		).AddRow(11, 4, 2, "Office closed on Friday", nil, timestamp, false, false, false, "USER", nil, nil))
+	mock.ExpectCommit()
+
+	message, err := repo.AddMessageToChatroom(4, model.ChatMessage{SenderID: 2, Text: "Office closed on Friday"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(11), message.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	chatroomColumns := []string{"id", "is_group", "group_name", "created_at", "description", "topic", "avatar_url", "only_admins_can_send", "members_can_edit_info", "members_can_pin",
+		"is_public", "join_requires_approval", "is_channel", "subscriber_count"}
+	createdAt := time.Now()
+
+	// A group without messages lists each participant once
+	mock.ExpectQuery("SELECT c.id, c.is_group, (.+) FROM chatrooms c WHERE c.id = \\$1").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(chatroomColumns).AddRow(3, true, "Team", createdAt, "", "", "", false, false, false, false, false, false, 2))
+	mock.ExpectQuery("SELECT u.id, u.nickname, (.+) WHERE cp.chatroom_id = \\$1").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "nickname", "email", "avatar_url", "created_at", "status_emoji", "status_text", "status_expires_at", "role"}).
+			AddRow(1, "alice", "alice@example.com", "", createdAt, "", "", nil, "OWNER").
+			AddRow(2, "bob", "bob@example.com", "", createdAt, "", "", nil, "MEMBER"))
+	mock.ExpectQuery("FROM messages WHERE chatroom_id = \\$1").
+		WithArgs(3, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"}))
+
+	chatroom, err := repo.FindByID(3, 1, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, "Team", chatroom.GroupName)
+	assert.Len(t, chatroom.Participants, 2)
+	assert.Empty(t, chatroom.Messages)
+
+	// Channels only have the subscriber count
+	mock.ExpectQuery("SELECT c.id, c.is_group, (.+) FROM chatrooms c WHERE c.id = \\$1").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(chatroomColumns).AddRow(4, true, "News", createdAt, "", "", "", true, false, false, true, false, true, 350))
+	mock.ExpectQuery("FROM messages WHERE chatroom_id = \\$1").
+		WithArgs(4, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"}).
+			AddRow(11, 4, 1, "Office closed on Friday", nil, createdAt, false, false, false, "USER", nil, nil))
+
+	chatroom, err = repo.FindByID(4, 2, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 350, chatroom.SubscriberCount)
+	assert.Nil(t, chatroom.Participants)
+	assert.Len(t, chatroom.Messages, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindChatroomsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+	columns := []string{
+		"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id",
+		"id", "is_group", "group_name", "created_at", "description", "topic", "avatar_url", "only_admins_can_send", "members_can_edit_info", "members_can_pin",
+		"is_public", "join_requires_approval", "is_channel", "participant_count", "unread_count",
+		"archived", "muted_until", "pinned_at", "marked_unread",
+		"other_id", "other_nickname", "other_email", "other_avatar_url",
+	}
+	createdAt := time.Now().Add(-time.Hour)
+	sentAt := time.Now()
+	after := ChatListCursor{Time: sentAt.Add(time.Minute), ID: 9}
+
+	// The page starts after the cursor and has the last message and the other participant of private chatrooms in the same query
+	mock.ExpectQuery("SELECT (.+) FROM chatroom_participants cp INNER JOIN chatrooms c ON c.id = cp.chatroom_id LEFT JOIN LATERAL (.+) WHERE cp.user_id = \\$1 (.+) LIMIT \\$7").
+		WithArgs(7, false, false, false, after.Time, 9, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(21, 3, 8, "See you", nil, sentAt, true, false, false, "USER", nil, nil,
+				3, false, nil, createdAt, "", "", "", false, false, false, false, false, false, 2, 1, false, nil, nil, false,
+				8, "Alice", "alice@example.com", "").
+			AddRow(0, 0, 0, "", nil, createdAt, false, false, false, "USER", nil, nil,
+				5, true, "Team", createdAt, "", "", "", false, false, false, false, false, false, 4, 0, false, nil, nil, false,
+				nil, nil, nil, nil))
+
+	chatrooms, err := repo.FindChatroomsByUserID(7, model.ChatroomFilter{}, &after, 2)
+	assert.NoError(t, err)
+	assert.Len(t, chatrooms, 2)
+	assert.Equal(t, "See you", chatrooms[0].LastMessage.Text)
+	assert.Equal(t, sentAt, chatrooms[0].LastActivityAt)
+	assert.Equal(t, "Alice", chatrooms[0].OtherParticipant.Nickname)
+	assert.Equal(t, 2, chatrooms[0].ParticipantCount)
+	assert.Nil(t, chatrooms[1].LastMessage)
+	assert.Nil(t, chatrooms[1].OtherParticipant)
+	assert.Equal(t, createdAt, chatrooms[1].LastActivityAt)
+	assert.Equal(t, ChatListCursor{Time: createdAt, ID: 5}, NewChatListCursor(chatrooms[1]))
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrContactRequestExists is returned when a pending request from the sender to the recipient already exists
+var ErrContactRequestExists = errors.New("a pending contact request already exists")
+
+type ContactRepository struct {
+	db *sql.DB
+}
+
+func NewContactRepository(db *sql.DB) *ContactRepository {
+	return &ContactRepository{db: db}
+}
+
+const contactRequestColumns = "id, sender_id, recipient_id, status, created_at, responded_at"
+
+// CreateRequest creates a pending contact request
+func (r *ContactRepository) CreateRequest(senderID, recipientID uint) (*model.ContactRequest, error) {
+	query := `INSERT INTO contact_requests (sender_id, recipient_id) VALUES ($1, $2) RETURNING ` + contactRequestColumns
+	request, err := scanContactRequest(r.db.QueryRow(query, senderID, recipientID))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrContactRequestExists
+		}
+		return nil, fmt.Errorf("failed to create contact request: %v", err)
+	}
+	return request, nil
+}
+
+// FindRequestByID finds a contact request. Returns nil if the request is not found.
+func (r *ContactRepository) FindRequestByID(requestID uint) (*model.ContactRequest, error) {
+	request, err := scanContactRequest(r.db.QueryRow(`SELECT `+contactRequestColumns+` FROM contact_requests WHERE id = $1`, requestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return request, err
+}
+
+// FindPendingRequest finds the pending contact request from the sender to the recipient. Returns nil if there is none.
+func (r *ContactRepository) FindPendingRequest(senderID, recipientID uint) (*model.ContactRequest, error) {
+	query := `SELECT ` + contactRequestColumns + ` FROM contact_requests WHERE sender_id = $1 AND recipient_id = $2 AND status = 'PENDING'`
+	request, err := scanContactRequest(r.db.QueryRow(query, senderID, recipientID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return request, err
+}
+
+// FindPendingRequests returns the pending requests received by the user (incoming) or sent by the user (outgoing), newest first, together with the other user
+func (r *ContactRepository) FindPendingRequests(userID uint, incoming bool) ([]model.ContactRequest, error) {
+	// the other user is the sender of incoming requests and the recipient of outgoing requests
+	userColumn, otherUserColumn := "sender_id", "recipient_id"
+	if incoming {
+		userColumn, otherUserColumn = "recipient_id", "sender_id"
+	}
+	query := `
+		SELECT cr.id, cr.sender_id, cr.recipient_id, cr.status, cr.created_at, cr.responded_at, u.id, u.nickname, u.avatar_url, u.is_bot, u.created_at
+		FROM contact_requests cr
+		INNER JOIN users u ON u.id = cr.` + otherUserColumn + `
+		WHERE cr.` + userColumn + ` = $1 AND cr.status = 'PENDING'
+		ORDER BY cr.created_at DESC
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find contact requests: %v", err)
+	}
+	defer rows.Close()
+
+	requests := []model.ContactRequest{}
+	for rows.Next() {
+		var request model.ContactRequest
+		var otherUser model.User
+		var respondedAt sql.NullTime
+		var avatarURL sql.NullString
+		err := rows.Scan(&request.ID, &request.SenderID, &request.RecipientID, &request.Status, &request.CreatedAt, &respondedAt,
+			&otherUser.ID, &otherUser.Nickname, &avatarURL, &otherUser.IsBot, &otherUser.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if respondedAt.Valid {
+			request.RespondedAt = &respondedAt.Time
+		}
+		otherUser.AvatarURL = avatarURL.String
+		if incoming {
+			request.Sender = &otherUser
+		} else {
+			request.Recipient = &otherUser
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// RespondToRequest changes the status of a pending request to declined or cancelled. Returns nil if the request is no longer pending.
+func (r *ContactRepository) RespondToRequest(requestID uint, status string) (*model.ContactRequest, error) {
+	query := `UPDATE contact_requests SET status = $2, responded_at = NOW() WHERE id = $1 AND status = 'PENDING' RETURNING ` + contactRequestColumns
+	request, err := scanContactRequest(r.db.QueryRow(query, requestID, status))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return request, err
+}
+
+// AcceptRequest accepts a pending request and adds the users to each other's contacts in one transaction. Returns nil if the request is no longer pending.
+func (r *ContactRepository) AcceptRequest(requestID uint) (*model.ContactRequest, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := r.AcceptRequestTx(tx, requestID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func (r *ContactRepository) AcceptRequestTx(tx *sql.Tx, requestID uint) (*model.ContactRequest, error) {
+	query := `UPDATE contact_requests SET status = 'ACCEPTED', responded_at = NOW() WHERE id = $1 AND status = 'PENDING' RETURNING ` + contactRequestColumns
+	request, err := scanContactRequest(tx.QueryRow(query, requestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO contacts (user_id, contact_id) VALUES ($1, $2), ($2, $1) ON CONFLICT DO NOTHING", request.SenderID, request.RecipientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add contacts: %v", err)
+	}
+	return request, nil
+}
+
+// AreContacts checks whether the users are contacts of each other
+func (r *ContactRepository) AreContacts(user1ID, user2ID uint) (bool, error) {
+	var areContacts bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM contacts WHERE user_id = $1 AND contact_id = $2)", user1ID, user2ID).Scan(&areContacts)
+	if err != nil {
+		return false, fmt.Errorf("failed to check contacts: %v", err)
+	}
+	return areContacts, nil
+}
+
+// FindContacts returns the contacts of the user ordered by nickname
+func (r *ContactRepository) FindContacts(userID uint) ([]model.Contact, error) {
+	query := `
+		SELECT u.id, u.nickname, u.avatar_url, u.is_bot, u.created_at, c.created_at
+		FROM contacts c
+		INNER JOIN users u ON u.id = c.contact_id
+		WHERE c.user_id = $1 AND u.deleted_at IS NULL
+		ORDER BY LOWER(u.nickname)
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find contacts: %v", err)
+	}
+	defer rows.Close()
+
+	contacts := []model.Contact{}
+	for rows.Next() {
+		var contact model.Contact
+		var avatarURL sql.NullString
+		if err := rows.Scan(&contact.ID, &contact.Nickname, &avatarURL, &contact.IsBot, &contact.CreatedAt, &contact.ContactSince); err != nil {
+			return nil, err
+		}
+		contact.AvatarURL = avatarURL.String
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// RemoveContact removes the users from each other's contacts. Returns false if they weren't contacts.
+func (r *ContactRepository) RemoveContact(user1ID, user2ID uint) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM contacts WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)", user1ID, user2ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove contact: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// IsMessagingRestricted checks whether the recipient only accepts private chatrooms from contacts and the sender is not one of them
+func (r *ContactRepository) IsMessagingRestricted(recipientID, senderID uint) (bool, error) {
+	query := `
+		SELECT u.only_contacts_can_message AND NOT EXISTS (SELECT 1 FROM contacts WHERE user_id = u.id AND contact_id = $2)
+		FROM users u
+		WHERE u.id = $1
+	`
+	var restricted bool
+	err := r.db.QueryRow(query, recipientID, senderID).Scan(&restricted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to check messaging restriction: %v", err)
+	}
+	return restricted, nil
+}
+
+func scanContactRequest(row rowScanner) (*model.ContactRequest, error) {
+	var request model.ContactRequest
+	var respondedAt sql.NullTime
+	if err := row.Scan(&request.ID, &request.SenderID, &request.RecipientID, &request.Status, &request.CreatedAt, &respondedAt); err != nil {
+		return nil, err
+	}
+	if respondedAt.Valid {
+		request.RespondedAt = &respondedAt.Time
+	}
+	return &request, nil
+}
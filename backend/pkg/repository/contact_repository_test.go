@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptRequestAddsContactsInBothDirections(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewContactRepository(db)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE contact_requests SET status = 'ACCEPTED', responded_at = NOW\\(\\) WHERE id = \\$1 AND status = 'PENDING'").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "recipient_id", "status", "created_at", "responded_at"}).
+			AddRow(5, 1, 2, "ACCEPTED", now, now))
+	mock.ExpectExec("INSERT INTO contacts \\(user_id, contact_id\\) VALUES \\(\\$1, \\$2\\), \\(\\$2, \\$1\\)").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	request, err := repo.AcceptRequest(5)
+	assert.NoError(t, err)
+	assert.Equal(t, "ACCEPTED", request.Status)
+	assert.NotNil(t, request.RespondedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcceptRequestReturnsNilWhenNotPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewContactRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE contact_requests SET status = 'ACCEPTED'").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "recipient_id", "status", "created_at", "responded_at"}))
+	mock.ExpectCommit()
+
+	request, err := repo.AcceptRequest(5)
+	assert.NoError(t, err)
+	assert.Nil(t, request)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
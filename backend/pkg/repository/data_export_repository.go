@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrDataExportInProgress is returned when the user already has an export which is not finished
+var ErrDataExportInProgress = errors.New("a data export is already in progress")
+
+type DataExportRepository struct {
+	db *sql.DB
+}
+
+func NewDataExportRepository(db *sql.DB) *DataExportRepository {
+	return &DataExportRepository{db: db}
+}
+
+const dataExportColumns = "id, user_id, status, file_path, created_at, completed_at, expires_at"
+
+// CreateExport creates a pending export for the user
+func (r *DataExportRepository) CreateExport(userID uint) (*model.DataExport, error) {
+	export, err := scanDataExport(r.db.QueryRow(`INSERT INTO data_exports (user_id) VALUES ($1) RETURNING `+dataExportColumns, userID))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrDataExportInProgress
+		}
+		return nil, fmt.Errorf("failed to create data export: %v", err)
+	}
+	return export, nil
+}
+
+// FindExportByID finds an export of the user. Returns nil if the export is not found.
+func (r *DataExportRepository) FindExportByID(exportID, userID uint) (*model.DataExport, error) {
+	export, err := scanDataExport(r.db.QueryRow(`SELECT `+dataExportColumns+` FROM data_exports WHERE id = $1 AND user_id = $2`, exportID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return export, err
+}
+
+// FindExportsByUserID returns the exports of the user, newest first
+func (r *DataExportRepository) FindExportsByUserID(userID uint) ([]model.DataExport, error) {
+	rows, err := r.db.Query(`SELECT `+dataExportColumns+` FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find data exports: %v", err)
+	}
+	defer rows.Close()
+
+	exports := []model.DataExport{}
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %v", err)
+		}
+		exports = append(exports, *export)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find data exports: %v", err)
+	}
+	return exports, nil
+}
+
+// ClaimNextExport marks the oldest pending export as processing and returns it. Exports abandoned while processing are claimed again. Returns nil if there is nothing to process.
+func (r *DataExportRepository) ClaimNextExport() (*model.DataExport, error) {
+	query := `
+		UPDATE data_exports SET status = 'PROCESSING', started_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'PENDING' OR (status = 'PROCESSING' AND started_at < NOW() - $1 * INTERVAL '1 minute')
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dataExportColumns
+	export, err := scanDataExport(r.db.QueryRow(query, config.DataExportStaleMinutes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim data export: %v", err)
+	}
+	return export, nil
+}
+
+// MarkExportReady stores the path of the finished archive and returns the updated export. Returns nil if the export no longer exists, e.g. because the account was deleted meanwhile.
+func (r *DataExportRepository) MarkExportReady(exportID uint, filePath string, expiresAt time.Time) (*model.DataExport, error) {
+	query := `
+		UPDATE data_exports SET status = 'READY', file_path = $2, completed_at = NOW(), expires_at = $3
+		WHERE id = $1 AND status = 'PROCESSING'
+		RETURNING ` + dataExportColumns
+	export, err := scanDataExport(r.db.QueryRow(query, exportID, filePath, expiresAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update data export: %v", err)
+	}
+	return export, nil
+}
+
+// MarkExportFailed marks the export as failed and returns the updated export. Returns nil if the export no longer exists.
+func (r *DataExportRepository) MarkExportFailed(exportID uint) (*model.DataExport, error) {
+	query := `
+		UPDATE data_exports SET status = 'FAILED', completed_at = NOW()
+		WHERE id = $1 AND status = 'PROCESSING'
+		RETURNING ` + dataExportColumns
+	export, err := scanDataExport(r.db.QueryRow(query, exportID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update data export: %v", err)
+	}
+	return export, nil
+}
+
+// ExpireExports marks the ready exports whose time is up as expired and returns the paths of their archives to be removed
+func (r *DataExportRepository) ExpireExports() ([]string, error) {
+	query := `
+		UPDATE data_exports SET status = 'EXPIRED'
+		WHERE status = 'READY' AND expires_at <= NOW()
+		RETURNING file_path
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire data exports: %v", err)
+	}
+	defer rows.Close()
+
+	filePaths := []string{}
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %v", err)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire data exports: %v", err)
+	}
+	return filePaths, nil
+}
+
+// FindChatroomMemberships returns the chatrooms the user participates in
+func (r *DataExportRepository) FindChatroomMemberships(userID uint) ([]model.ChatroomMembership, error) {
+	query := `
+		SELECT c.id, c.is_group, c.group_name, c.created_at, cp.unread_count
+		FROM chatrooms c
+		INNER JOIN chatroom_participants cp ON c.id = cp.chatroom_id
+		WHERE cp.user_id = $1
+		ORDER BY c.id
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chatroom memberships: %v", err)
+	}
+	defer rows.Close()
+
+	memberships := []model.ChatroomMembership{}
+	for rows.Next() {
+		var membership model.ChatroomMembership
+		var groupName sql.NullString
+		var unreadCount sql.NullInt64
+		if err := rows.Scan(&membership.ChatroomID, &membership.IsGroup, &groupName, &membership.CreatedAt, &unreadCount); err != nil {
+			return nil, fmt.Errorf("failed to scan chatroom membership: %v", err)
+		}
+		membership.GroupName = groupName.String
+		membership.UnreadCount = int(unreadCount.Int64)
+		memberships = append(memberships, membership)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find chatroom memberships: %v", err)
+	}
+	return memberships, nil
+}
+
+// ForEachSentMessage calls fn with every message sent by the user, oldest first, without loading all of them into memory. Stops at the first error returned by fn.
+func (r *DataExportRepository) ForEachSentMessage(userID uint, fn func(model.ChatMessage) error) error {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE sender_user_id = $1 AND kind = 'USER'
+		ORDER BY timestamp, id
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to find sent messages: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan message data: %v", err)
+		}
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find sent messages: %v", err)
+	}
+	return nil
+}
+
+// ForEachMessageView calls fn with every message view of the user, oldest first, without loading all of them into memory. Stops at the first error returned by fn.
+func (r *DataExportRepository) ForEachMessageView(userID uint, fn func(model.MessageView) error) error {
+	query := `
+		SELECT mv.message_id, m.chatroom_id, mv.viewed_at
+		FROM message_views mv
+		INNER JOIN messages m ON m.id = mv.message_id
+		WHERE mv.user_id = $1
+		ORDER BY mv.viewed_at, mv.message_id
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to find message views: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var view model.MessageView
+		if err := rows.Scan(&view.MessageID, &view.ChatroomID, &view.ViewedAt); err != nil {
+			return fmt.Errorf("failed to scan message view: %v", err)
+		}
+		if err := fn(view); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find message views: %v", err)
+	}
+	return nil
+}
+
+func scanDataExport(row rowScanner) (*model.DataExport, error) {
+	var export model.DataExport
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.FilePath, &export.CreatedAt, &completedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+	return &export, nil
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMessageNotFound is returned when the message doesn't exist in the chatroom, was deleted or is a system message
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrMessageAlreadyPinned is returned when pinning a message which is already pinned
+	ErrMessageAlreadyPinned = errors.New("message is already pinned")
+	// ErrPinLimitReached is returned when the chatroom already has the maximum number of pinned messages
+	ErrPinLimitReached = errors.New("too many pinned messages")
+	// ErrPinnedMessageNotFound is returned when unpinning a message which isn't pinned
+	ErrPinnedMessageNotFound = errors.New("pinned message not found")
+)
+
+type PinnedMessageRepository struct {
+	db *sql.DB
+}
+
+// NewPinnedMessageRepository creates a new instance of PinnedMessageRepository with the given database connection.
+func NewPinnedMessageRepository(db *sql.DB) *PinnedMessageRepository {
+	return &PinnedMessageRepository{db: db}
+}
+
+// PinMessage pins a message of the chatroom on behalf of the user unless the chatroom already has maxPins pinned messages
+func (r *PinnedMessageRepository) PinMessage(chatroomID, messageID, userID uint, maxPins int) (*model.PinnedMessage, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	pinnedMessage, err := r.PinMessageTx(tx, chatroomID, messageID, userID, maxPins)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return pinnedMessage, nil
+}
+
+func (r *PinnedMessageRepository) PinMessageTx(tx *sql.Tx, chatroomID, messageID, userID uint, maxPins int) (*model.PinnedMessage, error) {
+	// the chatroom is locked, so that concurrent pins can't exceed the limit
+	if _, err := tx.Exec("SELECT 1 FROM chatrooms WHERE id = $1 FOR UPDATE", chatroomID); err != nil {
+		return nil, fmt.Errorf("failed to lock chatroom: %v", err)
+	}
+	message, err := scanMessage(tx.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = $1 AND chatroom_id = $2 AND NOT deleted AND kind = $3",
+		messageID, chatroomID, model.ChatMessageKindUser))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find message: %v", err)
+	}
+
+	var alreadyPinned bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM pinned_messages WHERE message_id = $1)", messageID).Scan(&alreadyPinned); err != nil {
+		return nil, fmt.Errorf("failed to check pinned message: %v", err)
+	}
+	if alreadyPinned {
+		return nil, ErrMessageAlreadyPinned
+	}
+	var pinCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM pinned_messages WHERE chatroom_id = $1", chatroomID).Scan(&pinCount); err != nil {
+		return nil, fmt.Errorf("failed to count pinned messages: %v", err)
+	}
+	if pinCount >= maxPins {
+		return nil, ErrPinLimitReached
+	}
+
+	pinnedMessage := &model.PinnedMessage{Message: message}
+	err = tx.QueryRow("INSERT INTO pinned_messages (message_id, chatroom_id, pinned_by) VALUES ($1, $2, $3) RETURNING pinned_by, pinned_at", messageID, chatroomID, userID).
+		Scan(&pinnedMessage.PinnedByID, &pinnedMessage.PinnedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin message: %v", err)
+	}
+	return pinnedMessage, nil
+}
+
+// UnpinMessage unpins a pinned message of the chatroom. Returns ErrPinnedMessageNotFound if the message isn't pinned.
+func (r *PinnedMessageRepository) UnpinMessage(chatroomID, messageID uint) error {
+	result, err := r.db.Exec("DELETE FROM pinned_messages WHERE message_id = $1 AND chatroom_id = $2", messageID, chatroomID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %v", err)
+	}
+	unpinned, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %v", err)
+	}
+	if unpinned == 0 {
+		return ErrPinnedMessageNotFound
+	}
+	return nil
+}
+
+// FindPinnedMessages returns the pinned messages of the chatroom, newest pin first
+func (r *PinnedMessageRepository) FindPinnedMessages(chatroomID uint) ([]model.PinnedMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `, pinned_by, pinned_at
+		FROM messages
+		INNER JOIN (SELECT message_id, pinned_by, pinned_at FROM pinned_messages WHERE chatroom_id = $1) pm ON pm.message_id = messages.id
+		ORDER BY pinned_at DESC
+	`
+	rows, err := r.db.Query(query, chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pinned messages: %v", err)
+	}
+	defer rows.Close()
+
+	pinnedMessages := []model.PinnedMessage{}
+	for rows.Next() {
+		var pinnedMessage model.PinnedMessage
+		message, err := scanMessage(extraColumnsScanner{row: rows, extra: []interface{}{&pinnedMessage.PinnedByID, &pinnedMessage.PinnedAt}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pinned message: %v", err)
+		}
+		pinnedMessage.Message = message
+		pinnedMessages = append(pinnedMessages, pinnedMessage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find pinned messages: %v", err)
+	}
+	return pinnedMessages, nil
+}
+
+// extraColumnsScanner scans the columns selected after the ones of a scan function into extra destinations
+type extraColumnsScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s extraColumnsScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
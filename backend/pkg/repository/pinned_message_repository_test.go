@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPinMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewPinnedMessageRepository(db)
+	messageColumnNames := []string{"id", "chatroom_id", "sender_user_id", "text", "attachment_url", "timestamp", "viewed", "deleted", "edited", "kind", "system_event", "system_user_id"}
+	timestamp := time.Now()
+
+	// The message is pinned while the chatroom has fewer pins than the limit
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT 1 FROM chatrooms WHERE id = \\$1 FOR UPDATE").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE id = \\$1 AND chatroom_id = \\$2 AND NOT deleted AND kind = \\$3").
+		WithArgs(9, 1, "USER").
+		WillReturnRows(sqlmock.NewRows(messageColumnNames).AddRow(9, 1, 3, "Meet at 8", nil, timestamp, false, false, false, "USER", nil, nil))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM pinned_messages WHERE message_id = \\$1\\)").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pinned_messages WHERE chatroom_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("INSERT INTO pinned_messages \\(message_id, chatroom_id, pinned_by\\)").
+		WithArgs(9, 1, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"pinned_by", "pinned_at"}).AddRow(4, timestamp))
+	mock.ExpectCommit()
+
+	pinnedMessage, err := repo.PinMessage(1, 9, 4, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(9), pinnedMessage.Message.ID)
+	assert.Equal(t, "Meet at 8", pinnedMessage.Message.Text)
+	assert.Equal(t, uint(4), pinnedMessage.PinnedByID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Nothing is pinned when the limit is reached
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT 1 FROM chatrooms WHERE id = \\$1 FOR UPDATE").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE id = \\$1 AND chatroom_id = \\$2 AND NOT deleted AND kind = \\$3").
+		WithArgs(10, 1, "USER").
+		WillReturnRows(sqlmock.NewRows(messageColumnNames).AddRow(10, 1, 3, "See you", nil, timestamp, false, false, false, "USER", nil, nil))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM pinned_messages WHERE message_id = \\$1\\)").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pinned_messages WHERE chatroom_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectRollback()
+
+	_, err = repo.PinMessage(1, 10, 4, 3)
+	assert.ErrorIs(t, err, ErrPinLimitReached)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
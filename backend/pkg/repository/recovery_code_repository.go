@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+type RecoveryCodeRepository struct {
+	db *sql.DB
+}
+
+// NewRecoveryCodeRepository creates a new instance of RecoveryCodeRepository with the given database connection.
+func NewRecoveryCodeRepository(db *sql.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+// ReplaceRecoveryCodes deletes all recovery codes of the user and stores the given code hashes instead
+func (r *RecoveryCodeRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	for i := 0; err == nil && i < len(codeHashes); i++ {
+		_, err = tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHashes[i])
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return fmt.Errorf("failed to replace recovery codes: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeRecoveryCode marks an unused recovery code of the user with the given hash as used. Returns false if there is no such code.
+func (r *RecoveryCodeRepository) ConsumeRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result, err := r.db.Exec("UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// DeleteRecoveryCodes deletes all recovery codes of the user
+func (r *RecoveryCodeRepository) DeleteRecoveryCodes(userID uint) error {
+	_, err := r.db.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+	return nil
+}
@@ -8,14 +8,46 @@ import (
 type Repositories struct {
 	UserRepo     *UserRepository
 	ChatroomRepo *ChatroomRepository
+	// ChatroomInviteRepo stores the invites and join requests of group chatrooms
+	ChatroomInviteRepo *ChatroomInviteRepository
+	// PinnedMessageRepo stores the pinned messages of chatrooms
+	PinnedMessageRepo *PinnedMessageRepository
+	UserTokenRepo      *UserTokenRepository
+	RecoveryCodeRepo   *RecoveryCodeRepository
+	UserIdentityRepo   *UserIdentityRepository
+	SessionRepo        *SessionRepository
+	APIKeyRepo         *APIKeyRepository
+	BlockRepo          *BlockRepository
+	ContactRepo        *ContactRepository
+	DataExportRepo     *DataExportRepository
 }
 
 // InitRepositories should be called only once when initialising the app
 func InitRepositories(db *sql.DB) *Repositories {
 	userRepo := NewUserRepository(db)
 	chatroomRepo := NewChatroomRepository(db)
+	chatroomInviteRepo := NewChatroomInviteRepository(db, chatroomRepo)
+	pinnedMessageRepo := NewPinnedMessageRepository(db)
+	userTokenRepo := NewUserTokenRepository(db)
+	recoveryCodeRepo := NewRecoveryCodeRepository(db)
+	userIdentityRepo := NewUserIdentityRepository(db)
+	sessionRepo := NewSessionRepository(db)
+	apiKeyRepo := NewAPIKeyRepository(db)
+	blockRepo := NewBlockRepository(db)
+	contactRepo := NewContactRepository(db)
+	dataExportRepo := NewDataExportRepository(db)
 	return &Repositories{
-		UserRepo:     userRepo,
-		ChatroomRepo: chatroomRepo,
+		UserRepo:           userRepo,
+		ChatroomRepo:       chatroomRepo,
+		ChatroomInviteRepo: chatroomInviteRepo,
+		PinnedMessageRepo:  pinnedMessageRepo,
+		UserTokenRepo:      userTokenRepo,
+		RecoveryCodeRepo:   recoveryCodeRepo,
+		UserIdentityRepo:   userIdentityRepo,
+		SessionRepo:        sessionRepo,
+		APIKeyRepo:         apiKeyRepo,
+		BlockRepo:          blockRepo,
+		ContactRepo:        contactRepo,
+		DataExportRepo:     dataExportRepo,
 	}
 }
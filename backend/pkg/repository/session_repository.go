@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	_ "github.com/lib/pq"
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new instance of SessionRepository with the given database connection.
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// CreateSession stores a new session and returns it
+func (r *SessionRepository) CreateSession(session model.Session) (*model.Session, error) {
+	query := `
+		INSERT INTO user_sessions (user_id, device_name, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, device_name, user_agent, ip_address, created_at, last_active_at, expires_at
+	`
+	var newSession model.Session
+	err := r.db.QueryRow(query, session.UserID, session.DeviceName, session.UserAgent, session.IPAddress, session.ExpiresAt).
+		Scan(&newSession.ID, &newSession.UserID, &newSession.DeviceName, &newSession.UserAgent, &newSession.IPAddress, &newSession.CreatedAt, &newSession.LastActiveAt, &newSession.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+	return &newSession, nil
+}
+
+// FindActiveSession finds a session of the user that is neither revoked nor expired. Returns nil if there is no such session.
+func (r *SessionRepository) FindActiveSession(sessionID, userID uint) (*model.Session, error) {
+	query := `
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_active_at, expires_at
+		FROM user_sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	var session model.Session
+	err := r.db.QueryRow(query, sessionID, userID).
+		Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastActiveAt, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find session: %v", err)
+	}
+	return &session, nil
+}
+
+// FindActiveSessionsByUserID returns all sessions of the user that are neither revoked nor expired, most recently active first
+func (r *SessionRepository) FindActiveSessionsByUserID(userID uint) ([]model.Session, error) {
+	query := `
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_active_at, expires_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_active_at DESC
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var session model.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastActiveAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session data: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// UpdateLastActiveAt sets the last activity of the session
+func (r *SessionRepository) UpdateLastActiveAt(sessionID uint, lastActiveAt time.Time) error {
+	_, err := r.db.Exec("UPDATE user_sessions SET last_active_at = $1 WHERE id = $2", lastActiveAt, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session activity: %v", err)
+	}
+	return nil
+}
+
+// RevokeSessions revokes the given active sessions of the user and returns the IDs of the revoked sessions
+func (r *SessionRepository) RevokeSessions(userID uint, sessionIDs []uint) ([]uint, error) {
+	ids := make([]int64, len(sessionIDs))
+	for i, id := range sessionIDs {
+		ids[i] = int64(id)
+	}
+	query := "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND id = ANY($2::int[]) AND revoked_at IS NULL RETURNING id"
+	return r.revoke(query, userID, pq.Array(ids))
+}
+
+// RevokeSessionsExcept revokes all active sessions of the user except the given one and returns the IDs of the revoked sessions. Use 0 to revoke all sessions.
+func (r *SessionRepository) RevokeSessionsExcept(userID, keptSessionID uint) ([]uint, error) {
+	query := "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND id != $2 AND revoked_at IS NULL RETURNING id"
+	return r.revoke(query, userID, keptSessionID)
+}
+
+func (r *SessionRepository) revoke(query string, args ...interface{}) ([]uint, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	defer rows.Close()
+
+	revoked := []uint{}
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session id: %v", err)
+		}
+		revoked = append(revoked, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return revoked, nil
+}
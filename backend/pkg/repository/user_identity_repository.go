@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+type UserIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewUserIdentityRepository creates a new instance of UserIdentityRepository with the given database connection.
+func NewUserIdentityRepository(db *sql.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db}
+}
+
+// FindUserByIdentity finds the user linked to the identity of the given provider and subject. Returns nil if the identity isn't linked.
+func (r *UserIdentityRepository) FindUserByIdentity(provider, subject string) (*model.User, error) {
+	query := `
+		SELECT u.id, u.nickname, u.email, u.password_hash, u.avatar_url, u.email_verified, u.totp_enabled, u.is_bot, u.created_at
+		FROM users u
+		JOIN user_identities ui ON ui.user_id = u.id
+		WHERE ui.provider = $1 AND ui.subject = $2
+	`
+	var user model.User
+	err := r.db.QueryRow(query, provider, subject).
+		Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL, &user.EmailVerified, &user.TwoFactorEnabled, &user.IsBot, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find user by identity: %v", err)
+	}
+	return &user, nil
+}
+
+// LinkIdentity links the identity of the given provider and subject to an existing user
+func (r *UserIdentityRepository) LinkIdentity(identity model.UserIdentity) error {
+	_, err := r.db.Exec("INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %v", err)
+	}
+	return nil
+}
+
+// CreateUserWithIdentity creates a new user with a verified email and no password and links the identity to them in one transaction
+func (r *UserIdentityRepository) CreateUserWithIdentity(user model.User, identity model.UserIdentity) (*model.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	newUser, err := r.createUserWithIdentityTx(tx, user, identity)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return newUser, nil
+}
+
+func (r *UserIdentityRepository) createUserWithIdentityTx(tx *sql.Tx, user model.User, identity model.UserIdentity) (*model.User, error) {
+	query := `
+		INSERT INTO users (nickname, email, password_hash, avatar_url, email_verified)
+		VALUES ($1, $2, '', $3, TRUE)
+		RETURNING id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at
+	`
+	var newUser model.User
+	err := tx.QueryRow(query, user.Nickname, user.Email, user.AvatarURL).
+		Scan(&newUser.ID, &newUser.Nickname, &newUser.Email, &newUser.PasswordHash, &newUser.AvatarURL, &newUser.EmailVerified, &newUser.TwoFactorEnabled, &newUser.IsBot, &newUser.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add a new user: %v", err)
+	}
+	_, err = tx.Exec("INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		newUser.ID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %v", err)
+	}
+	return &newUser, nil
+}
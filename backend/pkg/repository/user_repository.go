@@ -1,15 +1,25 @@
 package repository
 
 import (
+	"backend/pkg/config"
 	"backend/pkg/model"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when a user with the same email address already exists
+var ErrEmailTaken = errors.New("email address is already taken")
+
+// ErrNicknameTaken is returned when a person with the same nickname already exists
+var ErrNicknameTaken = errors.New("nickname is already taken")
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -22,71 +32,151 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 // FindByID finds a user by their ID and returns the user details. Returns nil if user is not found.
 func (r *UserRepository) FindByID(id uint) (*model.User, error) {
 	var user model.User
-	query := `SELECT id, nickname, email, password_hash, avatar_url FROM users WHERE id = $1;`
+	var status userStatusRow
+	query := `SELECT id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at, status_emoji, status_text, status_expires_at FROM users WHERE id = $1;`
 	row := r.db.QueryRow(query, id)
 
-	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL)
+	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL, &user.EmailVerified, &user.TwoFactorEnabled, &user.IsBot, &user.CreatedAt,
+		&status.emoji, &status.text, &status.expiresAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	user.Status = status.toModel()
 
 	return &user, nil
 }
 
-// FindUserBySearchTerm finds users whose nickname or email contains the search term (case-insensitive), orders them by relevance, and limits the number of search results, excluding specified users.
-func (r *UserRepository) FindUserBySearchTerm(searchTerm string, excludedUsers []uint) ([]model.User, error) {
-	var users []model.User
+// userStatusRow holds the status columns of a user row
+type userStatusRow struct {
+	emoji     string
+	text      string
+	expiresAt sql.NullTime
+}
+
+// toModel returns the status or nil if the user has no status or it has expired but wasn't cleared yet
+func (s userStatusRow) toModel() *model.UserStatus {
+	var expiresAt *time.Time
+	if s.expiresAt.Valid {
+		expiresAt = &s.expiresAt.Time
+	}
+	return model.NewUserStatus(s.emoji, s.text, expiresAt)
+}
+
+// UserSearchCursor is the position of the last user of a search results page
+type UserSearchCursor struct {
+	Tier  int  `json:"t"`
+	Score int  `json:"s"`
+	ID    uint `json:"i"`
+}
+
+// UserSearchHit is a user found by a search together with its ranking
+type UserSearchHit struct {
+	User model.User
+	// Tier is 2 for contacts of the searcher, 1 for members of a chatroom shared with the searcher and 0 for everyone else
+	Tier int
+	// Score is the relevance of the match between 0 and 1000
+	Score int
+}
+
+// FindUserBySearchTerm finds users whose nickname or email matches the search term (case-insensitive), ranking contacts and members of shared chatrooms above strangers
+// and better matches above fuzzy ones. Results come after the cursor, if given, and exclude specified users and users who blocked or were blocked by the searcher.
+// Terms shorter than UserSearchMinTrigramTermLength only match nickname prefixes. Credential columns are never selected.
+func (r *UserRepository) FindUserBySearchTerm(searchTerm string, searcherID uint, excludedUsers []uint, after *UserSearchCursor, limit int) ([]UserSearchHit, error) {
+	term := strings.ToLower(strings.TrimSpace(searchTerm))
+	likeTerm := escapeLike(term)
+	matchCondition := "LOWER(u.nickname) LIKE $1 || '%'"
+	if utf8.RuneCountInString(term) >= config.UserSearchMinTrigramTermLength {
+		// LIKE with a leading wildcard and the word similarity operator are served by the trigram indexes
+		matchCondition = "(LOWER(u.nickname) LIKE '%' || $1 || '%' OR LOWER(u.email) LIKE '%' || $1 || '%' OR $2 <% LOWER(u.nickname))"
+	}
 	query := `
-		SELECT id, nickname, email, password_hash, avatar_url, created_at
-		FROM users 
-		WHERE (nickname ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
-		AND id NOT IN (SELECT unnest($2::int[]))
-		ORDER BY CASE 
-			WHEN email ILIKE $1 THEN 1  -- Matches email exactly
-			WHEN email ILIKE '%' || $1 || '%' THEN 2  -- Matches email partially
-			WHEN nickname ILIKE '%' || $1 || '%' THEN 3  -- Matches nickname partially
-			ELSE 4  -- No match
-		END
-		LIMIT 10;
+		WITH hits AS (
+			SELECT u.id, u.nickname, u.email, u.avatar_url, u.is_bot, u.created_at, u.status_emoji, u.status_text, u.status_expires_at,
+				CASE
+					WHEN EXISTS (SELECT 1 FROM contacts WHERE user_id = $3 AND contact_id = u.id) THEN 2
+					WHEN EXISTS (
+						SELECT 1 FROM chatroom_participants mine
+						INNER JOIN chatroom_participants theirs ON theirs.chatroom_id = mine.chatroom_id
+						WHERE mine.user_id = $3 AND theirs.user_id = u.id
+					) THEN 1
+					ELSE 0
+				END AS tier,
+				ROUND(1000 * GREATEST(
+					CASE
+						WHEN LOWER(u.nickname) = $2 OR LOWER(u.email) = $2 THEN 1.0
+						WHEN LOWER(u.nickname) LIKE $1 || '%' THEN 0.9
+						WHEN LOWER(u.email) LIKE $1 || '%' THEN 0.8
+						WHEN LOWER(u.nickname) LIKE '%' || $1 || '%' THEN 0.7
+						ELSE 0.0
+					END,
+					0.6 * word_similarity($2, LOWER(u.nickname))::numeric
+				))::int AS score
+			FROM users u
+			WHERE ` + matchCondition + `
+			AND u.deleted_at IS NULL
+			AND u.id <> ALL($4::int[])
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks
+				WHERE (blocker_id = $3 AND blocked_id = u.id) OR (blocker_id = u.id AND blocked_id = $3)
+			)
+		)
+		SELECT id, nickname, email, avatar_url, is_bot, created_at, status_emoji, status_text, status_expires_at, tier, score
+		FROM hits
+		WHERE $5::boolean OR (tier, score, -id) < ($6, $7, -$8::int)
+		ORDER BY tier DESC, score DESC, id
+		LIMIT $9
 	`
-	// Convert excludedUsers from []uint to []int64 for compatibility with PostgreSQL array
+	var cursor UserSearchCursor
+	if after != nil {
+		cursor = *after
+	}
 	excludedUsersInt := make([]int64, len(excludedUsers))
 	for i, id := range excludedUsers {
 		excludedUsersInt[i] = int64(id)
 	}
 
-	rows, err := r.db.Query(query, searchTerm, pq.Array(excludedUsersInt))
+	rows, err := r.db.Query(query, likeTerm, term, searcherID, pq.Array(excludedUsersInt), after == nil, cursor.Tier, cursor.Score, cursor.ID, limit)
 	if err != nil {
-		return []model.User{}, err
+		return nil, fmt.Errorf("failed to search users: %v", err)
 	}
 	defer rows.Close()
 
+	hits := []UserSearchHit{}
 	for rows.Next() {
-		var user model.User
-		err := rows.Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL, &user.CreatedAt)
+		var hit UserSearchHit
+		var avatarURL sql.NullString
+		var status userStatusRow
+		err := rows.Scan(&hit.User.ID, &hit.User.Nickname, &hit.User.Email, &avatarURL, &hit.User.IsBot, &hit.User.CreatedAt,
+			&status.emoji, &status.text, &status.expiresAt, &hit.Tier, &hit.Score)
 		if err != nil {
-			return []model.User{}, err
+			return nil, err
 		}
-		users = append(users, user)
+		hit.User.AvatarURL = avatarURL.String
+		hit.User.Status = status.toModel()
+		hits = append(hits, hit)
 	}
-
 	if err = rows.Err(); err != nil {
-		return []model.User{}, err
+		return nil, err
 	}
 
-	return users, nil
+	return hits, nil
+}
+
+// escapeLike escapes the wildcards of LIKE patterns, so that user input is matched literally
+func escapeLike(term string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(term)
 }
 
 // FindByEmail finds a user by their email address and returns the user details. Returns nil if user is not found.
 func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 	var user model.User
-	query := `SELECT id, nickname, email, password_hash, avatar_url FROM users WHERE email = $1;`
+	query := `SELECT id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at FROM users WHERE LOWER(email) = LOWER($1);`
 	row := r.db.QueryRow(query, email)
 
-	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL)
+	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL, &user.EmailVerified, &user.TwoFactorEnabled, &user.IsBot, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -97,29 +187,94 @@ func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 	return &user, nil
 }
 
-// FindAll fetches all users from the database and returns a slice of user models.
-func (r *UserRepository) FindAll() ([]model.User, error) {
-	var users []model.User
-	rows, err := r.db.Query("SELECT id, nickname, email, password_hash, avatar_url FROM users;")
+// userColumns is the projection of a user as returned to other users. It never includes credentials.
+const userColumns = "u.id, u.nickname, u.email, COALESCE(u.avatar_url, ''), u.is_bot, u.created_at, u.status_emoji, u.status_text, u.status_expires_at"
+
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner) (model.User, error) {
+	var user model.User
+	var status userStatusRow
+	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.AvatarURL, &user.IsBot, &user.CreatedAt, &status.emoji, &status.text, &status.expiresAt)
 	if err != nil {
-		return nil, err
+		return model.User{}, err
+	}
+	user.Status = status.toModel()
+	return user, nil
+}
+
+// UserDirectoryCursor is the position of the last user of a directory page. Nickname is lower cased and only set when sorting by nickname, CreatedAt only when sorting by creation time.
+type UserDirectoryCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Nickname   string    `json:"n,omitempty"`
+	CreatedAt  time.Time `json:"c"`
+	ID         uint      `json:"i"`
+}
+
+// FindDirectoryPage returns up to limit users matching the filter in the order of the filter, starting after the cursor if given. Deleted users are never included.
+func (r *UserRepository) FindDirectoryPage(filter model.UserDirectoryFilter, after *UserDirectoryCursor, limit int) ([]model.User, error) {
+	conditions := []string{"u.deleted_at IS NULL"}
+	args := []interface{}{}
+	addArg := func(arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.CreatedSince != nil {
+		conditions = append(conditions, "u.created_at >= "+addArg(*filter.CreatedSince))
+	}
+	if filter.HasAvatar != nil {
+		if *filter.HasAvatar {
+			conditions = append(conditions, "COALESCE(u.avatar_url, '') <> ''")
+		} else {
+			conditions = append(conditions, "COALESCE(u.avatar_url, '') = ''")
+		}
+	}
+	if filter.IsBot != nil {
+		conditions = append(conditions, "u.is_bot = "+addArg(*filter.IsBot))
+	}
+	if filter.IsActive != nil {
+		active := "EXISTS (SELECT 1 FROM user_sessions s WHERE s.user_id = u.id AND s.last_active_at >= NOW() - " + addArg(config.UserActiveWithinDays) + " * INTERVAL '1 day')"
+		if !*filter.IsActive {
+			active = "NOT " + active
+		}
+		conditions = append(conditions, active)
+	}
+
+	sortKey := "LOWER(u.nickname)"
+	if filter.Sort == model.UserDirectorySortCreatedAt {
+		sortKey = "u.created_at"
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if after != nil {
+		var sortValue interface{} = after.Nickname
+		if filter.Sort == model.UserDirectorySortCreatedAt {
+			sortValue = after.CreatedAt
+		}
+		conditions = append(conditions, fmt.Sprintf("(%v, u.id) %v (%v, %v)", sortKey, comparison, addArg(sortValue), addArg(after.ID)))
+	}
+
+	query := fmt.Sprintf(`SELECT %v FROM users u WHERE %v ORDER BY %v %v, u.id %v LIMIT %v`,
+		userColumns, strings.Join(conditions, " AND "), sortKey, direction, direction, addArg(limit))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %v", err)
 	}
 	defer rows.Close()
 
-	// Iterate over the rows
+	users := []model.User{}
 	for rows.Next() {
-		var user model.User
-		err := rows.Scan(&user.ID, &user.Nickname, &user.Email, &user.AvatarURL)
+		user, err := scanUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan user data: %v", err)
 		}
 		users = append(users, user)
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find users: %v", err)
 	}
-
 	return users, nil
 }
 
@@ -128,14 +283,433 @@ func (r *UserRepository) AddNewUser(user model.User) (model.User, error) {
 	query := `
 		INSERT INTO users (nickname, email, password_hash, avatar_url) 
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, nickname, email, password_hash, avatar_url, created_at;
+		RETURNING id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at;
 	`
 	var newUser model.User
 	err := r.db.QueryRow(query, user.Nickname, user.Email, user.PasswordHash, user.AvatarURL).
-		Scan(&newUser.ID, &newUser.Nickname, &newUser.Email, &newUser.PasswordHash, &newUser.AvatarURL, &newUser.CreatedAt)
+		Scan(&newUser.ID, &newUser.Nickname, &newUser.Email, &newUser.PasswordHash, &newUser.AvatarURL, &newUser.EmailVerified, &newUser.TwoFactorEnabled, &newUser.IsBot, &newUser.CreatedAt)
 	if err != nil {
+		if uniqueErr := uniqueUserViolation(err); uniqueErr != nil {
+			return model.User{}, uniqueErr
+		}
 		return model.User{}, fmt.Errorf("failed to add a new user: %v", err)
 	}
 
 	return newUser, nil
 }
+
+// UpdateProfile sets the nickname and avatar of the user and returns the updated user
+func (r *UserRepository) UpdateProfile(userID uint, nickname, avatarURL string) (*model.User, error) {
+	query := `
+		UPDATE users SET nickname = $2, avatar_url = $3
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at, status_emoji, status_text, status_expires_at;
+	`
+	var user model.User
+	var status userStatusRow
+	err := r.db.QueryRow(query, userID, nickname, avatarURL).
+		Scan(&user.ID, &user.Nickname, &user.Email, &user.PasswordHash, &user.AvatarURL, &user.EmailVerified, &user.TwoFactorEnabled, &user.IsBot, &user.CreatedAt,
+			&status.emoji, &status.text, &status.expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if uniqueErr := uniqueUserViolation(err); uniqueErr != nil {
+			return nil, uniqueErr
+		}
+		return nil, fmt.Errorf("failed to update profile: %v", err)
+	}
+	user.Status = status.toModel()
+	return &user, nil
+}
+
+// UpdateStatus sets the custom status of the user and returns the updated user. An empty emoji and text clear the status. Returns nil if the user is not found.
+func (r *UserRepository) UpdateStatus(userID uint, emoji, text string, expiresAt *time.Time) (*model.User, error) {
+	query := `
+		UPDATE users u SET status_emoji = $2, status_text = $3, status_expires_at = $4
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+		RETURNING ` + userColumns
+	user, err := scanUser(r.db.QueryRow(query, userID, emoji, text, expiresAt))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update status: %v", err)
+	}
+	return &user, nil
+}
+
+// ClearExpiredStatuses clears the statuses which have expired and returns the users whose status was cleared
+func (r *UserRepository) ClearExpiredStatuses() ([]model.User, error) {
+	query := `
+		UPDATE users SET status_emoji = '', status_text = '', status_expires_at = NULL
+		WHERE status_expires_at <= NOW()
+		RETURNING id, nickname, email, avatar_url, is_bot, created_at;
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear expired statuses: %v", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.Nickname, &user.Email, &user.AvatarURL, &user.IsBot, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user data: %v", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to clear expired statuses: %v", err)
+	}
+	return users, nil
+}
+
+// UpdateAvatarURL sets the avatar of the user
+func (r *UserRepository) UpdateAvatarURL(userID uint, avatarURL string) error {
+	_, err := r.db.Exec("UPDATE users SET avatar_url = $2 WHERE id = $1 AND deleted_at IS NULL", userID, avatarURL)
+	if err != nil {
+		return fmt.Errorf("failed to update avatar: %v", err)
+	}
+	return nil
+}
+
+// FindSettings returns the settings of the user. Returns nil if user is not found.
+func (r *UserRepository) FindSettings(userID uint) (*model.UserSettings, error) {
+	var settings model.UserSettings
+	err := r.db.QueryRow("SELECT only_contacts_can_message, read_receipts_enabled, last_seen_visibility FROM users WHERE id = $1", userID).
+		Scan(&settings.OnlyContactsCanMessage, &settings.ReadReceipts, &settings.LastSeenVisibility)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find settings: %v", err)
+	}
+	return &settings, nil
+}
+
+// UpdateSettings stores the settings of the user
+func (r *UserRepository) UpdateSettings(userID uint, settings model.UserSettings) error {
+	_, err := r.db.Exec("UPDATE users SET only_contacts_can_message = $2, read_receipts_enabled = $3, last_seen_visibility = $4 WHERE id = $1",
+		userID, settings.OnlyContactsCanMessage, settings.ReadReceipts, settings.LastSeenVisibility)
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %v", err)
+	}
+	return nil
+}
+
+// UpdateLastSeen sets when the user was last online to now
+func (r *UserRepository) UpdateLastSeen(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET last_seen_at = NOW() WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last seen: %v", err)
+	}
+	return nil
+}
+
+// FindLastSeenVisibleTo returns when the users were last online, for those of the users whose last seen time the viewer may see.
+// A user's last seen time is visible if their visibility setting allows the viewer and the viewer's setting allows the user, so that hiding it also hides the others'.
+// Users missing from the map are hidden from the viewer. The time is nil for visible users who have never been online.
+func (r *UserRepository) FindLastSeenVisibleTo(viewerID uint, userIDs []uint) (map[uint]*time.Time, error) {
+	query := `
+		SELECT u.id, u.last_seen_at
+		FROM users u
+		INNER JOIN users viewer ON viewer.id = $1
+		WHERE u.id = ANY($2::int[]) AND u.deleted_at IS NULL
+		AND (
+			u.id = viewer.id
+			OR (
+				(u.last_seen_visibility = 'EVERYONE' OR (u.last_seen_visibility = 'CONTACTS' AND EXISTS (SELECT 1 FROM contacts WHERE user_id = u.id AND contact_id = viewer.id)))
+				AND (viewer.last_seen_visibility = 'EVERYONE' OR (viewer.last_seen_visibility = 'CONTACTS' AND EXISTS (SELECT 1 FROM contacts WHERE user_id = viewer.id AND contact_id = u.id)))
+			)
+		)
+	`
+	userIDsInt := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		userIDsInt[i] = int64(id)
+	}
+	rows, err := r.db.Query(query, viewerID, pq.Array(userIDsInt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last seen: %v", err)
+	}
+	defer rows.Close()
+
+	lastSeen := make(map[uint]*time.Time, len(userIDs))
+	for rows.Next() {
+		var userID uint
+		var lastSeenAt sql.NullTime
+		if err := rows.Scan(&userID, &lastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan last seen: %v", err)
+		}
+		lastSeen[userID] = nil
+		if lastSeenAt.Valid {
+			lastSeen[userID] = &lastSeenAt.Time
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find last seen: %v", err)
+	}
+	return lastSeen, nil
+}
+
+// DeleteUser anonymises the user in one transaction: personal data and credentials are erased, sessions and API keys (also of the user's bots) are revoked
+// and the user is removed from their chatrooms. The row is kept so that the user's messages still have a sender.
+func (r *UserRepository) DeleteUser(userID uint) (*model.DeletedAccount, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	deletedAccount, err := r.DeleteUserTx(tx, userID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return deletedAccount, nil
+}
+
+func (r *UserRepository) DeleteUserTx(tx *sql.Tx, userID uint) (*model.DeletedAccount, error) {
+	deletedAccount := &model.DeletedAccount{}
+	var err error
+	deletedAccount.ChatroomIDs, err = queryIDs(tx, "DELETE FROM chatroom_participants WHERE user_id = $1 RETURNING chatroom_id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove user from chatrooms: %v", err)
+	}
+	// groups owned by the user get a new owner
+	if _, err := promoteOwnerSuccessorsTx(tx, deletedAccount.ChatroomIDs); err != nil {
+		return nil, err
+	}
+	deletedAccount.SessionIDs, err = queryIDs(tx, "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL RETURNING id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	statements := []string{
+		"DELETE FROM message_views WHERE user_id = $1",
+		"DELETE FROM user_tokens WHERE user_id = $1",
+		"DELETE FROM user_recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1",
+		"DELETE FROM user_mutes WHERE muter_id = $1 OR muted_id = $1",
+		"DELETE FROM contacts WHERE user_id = $1 OR contact_id = $1",
+		"DELETE FROM contact_requests WHERE sender_id = $1 OR recipient_id = $1",
+		// archives of ready exports are removed by the data export job
+		"DELETE FROM data_exports WHERE user_id = $1 AND status IN ('PENDING', 'PROCESSING')",
+		"UPDATE data_exports SET expires_at = NOW() WHERE user_id = $1 AND status = 'READY'",
+		"UPDATE api_keys SET revoked_at = NOW() WHERE revoked_at IS NULL AND (user_id = $1 OR user_id IN (SELECT id FROM users WHERE bot_owner_id = $1))",
+		`UPDATE users SET nickname = '` + model.DeletedUserNickname + `', email = 'deleted-' || id || '@deleted.invalid', password_hash = '', avatar_url = '',
+			email_verified = FALSE, totp_secret = NULL, totp_enabled = FALSE, status_emoji = '', status_text = '', status_expires_at = NULL, last_seen_at = NULL, deleted_at = NOW()
+		WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			return nil, fmt.Errorf("failed to delete user: %v", err)
+		}
+	}
+	return deletedAccount, nil
+}
+
+// queryIDs runs a query returning a single ID column and collects the IDs
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) ([]uint, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint{}
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// NicknameExists tells whether a person (not a bot) already uses the nickname, compared case-insensitively
+func (r *UserRepository) NicknameExists(nickname string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(nickname) = LOWER($1) AND is_bot = FALSE AND deleted_at IS NULL)", nickname).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check nickname: %v", err)
+	}
+	return exists, nil
+}
+
+// uniqueUserViolation maps violations of the unique email and nickname indexes to ErrEmailTaken and ErrNicknameTaken. Returns nil for other errors.
+func uniqueUserViolation(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return nil
+	}
+	switch pqErr.Constraint {
+	case "users_email_lower_idx", "users_email_key":
+		return ErrEmailTaken
+	case "users_nickname_lower_idx":
+		return ErrNicknameTaken
+	}
+	return nil
+}
+
+// SetEmailVerified marks the email address of the user as verified
+func (r *UserRepository) SetEmailVerified(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET email_verified = TRUE WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email as verified: %v", err)
+	}
+	return nil
+}
+
+// UpdatePasswordHash replaces the password hash of the user
+func (r *UserRepository) UpdatePasswordHash(userID uint, passwordHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+	return nil
+}
+
+// FindTOTPSecret returns the TOTP secret of the user (empty if none was generated) and the time step of the last accepted code
+func (r *UserRepository) FindTOTPSecret(userID uint) (string, int64, error) {
+	var secret sql.NullString
+	var lastUsedStep int64
+	err := r.db.QueryRow("SELECT totp_secret, totp_last_used_step FROM users WHERE id = $1", userID).Scan(&secret, &lastUsedStep)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to find totp secret: %v", err)
+	}
+	return secret.String, lastUsedStep, nil
+}
+
+// SetPendingTOTPSecret stores a new TOTP secret for the user. Two-factor authentication stays disabled until EnableTOTP is called.
+func (r *UserRepository) SetPendingTOTPSecret(userID uint, secret string) error {
+	_, err := r.db.Exec("UPDATE users SET totp_secret = $1, totp_enabled = FALSE, totp_last_used_step = 0 WHERE id = $2", secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set totp secret: %v", err)
+	}
+	return nil
+}
+
+// EnableTOTP enables two-factor authentication with the stored TOTP secret
+func (r *UserRepository) EnableTOTP(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET totp_enabled = TRUE WHERE id = $1 AND totp_secret IS NOT NULL", userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %v", err)
+	}
+	return nil
+}
+
+// DisableTOTP disables two-factor authentication and removes the TOTP secret of the user
+func (r *UserRepository) DisableTOTP(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_used_step = 0 WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable totp: %v", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code. Returns false if a code of the same or a later step was already used.
+func (r *UserRepository) UseTOTPStep(userID uint, step int64) (bool, error) {
+	result, err := r.db.Exec("UPDATE users SET totp_last_used_step = $1 WHERE id = $2 AND totp_last_used_step < $1", step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// StartTwoFactorAttempt counts a second factor attempt of the user before the code is checked, so that parallel attempts can't exceed the limit.
+// The attempt which reaches maxAttempts locks the second factor for lockMinutes, after which the counter starts over.
+// Returns false without counting if the second factor is locked.
+func (r *UserRepository) StartTwoFactorAttempt(userID uint, maxAttempts, lockMinutes int) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE users SET
+			two_factor_failed_attempts = CASE WHEN two_factor_locked_until IS NULL THEN two_factor_failed_attempts + 1 ELSE 1 END,
+			two_factor_locked_until = CASE WHEN (CASE WHEN two_factor_locked_until IS NULL THEN two_factor_failed_attempts + 1 ELSE 1 END) >= $1
+				THEN NOW() + make_interval(mins => $2) END
+		WHERE id = $3 AND (two_factor_locked_until IS NULL OR two_factor_locked_until <= NOW())`, maxAttempts, lockMinutes, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to start two-factor attempt: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ResetFailedTwoFactorAttempts clears the failed second factor attempts and the lock of the user
+func (r *UserRepository) ResetFailedTwoFactorAttempts(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET two_factor_failed_attempts = 0, two_factor_locked_until = NULL WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed two-factor attempts: %v", err)
+	}
+	return nil
+}
+
+// AddBotUser adds a new bot user owned by the given user. Bots have no password and can only authenticate with API keys.
+func (r *UserRepository) AddBotUser(bot model.User, ownerID uint) (model.User, error) {
+	query := `
+		INSERT INTO users (nickname, email, password_hash, avatar_url, email_verified, is_bot, bot_owner_id)
+		VALUES ($1, $2, '', $3, TRUE, TRUE, $4)
+		RETURNING id, nickname, email, password_hash, avatar_url, email_verified, totp_enabled, is_bot, created_at;
+	`
+	var newUser model.User
+	err := r.db.QueryRow(query, bot.Nickname, bot.Email, bot.AvatarURL, ownerID).
+		Scan(&newUser.ID, &newUser.Nickname, &newUser.Email, &newUser.PasswordHash, &newUser.AvatarURL, &newUser.EmailVerified, &newUser.TwoFactorEnabled, &newUser.IsBot, &newUser.CreatedAt)
+	if err != nil {
+		return model.User{}, fmt.Errorf("failed to add a new bot: %v", err)
+	}
+
+	return newUser, nil
+}
+
+// FindBotsByOwnerID fetches the bots owned by the user
+func (r *UserRepository) FindBotsByOwnerID(ownerID uint) ([]model.User, error) {
+	query := `
+		SELECT id, nickname, email, avatar_url, is_bot, created_at
+		FROM users
+		WHERE is_bot = TRUE AND bot_owner_id = $1
+		ORDER BY created_at
+	`
+	rows, err := r.db.Query(query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find bots: %v", err)
+	}
+	defer rows.Close()
+
+	bots := []model.User{}
+	for rows.Next() {
+		var bot model.User
+		if err := rows.Scan(&bot.ID, &bot.Nickname, &bot.Email, &bot.AvatarURL, &bot.IsBot, &bot.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan bot data: %v", err)
+		}
+		bots = append(bots, bot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find bots: %v", err)
+	}
+	return bots, nil
+}
+
+// IsBotOwner checks whether the user owns the bot
+func (r *UserRepository) IsBotOwner(botID, ownerID uint) (bool, error) {
+	var isOwner bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND is_bot = TRUE AND bot_owner_id = $2)", botID, ownerID).Scan(&isOwner)
+	if err != nil {
+		return false, fmt.Errorf("failed to check bot owner: %v", err)
+	}
+	return isOwner, nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM chatroom_participants WHERE user_id = \\$1 RETURNING chatroom_id").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"chatroom_id"}).AddRow(1).AddRow(3))
+	mock.ExpectQuery("UPDATE chatroom_participants cp SET role = \\$2").
+		WithArgs(sqlmock.AnyArg(), "OWNER", "ADMIN").
+		WillReturnRows(sqlmock.NewRows([]string{"chatroom_id", "user_id"}).AddRow(3, 8))
+	mock.ExpectQuery("UPDATE user_sessions SET revoked_at = NOW\\(\\) WHERE user_id = \\$1 AND revoked_at IS NULL RETURNING id").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	mock.ExpectExec("DELETE FROM message_views").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("DELETE FROM user_tokens").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM user_recovery_codes").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM user_identities").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM user_blocks").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM user_mutes").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM contacts").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM contact_requests").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM data_exports").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE data_exports SET expires_at = NOW\\(\\)").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at = NOW\\(\\)").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET nickname = 'Deleted user'").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	deletedAccount, err := repo.DeleteUser(7)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 3}, deletedAccount.ChatroomIDs)
+	assert.Equal(t, []uint{12}, deletedAccount.SessionIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindUserBySearchTerm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	createdAt := time.Now()
+	columns := []string{"id", "nickname", "email", "avatar_url", "is_bot", "created_at", "status_emoji", "status_text", "status_expires_at", "tier", "score"}
+	// Wildcards of the search term are escaped and the cursor position is passed on
+	mock.ExpectQuery("WITH hits AS \\( SELECT u.id, u.nickname, u.email, u.avatar_url, u.is_bot, u.created_at,").
+		WithArgs("al\\_ice", "al_ice", 1, sqlmock.AnyArg(), false, 2, 900, 3, 11).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, "al_ice", "alice@example.com", nil, false, createdAt, "", "", nil, 1, 1000).
+			AddRow(4, "al_ice2", "alice2@example.com", "/a.jpg", false, createdAt, "🌴", "On vacation", nil, 0, 900))
+
+	hits, err := repo.FindUserBySearchTerm(" Al_ice ", 1, []uint{1}, &UserSearchCursor{Tier: 2, Score: 900, ID: 3}, 11)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 2)
+	assert.Equal(t, uint(5), hits[0].User.ID)
+	assert.Equal(t, 1, hits[0].Tier)
+	assert.Equal(t, 1000, hits[0].Score)
+	assert.Empty(t, hits[0].User.PasswordHash)
+	assert.Nil(t, hits[0].User.Status)
+	assert.Equal(t, "/a.jpg", hits[1].User.AvatarURL)
+	assert.Equal(t, "On vacation", hits[1].User.Status.Text)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindDirectoryPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	createdAt := time.Now()
+	isBot := false
+	hasAvatar := true
+	columns := []string{"id", "nickname", "email", "avatar_url", "is_bot", "created_at", "status_emoji", "status_text", "status_expires_at"}
+	// Filters and the cursor position are passed as arguments and the keyset comparison follows the sort direction
+	mock.ExpectQuery("SELECT u.id, u.nickname, .* FROM users u WHERE u.deleted_at IS NULL AND COALESCE\\(u.avatar_url, ''\\) <> '' AND u.is_bot = \\$1 AND \\(u.created_at, u.id\\) < \\(\\$2, \\$3\\) ORDER BY u.created_at DESC, u.id DESC LIMIT \\$4").
+		WithArgs(false, createdAt, 7, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(6, "bob", "bob@example.com", "/b.jpg", false, createdAt, "", "", nil))
+
+	users, err := repo.FindDirectoryPage(
+		model.UserDirectoryFilter{Sort: model.UserDirectorySortCreatedAt, Descending: true, HasAvatar: &hasAvatar, IsBot: &isBot},
+		&UserDirectoryCursor{Sort: model.UserDirectorySortCreatedAt, Descending: true, CreatedAt: createdAt, ID: 7}, 3)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, uint(6), users[0].ID)
+	assert.Equal(t, "/b.jpg", users[0].AvatarURL)
+	assert.Nil(t, users[0].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartTwoFactorAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	// The attempt is counted in the same statement which checks the lock
+	mock.ExpectExec("UPDATE users SET two_factor_failed_attempts = (.+) WHERE id = \\$3 AND \\(two_factor_locked_until IS NULL OR two_factor_locked_until <= NOW\\(\\)\\)").
+		WithArgs(5, 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	started, err := repo.StartTwoFactorAttempt(7, 5, 5)
+	assert.NoError(t, err)
+	assert.True(t, started)
+
+	// While the second factor is locked, no row matches
+	mock.ExpectExec("UPDATE users SET two_factor_failed_attempts").
+		WithArgs(5, 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	started, err = repo.StartTwoFactorAttempt(7, 5, 5)
+	assert.NoError(t, err)
+	assert.False(t, started)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
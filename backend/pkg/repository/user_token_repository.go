@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"backend/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+type UserTokenRepository struct {
+	db *sql.DB
+}
+
+// NewUserTokenRepository creates a new instance of UserTokenRepository with the given database connection.
+func NewUserTokenRepository(db *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// CreateToken stores a new token hash for the user. Previously issued unused tokens with the same purpose are invalidated.
+func (r *UserTokenRepository) CreateToken(userID uint, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL", userID, purpose)
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)", userID, purpose, tokenHash, expiresAt)
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("rollback failed: %v, original error: %v", rollbackErr, err)
+		}
+		return fmt.Errorf("failed to create token: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeToken marks an unused and unexpired token with the given hash and purpose as used and returns it. Returns nil if no such token exists.
+func (r *UserTokenRepository) ConsumeToken(purpose, tokenHash string) (*model.UserToken, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	`
+	var token model.UserToken
+	err := r.db.QueryRow(query, tokenHash, purpose).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume token: %v", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewUserTokenRepository(db)
+
+	usedAt := time.Now()
+	mock.ExpectQuery("UPDATE user_tokens SET used_at = NOW\\(\\) WHERE token_hash = \\$1 AND purpose = \\$2 AND used_at IS NULL AND expires_at > NOW\\(\\)").
+		WithArgs("hash", "PASSWORD_RESET").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "user_id", "purpose", "token_hash", "expires_at", "used_at", "created_at"},
+		).AddRow(1, 2, "PASSWORD_RESET", "hash", usedAt.Add(time.Hour), usedAt, usedAt))
+
+	token, err := repo.ConsumeToken("PASSWORD_RESET", "hash")
+	assert.NoError(t, err)
+	assert.NotNil(t, token)
+	assert.Equal(t, uint(2), token.UserID)
+	assert.NotNil(t, token.UsedAt)
+
+	// an already used or expired token isn't returned by the update
+	mock.ExpectQuery("UPDATE user_tokens").
+		WithArgs("hash", "PASSWORD_RESET").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "purpose", "token_hash", "expires_at", "used_at", "created_at"}))
+
+	token, err = repo.ConsumeToken("PASSWORD_RESET", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
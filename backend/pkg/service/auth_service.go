@@ -0,0 +1,209 @@
+package service
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/mailer"
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidOrExpiredToken is returned when a one-time token doesn't exist, was already used or has expired
+var ErrInvalidOrExpiredToken = errors.New("invalid or expired token")
+
+type AuthService struct {
+	userRepo         *repository.UserRepository
+	userTokenRepo    *repository.UserTokenRepository
+	recoveryCodeRepo *repository.RecoveryCodeRepository
+	mailer           mailer.Mailer
+	passwordPolicy   *PasswordPolicy
+}
+
+func NewAuthService(userRepo *repository.UserRepository, userTokenRepo *repository.UserTokenRepository, recoveryCodeRepo *repository.RecoveryCodeRepository, mailer mailer.Mailer, passwordPolicy *PasswordPolicy) *AuthService {
+	return &AuthService{userRepo: userRepo, userTokenRepo: userTokenRepo, recoveryCodeRepo: recoveryCodeRepo, mailer: mailer, passwordPolicy: passwordPolicy}
+}
+
+// SendEmailVerification issues a new email verification token for the user and mails the confirmation link to them
+func (as *AuthService) SendEmailVerification(user *model.User) error {
+	if user.EmailVerified {
+		return fmt.Errorf("email is already verified")
+	}
+	token, err := as.issueToken(user.ID, model.UserTokenPurposeEmailVerification, config.EmailVerificationTokenTTLHours*time.Hour)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%v/verify-email?token=%v", config.AppBaseURL(), url.QueryEscape(token))
+	return as.mailer.Send(mailer.Mail{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf("Hi %v,\n\nplease confirm your email address by opening the following link:\n%v\n\nThe link expires in %v hours.\n", user.Nickname, link, config.EmailVerificationTokenTTLHours),
+	})
+}
+
+// VerifyEmail consumes the email verification token and marks the email of its owner as verified
+func (as *AuthService) VerifyEmail(token string) error {
+	userToken, err := as.userTokenRepo.ConsumeToken(model.UserTokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if userToken == nil {
+		return ErrInvalidOrExpiredToken
+	}
+	return as.userRepo.SetEmailVerified(userToken.UserID)
+}
+
+// RequestPasswordReset mails a password reset link to the user with the given email. Unknown emails are ignored so that the caller can't find out which emails are registered.
+func (as *AuthService) RequestPasswordReset(email string) error {
+	user, err := as.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		log.Printf("Password reset requested for unknown email %v\n", email)
+		return nil
+	}
+	token, err := as.issueToken(user.ID, model.UserTokenPurposePasswordReset, config.PasswordResetTokenTTLMinutes*time.Minute)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%v/reset-password?token=%v", config.AppBaseURL(), url.QueryEscape(token))
+	return as.mailer.Send(mailer.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %v,\n\nyou can set a new password by opening the following link:\n%v\n\nThe link expires in %v minutes. If you didn't request a password reset, you can ignore this email.\n", user.Nickname, link, config.PasswordResetTokenTTLMinutes),
+	})
+}
+
+// ResetPassword consumes the password reset token and sets the new password for its owner. Resetting the password also proves the ownership of the email address.
+// Returns a *ValidationError if the new password doesn't satisfy the password policy, in which case the token stays valid.
+func (as *AuthService) ResetPassword(token, newPassword string) error {
+	if err := as.passwordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+	userToken, err := as.userTokenRepo.ConsumeToken(model.UserTokenPurposePasswordReset, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if userToken == nil {
+		return ErrInvalidOrExpiredToken
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := as.userRepo.UpdatePasswordHash(userToken.UserID, string(hashedPassword)); err != nil {
+		return err
+	}
+	return as.userRepo.SetEmailVerified(userToken.UserID)
+}
+
+// ChangePassword sets a new password for the user after checking the current one, or the confirmation token if the user has no password yet.
+// Returns ErrInvalidPassword if the current password is wrong, ErrPasswordNotSet if a user without a password sends no confirmation token
+// and a *ValidationError if the new password doesn't satisfy the password policy.
+func (as *AuthService) ChangePassword(userID uint, currentPassword, confirmationToken, newPassword string) error {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return err
+	}
+	// the policy is checked first, so that a rejected password doesn't use up the confirmation token
+	if err := as.passwordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+	if err := as.checkPasswordOrConfirmationToken(user, currentPassword, confirmationToken); err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return as.userRepo.UpdatePasswordHash(userID, string(hashedPassword))
+}
+
+// ConfirmIdentity checks the password of the user, or the confirmation token if the user has no password, and, if two-factor authentication is enabled, the second factor code.
+// It should precede irreversible actions like deleting the account.
+func (as *AuthService) ConfirmIdentity(userID uint, password, confirmationToken, code string) error {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := as.checkPasswordOrConfirmationToken(user, password, confirmationToken); err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return nil
+	}
+	return as.VerifySecondFactor(userID, code)
+}
+
+// SendIdentityConfirmation mails a confirmation token to a user without a password, which they can use instead of the password to confirm their identity.
+// Returns ErrPasswordAlreadySet if the user has a password.
+func (as *AuthService) SendIdentityConfirmation(userID uint) error {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" {
+		return ErrPasswordAlreadySet
+	}
+	token, err := as.issueToken(user.ID, model.UserTokenPurposeIdentityConfirmation, config.IdentityConfirmationTokenTTLMinutes*time.Minute)
+	if err != nil {
+		return err
+	}
+	return as.mailer.Send(mailer.Mail{
+		To:      user.Email,
+		Subject: "Confirm it's you",
+		Body:    fmt.Sprintf("Hi %v,\n\nuse the following confirmation token to confirm it's you:\n%v\n\nThe token expires in %v minutes. If you didn't request it, you can ignore this email.\n", user.Nickname, token, config.IdentityConfirmationTokenTTLMinutes),
+	})
+}
+
+// checkPasswordOrConfirmationToken checks the password of the user or, if the user has no password, consumes the confirmation token sent to them
+func (as *AuthService) checkPasswordOrConfirmationToken(user *model.User, password, confirmationToken string) error {
+	if user.PasswordHash != "" || confirmationToken == "" {
+		return checkPassword(user, password)
+	}
+	userToken, err := as.userTokenRepo.ConsumeToken(model.UserTokenPurposeIdentityConfirmation, hashToken(confirmationToken))
+	if err != nil {
+		return err
+	}
+	if userToken == nil || userToken.UserID != user.ID {
+		return ErrInvalidOrExpiredToken
+	}
+	return nil
+}
+
+// issueToken generates a new random token for the user and stores its hash. Returns the raw token that should be delivered to the user.
+func (as *AuthService) issueToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := generateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := as.userTokenRepo.CreateToken(userID, purpose, hashToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// generateRandomToken generates a URL safe random token with 256 bits of entropy
+func generateRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("couldn't generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the token. Tokens are random, so a fast hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+)
+
+var (
+	// ErrUserNotFound is returned when the target user of an action doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrCannotTargetSelf is returned when users try to block or mute themselves
+	ErrCannotTargetSelf = errors.New("users can't block or mute themselves")
+	// ErrNotBlockedOrMuted is returned when removing a block or mute that doesn't exist
+	ErrNotBlockedOrMuted = errors.New("user is not blocked or muted")
+)
+
+// BlockService manages the users blocked and muted by other users
+type BlockService struct {
+	blockRepo *repository.BlockRepository
+	userRepo  *repository.UserRepository
+}
+
+func NewBlockService(blockRepo *repository.BlockRepository, userRepo *repository.UserRepository) *BlockService {
+	return &BlockService{blockRepo: blockRepo, userRepo: userRepo}
+}
+
+// BlockUser blocks the target user, who can then no longer open a private chatroom with or send private messages to the user
+func (bs *BlockService) BlockUser(userID, targetID uint) error {
+	if err := bs.checkTarget(userID, targetID); err != nil {
+		return err
+	}
+	return bs.blockRepo.BlockUser(userID, targetID)
+}
+
+// UnblockUser removes the block of the target user
+func (bs *BlockService) UnblockUser(userID, targetID uint) error {
+	unblocked, err := bs.blockRepo.UnblockUser(userID, targetID)
+	if err != nil {
+		return err
+	}
+	if !unblocked {
+		return ErrNotBlockedOrMuted
+	}
+	return nil
+}
+
+// GetBlockedUsers returns the users blocked by the user
+func (bs *BlockService) GetBlockedUsers(userID uint) ([]model.User, error) {
+	return bs.blockRepo.FindBlockedUsers(userID)
+}
+
+// MuteUser mutes the target user, whose messages then don't count as unread and don't notify the user. The user stays in the shared chatrooms.
+func (bs *BlockService) MuteUser(userID, targetID uint) error {
+	if err := bs.checkTarget(userID, targetID); err != nil {
+		return err
+	}
+	return bs.blockRepo.MuteUser(userID, targetID)
+}
+
+// UnmuteUser removes the mute of the target user
+func (bs *BlockService) UnmuteUser(userID, targetID uint) error {
+	unmuted, err := bs.blockRepo.UnmuteUser(userID, targetID)
+	if err != nil {
+		return err
+	}
+	if !unmuted {
+		return ErrNotBlockedOrMuted
+	}
+	return nil
+}
+
+// GetMutedUsers returns the users muted by the user
+func (bs *BlockService) GetMutedUsers(userID uint) ([]model.User, error) {
+	return bs.blockRepo.FindMutedUsers(userID)
+}
+
+func (bs *BlockService) checkTarget(userID, targetID uint) error {
+	if userID == targetID {
+		return ErrCannotTargetSelf
+	}
+	target, err := bs.userRepo.FindByID(targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so that API keys can be told apart from JWT tokens
+const APIKeyPrefix = "cak_"
+
+var (
+	// ErrBotNotFound is returned when the bot doesn't exist or isn't owned by the user
+	ErrBotNotFound = errors.New("bot not found")
+	// ErrAPIKeyNotFound is returned when revoking a key that doesn't exist or was already revoked
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey is returned when authenticating with an unknown, revoked or expired key
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrInvalidBotRequest is returned when the requested bot or key is incomplete or has unknown scopes
+	ErrInvalidBotRequest = errors.New("invalid bot request")
+)
+
+type BotService struct {
+	userRepo     *repository.UserRepository
+	apiKeyRepo   *repository.APIKeyRepository
+	chatroomRepo *repository.ChatroomRepository
+}
+
+func NewBotService(userRepo *repository.UserRepository, apiKeyRepo *repository.APIKeyRepository, chatroomRepo *repository.ChatroomRepository) *BotService {
+	return &BotService{userRepo: userRepo, apiKeyRepo: apiKeyRepo, chatroomRepo: chatroomRepo}
+}
+
+// CreateBot creates a new bot user owned by the user
+func (bs *BotService) CreateBot(ownerID uint, request *model.CreateBotRequest) (model.User, error) {
+	if strings.TrimSpace(request.Nickname) == "" {
+		return model.User{}, fmt.Errorf("%w: nickname should be specified", ErrInvalidBotRequest)
+	}
+	// bots can't receive emails, but the email is unique and required for every user
+	suffix, err := generateRandomToken()
+	if err != nil {
+		return model.User{}, err
+	}
+	return bs.userRepo.AddBotUser(model.User{
+		Nickname:  strings.TrimSpace(request.Nickname),
+		Email:     fmt.Sprintf("bot-%v@bots.invalid", strings.ToLower(suffix[:16])),
+		AvatarURL: request.AvatarURL,
+	}, ownerID)
+}
+
+// GetBots returns the bots owned by the user
+func (bs *BotService) GetBots(ownerID uint) ([]model.User, error) {
+	return bs.userRepo.FindBotsByOwnerID(ownerID)
+}
+
+// CreateAPIKey creates a new API key for the bot of the owner. The returned key is shown only once.
+func (bs *BotService) CreateAPIKey(ownerID, botID uint, request *model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	if err := bs.checkOwner(ownerID, botID); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		return nil, fmt.Errorf("%w: name should be specified", ErrInvalidBotRequest)
+	}
+	if len(request.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope should be specified", ErrInvalidBotRequest)
+	}
+	for _, scope := range request.Scopes {
+		if !containsString(model.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %v", ErrInvalidBotRequest, scope)
+		}
+	}
+	if len(request.ChatroomIDs) == 0 {
+		return nil, fmt.Errorf("%w: at least one chatroom should be specified", ErrInvalidBotRequest)
+	}
+	// the key can't grant more than the bot itself can access
+	for _, chatroomID := range request.ChatroomIDs {
+		isParticipant, err := bs.chatroomRepo.IsParticipant(chatroomID, botID)
+		if err != nil {
+			return nil, err
+		}
+		if !isParticipant {
+			return nil, fmt.Errorf("%w: the bot is not a participant of chatroom %v", ErrInvalidBotRequest, chatroomID)
+		}
+	}
+
+	secret, err := generateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	key := APIKeyPrefix + secret
+	apiKey, err := bs.apiKeyRepo.CreateAPIKey(model.APIKey{
+		UserID:      botID,
+		Name:        strings.TrimSpace(request.Name),
+		Prefix:      key[:len(APIKeyPrefix)+8],
+		Scopes:      request.Scopes,
+		ChatroomIDs: request.ChatroomIDs,
+		ExpiresAt:   request.ExpiresAt,
+	}, hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	return &model.CreatedAPIKey{APIKey: *apiKey, Key: key}, nil
+}
+
+// GetAPIKeys returns all keys of the bot of the owner
+func (bs *BotService) GetAPIKeys(ownerID, botID uint) ([]model.APIKey, error) {
+	if err := bs.checkOwner(ownerID, botID); err != nil {
+		return nil, err
+	}
+	return bs.apiKeyRepo.FindAPIKeysByUserID(botID)
+}
+
+// RevokeAPIKey revokes the key of the bot of the owner. The key stops working immediately.
+func (bs *BotService) RevokeAPIKey(ownerID, botID, keyID uint) error {
+	if err := bs.checkOwner(ownerID, botID); err != nil {
+		return err
+	}
+	revoked, err := bs.apiKeyRepo.RevokeAPIKey(botID, keyID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the active API key matching the raw key
+func (bs *BotService) AuthenticateAPIKey(key string) (*model.APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := bs.apiKeyRepo.FindActiveAPIKeyByHash(hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if err := bs.apiKeyRepo.TouchAPIKey(apiKey.ID); err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (bs *BotService) checkOwner(ownerID, botID uint) error {
+	isOwner, err := bs.userRepo.IsBotOwner(botID, ownerID)
+	if err != nil {
+		return err
+	}
+	if !isOwner {
+		return ErrBotNotFound
+	}
+	return nil
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
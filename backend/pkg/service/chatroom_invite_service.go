@@ -0,0 +1,151 @@
+package service
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrChatroomInviteNotFound is returned when the invite doesn't exist, was revoked, has expired or has been used up
+	ErrChatroomInviteNotFound = errors.New("invite not found or no longer valid")
+	// ErrAlreadyParticipant is returned when the user redeeming an invite already participates in the chatroom
+	ErrAlreadyParticipant = errors.New("user is already a participant of the chatroom")
+	// ErrJoinRequestNotFound is returned when the join request doesn't exist or was already answered
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	// ErrInvalidChatroomInvite is returned when the requested invite has invalid limits
+	ErrInvalidChatroomInvite = errors.New("invalid invite")
+	// ErrPublicChatroomNotFound is returned when joining a chatroom which doesn't exist or isn't public
+	ErrPublicChatroomNotFound = errors.New("public chatroom not found")
+)
+
+// chatroomInvitePrefixLength is how many characters of the token are kept to recognise an invite
+const chatroomInvitePrefixLength = 8
+
+// ChatroomInviteService manages the invite links and join requests of group chatrooms
+type ChatroomInviteService struct {
+	inviteRepo   *repository.ChatroomInviteRepository
+	chatroomRepo *repository.ChatroomRepository
+}
+
+func NewChatroomInviteService(inviteRepo *repository.ChatroomInviteRepository, chatroomRepo *repository.ChatroomRepository) *ChatroomInviteService {
+	return &ChatroomInviteService{inviteRepo: inviteRepo, chatroomRepo: chatroomRepo}
+}
+
+// CreateInvite creates an invite to the group chatroom if the acting user may add members. The returned token is shown only once.
+func (is *ChatroomInviteService) CreateInvite(actorID, chatroomID uint, request *model.CreateChatroomInviteRequest) (*model.CreatedChatroomInvite, error) {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return nil, err
+	}
+	if request.MaxUses != nil && *request.MaxUses < 1 {
+		return nil, fmt.Errorf("%w: maxUses should be at least 1", ErrInvalidChatroomInvite)
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiresAt should be in the future", ErrInvalidChatroomInvite)
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	invite, err := is.inviteRepo.CreateInvite(model.ChatroomInvite{
+		ChatroomID:       chatroomID,
+		CreatedByID:      actorID,
+		Prefix:           token[:chatroomInvitePrefixLength],
+		MaxUses:          request.MaxUses,
+		RequiresApproval: request.RequiresApproval,
+		ExpiresAt:        request.ExpiresAt,
+	}, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return &model.CreatedChatroomInvite{ChatroomInvite: *invite, Token: token}, nil
+}
+
+// GetInvites returns the invites of the group chatroom which weren't revoked
+func (is *ChatroomInviteService) GetInvites(actorID, chatroomID uint) ([]model.ChatroomInvite, error) {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return nil, err
+	}
+	return is.inviteRepo.FindInvitesByChatroomID(chatroomID)
+}
+
+// RevokeInvite revokes an invite of the group chatroom, so that it can't be redeemed anymore
+func (is *ChatroomInviteService) RevokeInvite(actorID, chatroomID, inviteID uint) error {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return err
+	}
+	err := is.inviteRepo.RevokeInvite(chatroomID, inviteID)
+	if errors.Is(err, repository.ErrChatroomInviteNotFound) {
+		return ErrChatroomInviteNotFound
+	}
+	return err
+}
+
+// RedeemInvite lets the user join the chatroom of the invite, or creates a join request if the invite requires approval
+func (is *ChatroomInviteService) RedeemInvite(userID uint, token string) (*model.RedeemedChatroomInvite, error) {
+	redeemed, err := is.inviteRepo.RedeemInvite(hashToken(token), userID)
+	switch {
+	case errors.Is(err, repository.ErrChatroomInviteNotFound):
+		return nil, ErrChatroomInviteNotFound
+	case errors.Is(err, repository.ErrAlreadyParticipant):
+		return nil, ErrAlreadyParticipant
+	}
+	return redeemed, err
+}
+
+// JoinPublicChatroom lets the user join a public chatroom from the directory, or creates a join request if the chatroom requires approval
+func (is *ChatroomInviteService) JoinPublicChatroom(userID, chatroomID uint) (*model.RedeemedChatroomInvite, error) {
+	joined, err := is.inviteRepo.JoinPublicChatroom(chatroomID, userID)
+	switch {
+	case errors.Is(err, repository.ErrPublicChatroomNotFound):
+		return nil, ErrPublicChatroomNotFound
+	case errors.Is(err, repository.ErrAlreadyParticipant):
+		return nil, ErrAlreadyParticipant
+	}
+	return joined, err
+}
+
+// GetJoinRequestApproverIDs returns the participants of the group chatroom who can approve join requests
+func (is *ChatroomInviteService) GetJoinRequestApproverIDs(chatroomID uint) ([]uint, error) {
+	return is.chatroomRepo.FindParticipantIDsWithRoles(chatroomID, model.ChatroomRoleOwner, model.ChatroomRoleAdmin)
+}
+
+// GetJoinRequests returns the pending join requests of the group chatroom
+func (is *ChatroomInviteService) GetJoinRequests(actorID, chatroomID uint) ([]model.ChatroomJoinRequest, error) {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return nil, err
+	}
+	return is.inviteRepo.FindPendingJoinRequests(chatroomID)
+}
+
+// ApproveJoinRequest adds the user of a pending join request to the group chatroom
+func (is *ChatroomInviteService) ApproveJoinRequest(actorID, chatroomID, requestID uint) (*model.ParticipantJoined, error) {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return nil, err
+	}
+	request, message, err := is.inviteRepo.ApproveJoinRequest(chatroomID, requestID, actorID)
+	switch {
+	case errors.Is(err, repository.ErrJoinRequestNotFound):
+		return nil, ErrJoinRequestNotFound
+	case errors.Is(err, repository.ErrAlreadyParticipant):
+		return nil, ErrAlreadyParticipant
+	case err != nil:
+		return nil, err
+	}
+	return &model.ParticipantJoined{ChatroomID: chatroomID, UserID: request.UserID, SystemMessage: *message}, nil
+}
+
+// DeclineJoinRequest declines a pending join request of the group chatroom
+func (is *ChatroomInviteService) DeclineJoinRequest(actorID, chatroomID, requestID uint) (*model.ChatroomJoinRequest, error) {
+	if _, err := authorizeParticipant(is.chatroomRepo, chatroomID, actorID, model.ChatroomPermissionAddMembers); err != nil {
+		return nil, err
+	}
+	request, err := is.inviteRepo.DeclineJoinRequest(chatroomID, requestID, actorID)
+	if errors.Is(err, repository.ErrJoinRequestNotFound) {
+		return nil, ErrJoinRequestNotFound
+	}
+	return request, err
+}
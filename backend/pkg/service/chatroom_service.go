@@ -1,44 +1,205 @@
 package service
 
 import (
+	"backend/pkg/avatar"
+	"backend/pkg/config"
 	"backend/pkg/model"
 	"backend/pkg/repository"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	// ErrChatroomPermissionDenied is returned when the acting user is not a participant of the group chatroom or their role doesn't allow the action
+	ErrChatroomPermissionDenied = errors.New("not allowed to do this in the chatroom")
+	// ErrParticipantNotFound is returned when the target user of an action is not a participant of the chatroom
+	ErrParticipantNotFound = errors.New("participant not found")
+	// ErrMessageNotFound is returned when the message doesn't exist in the chatroom or can't be pinned
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrMessageAlreadyPinned is returned when pinning a message which is already pinned
+	ErrMessageAlreadyPinned = errors.New("message is already pinned")
+	// ErrPinLimitReached is returned when the chatroom already has the maximum number of pinned messages
+	ErrPinLimitReached = fmt.Errorf("a chatroom can have at most %v pinned messages", config.PinnedMessagesMaxCount)
+	// ErrPinnedMessageNotFound is returned when unpinning a message which isn't pinned
+	ErrPinnedMessageNotFound = errors.New("pinned message not found")
 )
 
 type ChatroomService struct {
-	chatroomRepo *repository.ChatroomRepository
+	chatroomRepo      *repository.ChatroomRepository
+	pinnedMessageRepo *repository.PinnedMessageRepository
+	blockRepo         *repository.BlockRepository
+	contactRepo       *repository.ContactRepository
+	avatarStorage     *avatar.Storage
 }
 
-func NewChatroomService(repo *repository.ChatroomRepository) *ChatroomService {
-	return &ChatroomService{chatroomRepo: repo}
+func NewChatroomService(repo *repository.ChatroomRepository, pinnedMessageRepo *repository.PinnedMessageRepository, blockRepo *repository.BlockRepository, contactRepo *repository.ContactRepository,
+	avatarStorage *avatar.Storage) *ChatroomService {
+	return &ChatroomService{chatroomRepo: repo, pinnedMessageRepo: pinnedMessageRepo, blockRepo: blockRepo, contactRepo: contactRepo, avatarStorage: avatarStorage}
 }
 
+// GetChatroomById returns the chatroom with a page of its messages and the pinned messages. Returns ErrChatroomPermissionDenied if the user is not a participant.
 func (cs *ChatroomService) GetChatroomById(chatroomID, userID uint, page, pageSize int) (*model.ChatroomForUser, error) {
-	return cs.chatroomRepo.FindByID(chatroomID, userID, page, pageSize)
+	if err := cs.authorizeParticipant(chatroomID, userID); err != nil {
+		return nil, err
+	}
+	chatroom, err := cs.chatroomRepo.FindByID(chatroomID, userID, page, pageSize)
+	if err != nil || chatroom == nil {
+		return chatroom, err
+	}
+	if err := cs.prepareMessages(userID, chatroomID, chatroom.IsChannel, chatroom.Messages); err != nil {
+		return nil, err
+	}
+	userSettings, err := cs.chatroomRepo.FindUserSettings(chatroomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	chatroom.UserSettings = *userSettings
+	if err := cs.addPinnedMessages(chatroom, userID); err != nil {
+		return nil, err
+	}
+	return chatroom, nil
 }
 
-func (cs *ChatroomService) GetChatroomsByUserId(userId uint, page, pageSize int) ([]model.ChatroomForUser, error) {
-	return cs.chatroomRepo.FindChatroomsByUserID(userId, page, pageSize)
+// addPinnedMessages adds the pinned messages to the chatroom as the user sees them. The user must already be checked to be a participant.
+func (cs *ChatroomService) addPinnedMessages(chatroom *model.ChatroomForUser, userID uint) error {
+	pinnedMessages, err := cs.pinnedMessageRepo.FindPinnedMessages(chatroom.ID)
+	if err != nil {
+		return err
+	}
+	pinned := make([]model.ChatMessage, len(pinnedMessages))
+	for i := range pinnedMessages {
+		pinned[i] = pinnedMessages[i].Message
+	}
+	if err := cs.prepareMessages(userID, chatroom.ID, chatroom.IsChannel, pinned); err != nil {
+		return err
+	}
+	for i := range pinnedMessages {
+		pinnedMessages[i].Message = pinned[i]
+	}
+	chatroom.PinnedMessages = pinnedMessages
+	return nil
+}
+
+// GetChatList returns a page of the user's chat list selected by the filter. Private chatrooms are named after and show the avatar of the other participant.
+func (cs *ChatroomService) GetChatList(userID uint, filter model.ChatroomFilter, cursor string, pageSize int) (model.ChatList, error) {
+	var after *repository.ChatListCursor
+	if cursor != "" {
+		after = &repository.ChatListCursor{}
+		if err := decodeCursor(cursor, after); err != nil {
+			return model.ChatList{}, err
+		}
+	}
+	// Fetch one extra chatroom to know whether there is a next page
+	chatrooms, err := cs.chatroomRepo.FindChatroomsByUserID(userID, filter, after, pageSize+1)
+	if err != nil {
+		return model.ChatList{}, err
+	}
+
+	list := model.ChatList{Chatrooms: chatrooms}
+	if len(chatrooms) > pageSize {
+		list.Chatrooms = chatrooms[:pageSize]
+		next := repository.NewChatListCursor(list.Chatrooms[len(list.Chatrooms)-1])
+		if list.NextCursor, err = encodeCursor(next); err != nil {
+			return model.ChatList{}, err
+		}
+	}
+
+	// the previews are spread over the chatrooms, so their read receipts are hidden here instead of with hideReadReceipts
+	readReceiptsEnabled, err := cs.chatroomRepo.AreReadReceiptsEnabled(userID)
+	if err != nil {
+		return model.ChatList{}, err
+	}
+	for i := range list.Chatrooms {
+		chatroom := &list.Chatrooms[i]
+		if other := chatroom.OtherParticipant; other != nil {
+			chatroom.ChatroomName = other.Nickname
+			if chatroom.ChatroomName == "" {
+				chatroom.ChatroomName = other.Email
+			}
+			chatroom.ChatroomPictureURL = avatar.URLForSize(other.AvatarURL, config.ChatroomPictureAvatarSize)
+		}
+		if chatroom.LastMessage != nil && !readReceiptsEnabled && chatroom.LastMessage.SenderID == userID {
+			chatroom.LastMessage.Viewed = false
+		}
+	}
+	return list, nil
+}
+
+// GetPublicChatroomsPage returns a page of the public chatrooms whose name or description contain the search term
+func (cs *ChatroomService) GetPublicChatroomsPage(term, cursor string, pageSize int) (model.PublicChatroomPage, error) {
+	var after *repository.PublicChatroomCursor
+	if cursor != "" {
+		after = &repository.PublicChatroomCursor{}
+		if err := decodeCursor(cursor, after); err != nil {
+			return model.PublicChatroomPage{}, err
+		}
+	}
+	// Fetch one extra chatroom to know whether there is a next page
+	chatrooms, err := cs.chatroomRepo.FindPublicChatroomsPage(strings.TrimSpace(term), after, pageSize+1)
+	if err != nil {
+		return model.PublicChatroomPage{}, err
+	}
+
+	page := model.PublicChatroomPage{Chatrooms: chatrooms}
+	if len(chatrooms) > pageSize {
+		page.Chatrooms = chatrooms[:pageSize]
+		last := page.Chatrooms[len(page.Chatrooms)-1]
+		next := repository.PublicChatroomCursor{Name: strings.ToLower(last.GroupName), ID: last.ID}
+		if page.NextCursor, err = encodeCursor(next); err != nil {
+			return model.PublicChatroomPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// UpdateUserSettings changes the settings of the chatroom which only apply to the user and returns the new settings
+func (cs *ChatroomService) UpdateUserSettings(userID, chatroomID uint, changes model.ChatroomUserSettingsChanges) (*model.ChatroomUserSettings, error) {
+	settings, err := cs.chatroomRepo.UpdateUserSettings(chatroomID, userID, changes)
+	if errors.Is(err, repository.ErrParticipantNotFound) {
+		return nil, ErrChatroomPermissionDenied
+	}
+	return settings, err
 }
 
 func (cs *ChatroomService) AddMessageToChatroom(chatroomID uint, message model.ChatMessage) (*model.ChatMessage, error) {
 	return cs.chatroomRepo.AddMessageToChatroom(chatroomID, message)
 }
 
-func (cs *ChatroomService) MarkMessageAsViewed(viewMessage *model.ViewMessage) (*model.ChatMessage, error) {
-	message, err := cs.chatroomRepo.MarkMessageAsViewed(viewMessage.ChatroomID, viewMessage.MessageID, viewMessage.ViewerID)
+// MarkMessageAsViewed marks the message as viewed by the viewer, who must be the authenticated user. In channels it advances the read cursor of the subscriber instead and returns the message with its views.
+func (cs *ChatroomService) MarkMessageAsViewed(viewerID uint, viewMessage *model.ViewMessage) (*model.ChatMessage, error) {
+	isChannel, err := cs.chatroomRepo.IsChannel(viewMessage.ChatroomID)
+	if err != nil {
+		return nil, err
+	}
+	if isChannel {
+		message, err := cs.chatroomRepo.AdvanceReadCursor(viewMessage.ChatroomID, viewMessage.MessageID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		message.Viewed = message.Views > 0
+		return message, nil
+	}
+	message, err := cs.chatroomRepo.MarkMessageAsViewed(viewMessage.ChatroomID, viewMessage.MessageID, viewerID)
 	if err != nil {
 		return nil, err
 	}
 	return message, nil
 }
 
-func (cs *ChatroomService) CreatePrivateChatroom(createOptions *model.CreatePrivateChatroom) (*model.Chatroom, error) {
-	return cs.chatroomRepo.CreatePrivateChatroomWithCreateOptions(createOptions)
+// IsChannel checks whether the chatroom is a channel
+func (cs *ChatroomService) IsChannel(chatroomID uint) (bool, error) {
+	return cs.chatroomRepo.IsChannel(chatroomID)
 }
 
-func (cs *ChatroomService) CreateGroupChatroom(createGroupChatroom *model.CreateGroupChatroom) (*model.Chatroom, error) {
+// CreatePrivateChatroom sends the first message of the actor to the private chatroom with the other participant, creating the chatroom if they don't have one yet
+func (cs *ChatroomService) CreatePrivateChatroom(actorID uint, createOptions *model.CreatePrivateChatroom) (*model.Chatroom, error) {
+	return cs.chatroomRepo.CreatePrivateChatroomWithCreateOptions(actorID, createOptions)
+}
+
+// CreateGroupChatroom creates a group chatroom owned by its creator. The creator is added to the participants if missing.
+func (cs *ChatroomService) CreateGroupChatroom(createGroupChatroom *model.CreateGroupChatroom, creatorID uint) (*model.Chatroom, error) {
 	if !createGroupChatroom.IsGroup {
 		return nil, fmt.Errorf("cannot create group chatroom: chatroom should be a group")
 	}
@@ -48,17 +209,373 @@ func (cs *ChatroomService) CreateGroupChatroom(createGroupChatroom *model.Create
 	if createGroupChatroom.GroupName == "" {
 		return nil, fmt.Errorf("cannot create group chatroom: chatroom should have a name")
 	}
-	userIDs := make([]uint, 0, len(createGroupChatroom.Participants))
+	if creatorID == 0 {
+		return nil, fmt.Errorf("cannot create group chatroom: creator should be specified")
+	}
+	userIDs := make([]uint, 0, len(createGroupChatroom.Participants)+1)
 	for _, user := range createGroupChatroom.Participants {
 		userIDs = append(userIDs, user.ID)
 	}
-	return cs.chatroomRepo.CreateGroupChatroom(createGroupChatroom.GroupName, userIDs)
+	if !containsID(userIDs, creatorID) {
+		userIDs = append(userIDs, creatorID)
+	}
+	return cs.chatroomRepo.CreateGroupChatroom(createGroupChatroom.GroupName, createGroupChatroom.IsChannel, creatorID, userIDs)
+}
+
+// UpdateGroupChatroom changes the metadata which is set in the options and adds the participants if the role of the acting user and the group settings allow it.
+// Adding users who already participate is a no-op. Returns a *ValidationError if a changed value is invalid.
+func (cs *ChatroomService) UpdateGroupChatroom(actorID uint, options *model.UpdateGroupChatroom) (*model.ChatroomUpdated, error) {
+	changes, err := NormaliseChatroomChanges(options.ChatroomChanges)
+	if err != nil {
+		return nil, err
+	}
+	options.ChatroomChanges = changes
+	chatroom, err := cs.authorizeUpdate(actorID, options.ID, options.ChatroomChanges, len(options.Participants) > 0)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := cs.chatroomRepo.UpdateGroupChatroom(actorID, options)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Changes.AvatarURL != nil {
+		cs.removeGroupAvatar(chatroom.AvatarURL)
+	}
+	return updated, nil
 }
 
-func (cs *ChatroomService) UpdateGroupChatroom(options *model.UpdateGroupChatroom) (*model.Chatroom, error) {
-	return cs.chatroomRepo.UpdateGroupChatroom(options)
+// UploadGroupAvatar generates the avatar sizes from the uploaded image, stores them and sets them as the avatar of the group chatroom. The previously uploaded avatar is removed.
+// Returns a *ValidationError if the image is not accepted.
+func (cs *ChatroomService) UploadGroupAvatar(actorID, chatroomID uint, imageData []byte) (*model.ChatroomUpdated, error) {
+	// the permission is checked before storing the files. UpdateGroupChatroom checks it again with the new URL.
+	uploadChanges := model.ChatroomChanges{AvatarURL: new(string)}
+	if _, err := cs.authorizeUpdate(actorID, chatroomID, uploadChanges, false); err != nil {
+		return nil, err
+	}
+	images, err := avatar.Process(imageData, avatar.Sizes)
+	if errors.Is(err, avatar.ErrUnsupportedImage) || errors.Is(err, avatar.ErrImageTooLarge) {
+		return nil, &ValidationError{Code: ValidationCodeInvalidAvatar, Field: "avatar", Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	avatarURL, err := cs.avatarStorage.SaveForChatroom(chatroomID, images)
+	if err != nil {
+		return nil, err
+	}
+	uploadChanges.AvatarURL = &avatarURL
+	updated, err := cs.UpdateGroupChatroom(actorID, &model.UpdateGroupChatroom{ID: chatroomID, ChatroomChanges: uploadChanges})
+	if err != nil {
+		cs.removeGroupAvatar(avatarURL)
+		return nil, err
+	}
+	return updated, nil
 }
 
-func (cs *ChatroomService) GetChatroomMessages(chatroomID uint, page, pageSize int) ([]model.ChatMessage, error) {
-	return cs.chatroomRepo.GetChatroomMessages(chatroomID, page, pageSize)
+// authorizeUpdate checks that the acting user may make the changes to the group chatroom and returns the chatroom before the changes.
+// Members can change the name, description, topic and avatar only if the group settings allow it.
+func (cs *ChatroomService) authorizeUpdate(actorID, chatroomID uint, changes model.ChatroomChanges, addsParticipants bool) (*model.Chatroom, error) {
+	role, err := cs.chatroomRepo.FindGroupParticipantRole(chatroomID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrChatroomPermissionDenied
+	}
+	chatroom, err := cs.chatroomRepo.FindGroupChatroom(chatroomID)
+	if err != nil {
+		return nil, err
+	}
+	if chatroom == nil {
+		return nil, ErrChatroomPermissionDenied
+	}
+	if changes.ChangesInfo() && !model.HasChatroomPermission(role, model.ChatroomPermissionRename) && !chatroom.Settings.MembersCanEditInfo {
+		return nil, ErrChatroomPermissionDenied
+	}
+	if changes.Settings != nil && !model.HasChatroomPermission(role, model.ChatroomPermissionChangeSettings) {
+		return nil, ErrChatroomPermissionDenied
+	}
+	if addsParticipants && !model.HasChatroomPermission(role, model.ChatroomPermissionAddMembers) {
+		return nil, ErrChatroomPermissionDenied
+	}
+	return chatroom, nil
+}
+
+// PinMessage pins a message to its chatroom. In private chatrooms both participants can pin, in groups owners and admins, and members too if the group settings allow it.
+func (cs *ChatroomService) PinMessage(actorID, chatroomID, messageID uint) (*model.PinnedMessage, error) {
+	if err := cs.authorizePin(actorID, chatroomID); err != nil {
+		return nil, err
+	}
+	pinnedMessage, err := cs.pinnedMessageRepo.PinMessage(chatroomID, messageID, actorID, config.PinnedMessagesMaxCount)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		return nil, ErrMessageNotFound
+	case errors.Is(err, repository.ErrMessageAlreadyPinned):
+		return nil, ErrMessageAlreadyPinned
+	case errors.Is(err, repository.ErrPinLimitReached):
+		return nil, ErrPinLimitReached
+	}
+	return pinnedMessage, err
+}
+
+// UnpinMessage unpins a pinned message of the chatroom. The same participants who can pin messages can unpin them.
+func (cs *ChatroomService) UnpinMessage(actorID, chatroomID, messageID uint) error {
+	if err := cs.authorizePin(actorID, chatroomID); err != nil {
+		return err
+	}
+	err := cs.pinnedMessageRepo.UnpinMessage(chatroomID, messageID)
+	if errors.Is(err, repository.ErrPinnedMessageNotFound) {
+		return ErrPinnedMessageNotFound
+	}
+	return err
+}
+
+// authorizeParticipant checks that the user is a participant of the chatroom, which is required to read its messages
+func (cs *ChatroomService) authorizeParticipant(chatroomID, userID uint) error {
+	isParticipant, err := cs.chatroomRepo.IsParticipant(chatroomID, userID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrChatroomPermissionDenied
+	}
+	return nil
+}
+
+// authorizePin checks that the acting user may pin and unpin messages in the chatroom
+func (cs *ChatroomService) authorizePin(actorID, chatroomID uint) error {
+	role, err := cs.chatroomRepo.FindGroupParticipantRole(chatroomID, actorID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		// participants of groups always have a role, so this is a private chatroom or the user isn't a participant
+		isParticipant, err := cs.chatroomRepo.IsParticipant(chatroomID, actorID)
+		if err != nil {
+			return err
+		}
+		if !isParticipant {
+			return ErrChatroomPermissionDenied
+		}
+		return nil
+	}
+	if model.HasChatroomPermission(role, model.ChatroomPermissionPinMessages) {
+		return nil
+	}
+	chatroom, err := cs.chatroomRepo.FindGroupChatroom(chatroomID)
+	if err != nil {
+		return err
+	}
+	if chatroom == nil || !chatroom.Settings.MembersCanPin {
+		return ErrChatroomPermissionDenied
+	}
+	return nil
+}
+
+// removeGroupAvatar deletes the files of a no longer used group avatar. Leftover files don't affect the users, so failures are only logged.
+func (cs *ChatroomService) removeGroupAvatar(avatarURL string) {
+	if err := cs.avatarStorage.Remove(avatarURL); err != nil {
+		log.Printf("Couldn't remove group avatar %v: %v\n", avatarURL, err)
+	}
+}
+
+// LeaveChatroom removes the acting user from the group chatroom
+func (cs *ChatroomService) LeaveChatroom(actorID, chatroomID uint) (*model.MembershipChange, error) {
+	role, err := cs.chatroomRepo.FindGroupParticipantRole(chatroomID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrParticipantNotFound
+	}
+	return cs.removeParticipant(chatroomID, actorID, actorID)
+}
+
+// RemoveParticipant removes a participant of a lower role than the acting user from the group chatroom
+func (cs *ChatroomService) RemoveParticipant(actorID, chatroomID, userID uint) (*model.MembershipChange, error) {
+	if userID == actorID {
+		return nil, fmt.Errorf("participants can't remove themselves, leave the chatroom instead")
+	}
+	actorRole, err := cs.authorize(chatroomID, actorID, model.ChatroomPermissionRemoveMembers)
+	if err != nil {
+		return nil, err
+	}
+	userRole, err := cs.chatroomRepo.FindGroupParticipantRole(chatroomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if userRole == "" {
+		return nil, ErrParticipantNotFound
+	}
+	if !model.OutranksChatroomRole(actorRole, userRole) {
+		return nil, ErrChatroomPermissionDenied
+	}
+	return cs.removeParticipant(chatroomID, userID, actorID)
+}
+
+func (cs *ChatroomService) removeParticipant(chatroomID, userID, actorID uint) (*model.MembershipChange, error) {
+	change, err := cs.chatroomRepo.RemoveParticipant(chatroomID, userID, actorID)
+	if errors.Is(err, repository.ErrParticipantNotFound) {
+		return nil, ErrParticipantNotFound
+	}
+	return change, err
+}
+
+// DeleteGroupChatroom deletes the group chatroom if the acting user is allowed to and returns the IDs of its former participants
+func (cs *ChatroomService) DeleteGroupChatroom(actorID, chatroomID uint) ([]uint, error) {
+	if _, err := cs.authorize(chatroomID, actorID, model.ChatroomPermissionDeleteGroup); err != nil {
+		return nil, err
+	}
+	return cs.chatroomRepo.DeleteGroupChatroom(chatroomID)
+}
+
+// UpdateParticipantRole promotes a participant of the group chatroom to admin or demotes an admin to member
+func (cs *ChatroomService) UpdateParticipantRole(actorID uint, request *model.UpdateParticipantRole) error {
+	if request.Role != model.ChatroomRoleAdmin && request.Role != model.ChatroomRoleMember {
+		return fmt.Errorf("role should be %v or %v", model.ChatroomRoleAdmin, model.ChatroomRoleMember)
+	}
+	if _, err := cs.authorize(request.ChatroomID, actorID, model.ChatroomPermissionManageAdmins); err != nil {
+		return err
+	}
+	if request.UserID == actorID {
+		return fmt.Errorf("the owner can't change their own role, transfer the ownership instead")
+	}
+	err := cs.chatroomRepo.UpdateParticipantRole(request.ChatroomID, request.UserID, request.Role)
+	if errors.Is(err, repository.ErrParticipantNotFound) {
+		return ErrParticipantNotFound
+	}
+	return err
+}
+
+// TransferOwnership makes another participant the owner of the group chatroom. The acting owner becomes an admin.
+func (cs *ChatroomService) TransferOwnership(actorID uint, request *model.TransferChatroomOwnership) error {
+	if _, err := cs.authorize(request.ChatroomID, actorID, model.ChatroomPermissionTransferOwnership); err != nil {
+		return err
+	}
+	if request.UserID == actorID {
+		return fmt.Errorf("the user already owns the chatroom")
+	}
+	err := cs.chatroomRepo.TransferOwnership(request.ChatroomID, actorID, request.UserID)
+	if errors.Is(err, repository.ErrParticipantNotFound) {
+		return ErrParticipantNotFound
+	}
+	return err
+}
+
+// authorize checks that the acting user participates in the group chatroom with a role which has the permission and returns the role
+func (cs *ChatroomService) authorize(chatroomID, actorID uint, permission string) (string, error) {
+	return authorizeParticipant(cs.chatroomRepo, chatroomID, actorID, permission)
+}
+
+func authorizeParticipant(chatroomRepo *repository.ChatroomRepository, chatroomID, actorID uint, permission string) (string, error) {
+	role, err := chatroomRepo.FindGroupParticipantRole(chatroomID, actorID)
+	if err != nil {
+		return "", err
+	}
+	if !model.HasChatroomPermission(role, permission) {
+		return "", ErrChatroomPermissionDenied
+	}
+	return role, nil
+}
+
+// GetChatroomMessages returns a page of messages of the chatroom as seen by the user
+// GetChatroomMessages returns a page of the messages of the chatroom. Returns ErrChatroomPermissionDenied if the user is not a participant.
+func (cs *ChatroomService) GetChatroomMessages(chatroomID, userID uint, page, pageSize int) ([]model.ChatMessage, error) {
+	if err := cs.authorizeParticipant(chatroomID, userID); err != nil {
+		return nil, err
+	}
+	messages, err := cs.chatroomRepo.GetChatroomMessages(chatroomID, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	isChannel, err := cs.chatroomRepo.IsChannel(chatroomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.prepareMessages(userID, chatroomID, isChannel, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// prepareMessages adds the views to the messages of channels and hides the read receipts the user can't see
+func (cs *ChatroomService) prepareMessages(userID, chatroomID uint, isChannel bool, messages []model.ChatMessage) error {
+	if isChannel && len(messages) > 0 {
+		messageIDs := make([]uint, len(messages))
+		for i := range messages {
+			messageIDs[i] = messages[i].ID
+		}
+		views, err := cs.chatroomRepo.FindChannelViews(chatroomID, messageIDs)
+		if err != nil {
+			return err
+		}
+		for i := range messages {
+			messages[i].Views = views[messages[i].ID]
+			messages[i].Viewed = messages[i].Views > 0
+		}
+	}
+	return cs.hideReadReceipts(userID, messages)
+}
+
+// hideReadReceipts clears the viewed flag of the user's own messages if the user disabled read receipts, because they don't see the read receipts of others then
+func (cs *ChatroomService) hideReadReceipts(userID uint, messages []model.ChatMessage) error {
+	enabled, err := cs.chatroomRepo.AreReadReceiptsEnabled(userID)
+	if err != nil || enabled {
+		return err
+	}
+	for i := range messages {
+		if messages[i].SenderID == userID {
+			messages[i].Viewed = false
+		}
+	}
+	return nil
+}
+
+// GetParticipantIDsWithoutReadReceipts returns the participants of the chatroom who disabled read receipts
+func (cs *ChatroomService) GetParticipantIDsWithoutReadReceipts(chatroomID uint) ([]uint, error) {
+	return cs.chatroomRepo.FindParticipantIDsWithoutReadReceipts(chatroomID)
+}
+
+// GetChatroomIDsByUserID returns the IDs of all chatrooms the user participates in
+func (cs *ChatroomService) GetChatroomIDsByUserID(userID uint) ([]uint, error) {
+	return cs.chatroomRepo.FindChatroomIDsByUserID(userID)
+}
+
+// IsBlockedBetween checks whether either of the users blocked the other one
+func (cs *ChatroomService) IsBlockedBetween(user1ID, user2ID uint) (bool, error) {
+	return cs.blockRepo.IsBlockedBetween(user1ID, user2ID)
+}
+
+// IsBlockedInPrivateChatroom checks whether the chatroom is private and its participants blocked each other, in which case the sender can't send messages to it
+func (cs *ChatroomService) IsBlockedInPrivateChatroom(chatroomID, senderID uint) (bool, error) {
+	return cs.blockRepo.IsBlockedInPrivateChatroom(chatroomID, senderID)
+}
+
+// IsMessagingRestricted checks whether the recipient only accepts private chatrooms from contacts and the sender is not one of them
+func (cs *ChatroomService) IsMessagingRestricted(recipientID, senderID uint) (bool, error) {
+	return cs.contactRepo.IsMessagingRestricted(recipientID, senderID)
+}
+
+// GetMuterIDs returns the IDs of the participants of the chatroom who muted the sender or the chatroom
+func (cs *ChatroomService) GetMuterIDs(chatroomID, senderID uint) ([]uint, error) {
+	return cs.blockRepo.FindMuterIDs(chatroomID, senderID)
+}
+
+// CanSendMessage checks whether the user is a participant of the chatroom who may send messages to it
+func (cs *ChatroomService) CanSendMessage(chatroomID, userID uint) (bool, error) {
+	return cs.chatroomRepo.CanSendMessage(chatroomID, userID)
+}
+
+// IsParticipant checks whether the user is a participant of the chatroom
+func (cs *ChatroomService) IsParticipant(chatroomID, userID uint) (bool, error) {
+	return cs.chatroomRepo.IsParticipant(chatroomID, userID)
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"backend/pkg/repository"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetChatroomByIdOnlyForParticipants(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %s", err)
+	}
+	defer db.Close()
+
+	chatroomService := NewChatroomService(repository.NewChatroomRepository(db), repository.NewPinnedMessageRepository(db), nil, nil, nil)
+
+	// Neither the messages nor the pinned messages of the chatroom are queried for a user who isn't a participant
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatroom_participants WHERE chatroom_id = \\$1 AND user_id = \\$2\\)").
+		WithArgs(3, 9).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	chatroom, err := chatroomService.GetChatroomById(3, 9, 1, 20)
+	assert.ErrorIs(t, err, ErrChatroomPermissionDenied)
+	assert.Nil(t, chatroom)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+)
+
+var (
+	// ErrContactRequestNotFound is returned when a contact request doesn't exist, isn't pending or the user can't answer it
+	ErrContactRequestNotFound = errors.New("contact request not found")
+	// ErrContactRequestExists is returned when the user already sent a pending request to the recipient
+	ErrContactRequestExists = errors.New("a pending contact request already exists")
+	// ErrAlreadyContacts is returned when sending a request to a contact
+	ErrAlreadyContacts = errors.New("users are already contacts")
+	// ErrContactRequestNotAllowed is returned when one of the users blocked the other one
+	ErrContactRequestNotAllowed = errors.New("contact request is not allowed")
+	// ErrContactNotFound is returned when removing a user who isn't a contact
+	ErrContactNotFound = errors.New("contact not found")
+)
+
+// ContactService manages contact requests and contacts
+type ContactService struct {
+	contactRepo *repository.ContactRepository
+	blockRepo   *repository.BlockRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewContactService(contactRepo *repository.ContactRepository, blockRepo *repository.BlockRepository, userRepo *repository.UserRepository) *ContactService {
+	return &ContactService{contactRepo: contactRepo, blockRepo: blockRepo, userRepo: userRepo}
+}
+
+// SendRequest sends a contact request from the sender to the recipient. If the recipient already sent a pending request to the sender, that request is accepted instead and returned.
+func (cs *ContactService) SendRequest(senderID, recipientID uint) (*model.ContactRequest, error) {
+	if senderID == recipientID {
+		return nil, ErrCannotTargetSelf
+	}
+	recipient, err := cs.userRepo.FindByID(recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == nil || recipient.IsBot {
+		return nil, ErrUserNotFound
+	}
+	blocked, err := cs.blockRepo.IsBlockedBetween(senderID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrContactRequestNotAllowed
+	}
+	areContacts, err := cs.contactRepo.AreContacts(senderID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if areContacts {
+		return nil, ErrAlreadyContacts
+	}
+
+	reverseRequest, err := cs.contactRepo.FindPendingRequest(recipientID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if reverseRequest != nil {
+		request, err := cs.contactRepo.AcceptRequest(reverseRequest.ID)
+		if err != nil || request != nil {
+			return request, err
+		}
+		// the reverse request was answered in the meantime, so send a new one
+	}
+
+	request, err := cs.contactRepo.CreateRequest(senderID, recipientID)
+	if errors.Is(err, repository.ErrContactRequestExists) {
+		return nil, ErrContactRequestExists
+	}
+	return request, err
+}
+
+// AcceptRequest accepts a request received by the user and makes the users contacts
+func (cs *ContactService) AcceptRequest(userID, requestID uint) (*model.ContactRequest, error) {
+	if err := cs.checkPendingRequest(requestID, func(request *model.ContactRequest) bool { return request.RecipientID == userID }); err != nil {
+		return nil, err
+	}
+	return cs.notFoundIfNil(cs.contactRepo.AcceptRequest(requestID))
+}
+
+// DeclineRequest declines a request received by the user
+func (cs *ContactService) DeclineRequest(userID, requestID uint) (*model.ContactRequest, error) {
+	if err := cs.checkPendingRequest(requestID, func(request *model.ContactRequest) bool { return request.RecipientID == userID }); err != nil {
+		return nil, err
+	}
+	return cs.notFoundIfNil(cs.contactRepo.RespondToRequest(requestID, model.ContactRequestStatusDeclined))
+}
+
+// CancelRequest cancels a request sent by the user
+func (cs *ContactService) CancelRequest(userID, requestID uint) (*model.ContactRequest, error) {
+	if err := cs.checkPendingRequest(requestID, func(request *model.ContactRequest) bool { return request.SenderID == userID }); err != nil {
+		return nil, err
+	}
+	return cs.notFoundIfNil(cs.contactRepo.RespondToRequest(requestID, model.ContactRequestStatusCancelled))
+}
+
+// GetPendingRequests returns the pending requests received (incoming) or sent by the user
+func (cs *ContactService) GetPendingRequests(userID uint, incoming bool) ([]model.ContactRequest, error) {
+	return cs.contactRepo.FindPendingRequests(userID, incoming)
+}
+
+// GetContacts returns the contacts of the user
+func (cs *ContactService) GetContacts(userID uint) ([]model.Contact, error) {
+	return cs.contactRepo.FindContacts(userID)
+}
+
+// RemoveContact removes the users from each other's contacts
+func (cs *ContactService) RemoveContact(userID, contactID uint) error {
+	removed, err := cs.contactRepo.RemoveContact(userID, contactID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+// checkPendingRequest checks that the request is pending and the user is allowed to act on it
+func (cs *ContactService) checkPendingRequest(requestID uint, isAllowed func(*model.ContactRequest) bool) error {
+	request, err := cs.contactRepo.FindRequestByID(requestID)
+	if err != nil {
+		return err
+	}
+	if request == nil || request.Status != model.ContactRequestStatusPending || !isAllowed(request) {
+		return ErrContactRequestNotFound
+	}
+	return nil
+}
+
+// notFoundIfNil handles requests which were answered concurrently and therefore are no longer pending
+func (cs *ContactService) notFoundIfNil(request *model.ContactRequest, err error) (*model.ContactRequest, error) {
+	if err == nil && request == nil {
+		return nil, ErrContactRequestNotFound
+	}
+	return request, err
+}
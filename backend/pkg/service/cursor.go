@@ -0,0 +1,31 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor was not issued by the server
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns the position of the last item of a page into an opaque cursor string
+func encodeCursor(position interface{}) (string, error) {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor reads the position encoded by encodeCursor into the given pointer. Returns ErrInvalidCursor if the cursor is malformed.
+func decodeCursor(cursor string, position interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, position); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"backend/pkg/dataexport"
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"time"
+)
+
+var (
+	// ErrDataExportInProgress is returned when the user requests an export while the previous one isn't finished
+	ErrDataExportInProgress = errors.New("a data export is already in progress")
+	// ErrDataExportNotFound is returned when the export doesn't exist or belongs to another user
+	ErrDataExportNotFound = errors.New("data export not found")
+	// ErrDataExportNotReady is returned when downloading an export which is not finished, failed or has expired
+	ErrDataExportNotReady = errors.New("data export is not ready for download")
+)
+
+// DataExportService creates archives of the personal data of users in the background
+type DataExportService struct {
+	exportRepo *repository.DataExportRepository
+	userRepo   *repository.UserRepository
+	storage    *dataexport.Storage
+	// staticDir is the directory served under /static, where uploaded files are stored
+	staticDir string
+	// ttl is how long an archive can be downloaded
+	ttl time.Duration
+}
+
+func NewDataExportService(exportRepo *repository.DataExportRepository, userRepo *repository.UserRepository, storage *dataexport.Storage, staticDir string, ttl time.Duration) *DataExportService {
+	return &DataExportService{exportRepo: exportRepo, userRepo: userRepo, storage: storage, staticDir: staticDir, ttl: ttl}
+}
+
+// RequestExport queues a new export of the personal data of the user. The archive is created by the data export job.
+func (ds *DataExportService) RequestExport(userID uint) (*model.DataExport, error) {
+	export, err := ds.exportRepo.CreateExport(userID)
+	if errors.Is(err, repository.ErrDataExportInProgress) {
+		return nil, ErrDataExportInProgress
+	}
+	return export, err
+}
+
+// GetExports returns the exports of the user, newest first
+func (ds *DataExportService) GetExports(userID uint) ([]model.DataExport, error) {
+	return ds.exportRepo.FindExportsByUserID(userID)
+}
+
+// GetArchivePath returns the path of the archive of a ready export of the user
+func (ds *DataExportService) GetArchivePath(userID, exportID uint) (string, error) {
+	export, err := ds.exportRepo.FindExportByID(exportID, userID)
+	if err != nil {
+		return "", err
+	}
+	if export == nil {
+		return "", ErrDataExportNotFound
+	}
+	if export.Status != model.DataExportStatusReady || (export.ExpiresAt != nil && !export.ExpiresAt.After(time.Now())) {
+		return "", ErrDataExportNotReady
+	}
+	return export.FilePath, nil
+}
+
+// ProcessNextExport creates the archive of the oldest pending export and returns the finished export, which is either READY or FAILED. Returns nil if there is nothing to process.
+func (ds *DataExportService) ProcessNextExport() (*model.DataExport, error) {
+	export, err := ds.exportRepo.ClaimNextExport()
+	if err != nil || export == nil {
+		return nil, err
+	}
+
+	filePath, err := ds.storage.Save(export.ID, func(w io.Writer) error {
+		return ds.writeArchive(export.UserID, w)
+	})
+	if err != nil {
+		log.Printf("Couldn't create data export %v of user %v: %v\n", export.ID, export.UserID, err)
+		return ds.exportRepo.MarkExportFailed(export.ID)
+	}
+	readyExport, err := ds.exportRepo.MarkExportReady(export.ID, filePath, time.Now().Add(ds.ttl))
+	if err != nil || readyExport == nil {
+		// the export was deleted meanwhile together with the account
+		_ = ds.storage.Remove(filePath)
+	}
+	return readyExport, err
+}
+
+// RemoveExpiredExports removes the archives of the exports whose download time is up
+func (ds *DataExportService) RemoveExpiredExports() error {
+	filePaths, err := ds.exportRepo.ExpireExports()
+	if err != nil {
+		return err
+	}
+	for _, filePath := range filePaths {
+		if err := ds.storage.Remove(filePath); err != nil {
+			log.Printf("Couldn't remove expired data export %v: %v\n", filePath, err)
+		}
+	}
+	return nil
+}
+
+// writeArchive writes the profile, chatroom memberships, sent messages, message views and attachments of the user into a zip archive
+func (ds *DataExportService) writeArchive(userID uint, w io.Writer) error {
+	user, err := ds.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user with id %v not found", userID)
+	}
+	settings, err := ds.userRepo.FindSettings(userID)
+	if err != nil {
+		return err
+	}
+	memberships, err := ds.exportRepo.FindChatroomMemberships(userID)
+	if err != nil {
+		return err
+	}
+
+	archive := dataexport.NewArchive(w, ds.staticDir)
+	profile := struct {
+		model.User
+		Settings *model.UserSettings `json:"settings"`
+	}{User: *user, Settings: settings}
+	if err := archive.WriteJSON("profile.json", profile); err != nil {
+		return err
+	}
+	if user.AvatarURL != "" {
+		if _, err := archive.AddStaticFile(user.AvatarURL, "avatar/"+path.Base(user.AvatarURL)); err != nil {
+			return err
+		}
+	}
+	if err := archive.WriteJSON("chatrooms.json", memberships); err != nil {
+		return err
+	}
+
+	// attachments are collected while writing the messages and copied afterwards, because the entries of a zip archive are written one after the other
+	attachments := []model.ExportedAttachment{}
+	messages, err := archive.CreateJSONArray("messages.json")
+	if err != nil {
+		return err
+	}
+	err = ds.exportRepo.ForEachSentMessage(userID, func(message model.ChatMessage) error {
+		if message.AttachmentURL != "" {
+			attachments = append(attachments, model.ExportedAttachment{MessageID: message.ID, AttachmentURL: message.AttachmentURL})
+		}
+		return messages.Write(message)
+	})
+	if err != nil {
+		return err
+	}
+	if err := messages.Close(); err != nil {
+		return err
+	}
+
+	views, err := archive.CreateJSONArray("message_views.json")
+	if err != nil {
+		return err
+	}
+	err = ds.exportRepo.ForEachMessageView(userID, func(view model.MessageView) error {
+		return views.Write(view)
+	})
+	if err != nil {
+		return err
+	}
+	if err := views.Close(); err != nil {
+		return err
+	}
+
+	for i, attachment := range attachments {
+		archivePath := fmt.Sprintf("attachments/%v_%v", attachment.MessageID, path.Base(attachment.AttachmentURL))
+		included, err := archive.AddStaticFile(attachment.AttachmentURL, archivePath)
+		if err != nil {
+			return err
+		}
+		if included {
+			attachments[i].ArchivePath = archivePath
+		}
+	}
+	// attachments which are not stored on this server are only listed with their URL
+	if err := archive.WriteJSON("attachments.json", attachments); err != nil {
+		return err
+	}
+	return archive.Close()
+}
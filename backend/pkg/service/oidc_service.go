@@ -0,0 +1,118 @@
+package service
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"backend/pkg/oidc"
+	"backend/pkg/repository"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrIdentityNotLinked is returned when an identity isn't linked to any user and auto-provisioning is disabled
+var ErrIdentityNotLinked = errors.New("no user is linked to this identity")
+
+type OIDCService struct {
+	provider         *oidc.Provider
+	userRepo         *repository.UserRepository
+	userIdentityRepo *repository.UserIdentityRepository
+	autoProvision    bool
+}
+
+func NewOIDCService(provider *oidc.Provider, userRepo *repository.UserRepository, userIdentityRepo *repository.UserIdentityRepository, autoProvision bool) *OIDCService {
+	return &OIDCService{provider: provider, userRepo: userRepo, userIdentityRepo: userIdentityRepo, autoProvision: autoProvision}
+}
+
+// AuthCodeURL returns the URL of the identity provider's login page
+func (o *OIDCService) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	return o.provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(codeVerifier))
+}
+
+// Login exchanges the authorization code and returns the user linked to the identity. An identity with a verified email is linked to the existing user with the same email. Unknown identities get a new user if auto-provisioning is enabled.
+func (o *OIDCService) Login(code, codeVerifier, nonce string) (*model.User, error) {
+	claims, err := o.provider.Exchange(code, codeVerifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+	user, err := o.userIdentityRepo.FindUserByIdentity(o.provider.Issuer(), claims.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	identity := model.UserIdentity{Provider: o.provider.Issuer(), Subject: claims.Subject, Email: claims.Email}
+	// emails that the provider hasn't verified can't be trusted to belong to the existing user
+	if claims.Email != "" && claims.EmailVerified {
+		user, err = o.userRepo.FindByEmail(claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			identity.UserID = user.ID
+			if err := o.userIdentityRepo.LinkIdentity(identity); err != nil {
+				return nil, err
+			}
+			if err := o.userRepo.SetEmailVerified(user.ID); err != nil {
+				return nil, err
+			}
+			user.EmailVerified = true
+			return user, nil
+		}
+	}
+
+	if !o.autoProvision {
+		return nil, ErrIdentityNotLinked
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("couldn't provision user: identity provider didn't return a verified email")
+	}
+	nickname, err := o.availableNickname(nicknameFromClaims(claims))
+	if err != nil {
+		return nil, err
+	}
+	return o.userIdentityRepo.CreateUserWithIdentity(model.User{
+		Nickname:  nickname,
+		Email:     strings.ToLower(claims.Email),
+		AvatarURL: claims.Picture,
+	}, identity)
+}
+
+func nicknameFromClaims(claims *oidc.Claims) string {
+	if claims.PreferredUsername != "" {
+		return claims.PreferredUsername
+	}
+	if claims.Name != "" {
+		return claims.Name
+	}
+	return strings.SplitN(claims.Email, "@", 2)[0]
+}
+
+// availableNickname makes the nickname from the identity provider valid and appends a numeric suffix until no other person uses it
+func (o *OIDCService) availableNickname(nickname string) (string, error) {
+	nickname, err := NormaliseNickname(nickname)
+	if err != nil {
+		nickname = "user"
+	}
+	// keep room for the suffix
+	if runes := []rune(nickname); len(runes) > config.NicknameMaxLength-5 {
+		nickname = string(runes[:config.NicknameMaxLength-5])
+	}
+	candidate := nickname
+	for i := 0; i < 10; i++ {
+		exists, err := o.userRepo.NicknameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%v-%v", nickname, suffix)
+	}
+	return "", fmt.Errorf("couldn't provision user: couldn't find an available nickname")
+}
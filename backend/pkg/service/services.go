@@ -1,21 +1,60 @@
 package service
 
 import (
+	"backend/pkg/avatar"
+	"backend/pkg/config"
+	"backend/pkg/dataexport"
+	"backend/pkg/mailer"
+	"backend/pkg/oidc"
 	"backend/pkg/repository"
+	"time"
 )
 
 // Services contains all the service structs
 type Services struct {
 	UserService     *UserService
 	ChatroomService *ChatroomService
+	AuthService     *AuthService
+	SessionService  *SessionService
+	BotService      *BotService
+	BlockService    *BlockService
+	ContactService  *ContactService
+	// ChatroomInviteService manages the invite links and join requests of group chatrooms
+	ChatroomInviteService *ChatroomInviteService
+	// DataExportService creates personal data exports
+	DataExportService *DataExportService
+	// OIDCService is nil if signing in with an OpenID Connect provider is not configured
+	OIDCService *OIDCService
 }
 
-// InitServices initialises all the services with given repositories with database connection
-func InitServices(repositories *repository.Repositories) *Services {
-	userService := NewUserService(repositories.UserRepo)
-	chatroomService := NewChatroomService(repositories.ChatroomRepo)
+// InitServices initialises all the services with given repositories with database connection. oidcProvider may be nil if OpenID Connect login is disabled.
+func InitServices(repositories *repository.Repositories, mailer mailer.Mailer, oidcProvider *oidc.Provider) *Services {
+	passwordPolicy := NewPasswordPolicyFromConfig()
+	avatarStorage := avatar.NewStorage(config.StaticDir())
+	userService := NewUserService(repositories.UserRepo, passwordPolicy, avatarStorage)
+	chatroomService := NewChatroomService(repositories.ChatroomRepo, repositories.PinnedMessageRepo, repositories.BlockRepo, repositories.ContactRepo, avatarStorage)
+	authService := NewAuthService(repositories.UserRepo, repositories.UserTokenRepo, repositories.RecoveryCodeRepo, mailer, passwordPolicy)
+	sessionService := NewSessionService(repositories.SessionRepo)
+	botService := NewBotService(repositories.UserRepo, repositories.APIKeyRepo, repositories.ChatroomRepo)
+	blockService := NewBlockService(repositories.BlockRepo, repositories.UserRepo)
+	chatroomInviteService := NewChatroomInviteService(repositories.ChatroomInviteRepo, repositories.ChatroomRepo)
+	contactService := NewContactService(repositories.ContactRepo, repositories.BlockRepo, repositories.UserRepo)
+	dataExportService := NewDataExportService(repositories.DataExportRepo, repositories.UserRepo, dataexport.NewStorage(config.DataExportDir()), config.StaticDir(),
+		time.Duration(config.DataExportTTLHours())*time.Hour)
+	var oidcService *OIDCService
+	if oidcProvider != nil {
+		oidcService = NewOIDCService(oidcProvider, repositories.UserRepo, repositories.UserIdentityRepo, config.OIDCAutoProvision())
+	}
 	return &Services{
-		UserService:     userService,
-		ChatroomService: chatroomService,
+		UserService:           userService,
+		ChatroomService:       chatroomService,
+		AuthService:           authService,
+		SessionService:        sessionService,
+		BotService:            botService,
+		BlockService:          blockService,
+		ContactService:        contactService,
+		ChatroomInviteService: chatroomInviteService,
+		DataExportService:     dataExportService,
+		OIDCService:           oidcService,
 	}
 }
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"backend/pkg/repository"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session doesn't exist, belongs to another user or is no longer active
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+}
+
+func NewSessionService(repo *repository.SessionRepository) *SessionService {
+	return &SessionService{sessionRepo: repo}
+}
+
+// CreateSession records a new login of the user. If deviceName is empty, it is derived from the user agent.
+// The device name is sent by the client, so it is cut to config.SessionDeviceNameMaxLength instead of failing the login.
+func (ss *SessionService) CreateSession(userID uint, deviceName, userAgent, ipAddress string) (*model.Session, error) {
+	deviceName = strings.TrimSpace(deviceName)
+	if runes := []rune(deviceName); len(runes) > config.SessionDeviceNameMaxLength {
+		deviceName = strings.TrimSpace(string(runes[:config.SessionDeviceNameMaxLength]))
+	}
+	if deviceName == "" {
+		deviceName = deviceNameFromUserAgent(userAgent)
+	}
+	return ss.sessionRepo.CreateSession(model.Session{
+		UserID:     userID,
+		DeviceName: deviceName,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		ExpiresAt:  time.Now().Add(config.AuthTokenTTLHours * time.Hour),
+	})
+}
+
+// ValidateSession checks that the session of the user is still active and records the activity. Returns ErrSessionNotFound if the session was revoked or has expired.
+func (ss *SessionService) ValidateSession(sessionID, userID uint) error {
+	session, err := ss.sessionRepo.FindActiveSession(sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	// the activity doesn't need to be precise, so avoid a write on every request
+	now := time.Now()
+	if now.Sub(session.LastActiveAt) > config.SessionActivityUpdateIntervalSeconds*time.Second {
+		return ss.sessionRepo.UpdateLastActiveAt(sessionID, now)
+	}
+	return nil
+}
+
+// GetSessions returns the active sessions of the user marking the current one
+func (ss *SessionService) GetSessions(userID, currentSessionID uint) ([]model.Session, error) {
+	sessions, err := ss.sessionRepo.FindActiveSessionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a single session of the user
+func (ss *SessionService) RevokeSession(userID, sessionID uint) error {
+	revoked, err := ss.sessionRepo.RevokeSessions(userID, []uint{sessionID})
+	if err != nil {
+		return err
+	}
+	if len(revoked) == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes all sessions of the user except the current one and returns the IDs of the revoked sessions
+func (ss *SessionService) RevokeOtherSessions(userID, currentSessionID uint) ([]uint, error) {
+	return ss.sessionRepo.RevokeSessionsExcept(userID, currentSessionID)
+}
+
+// deviceNameFromUserAgent builds a human readable device name like "Firefox on Windows" from the user agent
+func deviceNameFromUserAgent(userAgent string) string {
+	browser := firstMatch(userAgent, [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	})
+	os := firstMatch(userAgent, [][2]string{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"}, {"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	})
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
+
+func firstMatch(s string, candidates [][2]string) string {
+	for _, candidate := range candidates {
+		if strings.Contains(s, candidate[0]) {
+			return candidate[1]
+		}
+	}
+	return ""
+}
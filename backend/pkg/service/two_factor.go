@@ -0,0 +1,221 @@
+package service
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"backend/pkg/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidPassword is returned when re-authentication fails because of a wrong password
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrPasswordNotSet is returned when re-authenticating with a password a user who doesn't have one, e.g. because they signed up with OIDC
+	ErrPasswordNotSet = errors.New("the account has no password, confirm with an emailed confirmation token instead")
+	// ErrPasswordAlreadySet is returned when requesting a confirmation token for a user who can confirm with their password
+	ErrPasswordAlreadySet = errors.New("the account has a password, confirm with it instead")
+	// ErrInvalidTwoFactorCode is returned when neither a valid TOTP code nor an unused recovery code was provided
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor authentication code")
+	// ErrTooManyTwoFactorAttempts is returned when the second factor is locked after too many failed attempts
+	ErrTooManyTwoFactorAttempts = errors.New("too many failed two-factor authentication attempts, log in again later")
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling a user who already has two-factor authentication enabled
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled is returned when changing two-factor settings of a user who doesn't have it enabled
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorNotEnrolled is returned when confirming the enrolment before it was started
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrolment was not started")
+)
+
+// recoveryCodeEncoding is used to render recovery codes in lower case without ambiguous symbols
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+// BeginTwoFactorEnrolment generates a new TOTP secret for the user. Two-factor authentication gets enabled only after the user confirms a code generated from the secret.
+func (as *AuthService) BeginTwoFactorEnrolment(userID uint) (*model.TwoFactorEnrolment, error) {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := as.userRepo.SetPendingTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+	return &model.TwoFactorEnrolment{
+		Secret:     secret,
+		OtpauthURI: totp.URI(config.TwoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactorEnrolment enables two-factor authentication if the code matches the pending secret. Returns the newly generated recovery codes.
+func (as *AuthService) ConfirmTwoFactorEnrolment(userID uint, code string) ([]string, error) {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, _, err := as.userRepo.FindTOTPSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err := as.verifyTOTPCode(userID, secret, code); err != nil {
+		return nil, err
+	}
+	if err := as.userRepo.EnableTOTP(userID); err != nil {
+		return nil, err
+	}
+	return as.generateRecoveryCodes(userID)
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, consumes a recovery code of the user.
+// Every attempt is counted before the code is checked. After config.TwoFactorMaxFailedAttempts attempts without success the second factor is locked
+// for the lifetime of a challenge token, which invalidates the outstanding challenges, and ErrTooManyTwoFactorAttempts is returned until the lock expires.
+func (as *AuthService) VerifySecondFactor(userID uint, code string) error {
+	started, err := as.userRepo.StartTwoFactorAttempt(userID, config.TwoFactorMaxFailedAttempts, config.TwoFactorChallengeTokenTTLMinutes)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return ErrTooManyTwoFactorAttempts
+	}
+	if err := as.checkSecondFactor(userID, code); err != nil {
+		return err
+	}
+	return as.userRepo.ResetFailedTwoFactorAttempts(userID)
+}
+
+// checkSecondFactor checks a TOTP code or, failing that, consumes a recovery code of the user
+func (as *AuthService) checkSecondFactor(userID uint, code string) error {
+	secret, _, err := as.userRepo.FindTOTPSecret(userID)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	err = as.verifyTOTPCode(userID, secret, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+	used, err := as.recoveryCodeRepo.ConsumeRecoveryCode(userID, hashToken(normaliseRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// DisableTwoFactor disables two-factor authentication after re-authenticating the user with the password and a second factor
+func (as *AuthService) DisableTwoFactor(userID uint, password, code string) error {
+	if err := as.reauthenticate(userID, password, code); err != nil {
+		return err
+	}
+	if err := as.userRepo.DisableTOTP(userID); err != nil {
+		return err
+	}
+	return as.recoveryCodeRepo.DeleteRecoveryCodes(userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user after re-authenticating them with the password and a second factor
+func (as *AuthService) RegenerateRecoveryCodes(userID uint, password, code string) ([]string, error) {
+	if err := as.reauthenticate(userID, password, code); err != nil {
+		return nil, err
+	}
+	return as.generateRecoveryCodes(userID)
+}
+
+func (as *AuthService) reauthenticate(userID uint, password, code string) error {
+	user, err := as.findExistingUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+	return as.VerifySecondFactor(userID, code)
+}
+
+// checkPassword compares the password with the one of the user. Users without a password can't be checked, bcrypt would reject every password.
+func checkPassword(user *model.User, password string) error {
+	if user.PasswordHash == "" {
+		return ErrPasswordNotSet
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// verifyTOTPCode validates the code and records its time step so that the same code can't be replayed
+func (as *AuthService) verifyTOTPCode(userID uint, secret, code string) error {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	fresh, err := as.userRepo.UseTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user with new ones and returns them. Only their hashes are stored.
+func (as *AuthService) generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, config.TwoFactorRecoveryCodesCount)
+	hashes := make([]string, config.TwoFactorRecoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("couldn't generate recovery code: %v", err)
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+	if err := as.recoveryCodeRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (as *AuthService) findExistingUser(userID uint) (*model.User, error) {
+	user, err := as.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	return user, nil
+}
+
+// normaliseRecoveryCode removes separators and case differences so that codes can be typed loosely
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
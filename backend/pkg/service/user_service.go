@@ -1,20 +1,65 @@
 package service
 
 import (
+	"backend/pkg/avatar"
 	"backend/pkg/model"
 	"backend/pkg/repository"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo       *repository.UserRepository
+	passwordPolicy *PasswordPolicy
+	avatarStorage  *avatar.Storage
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{userRepo: repo}
+func NewUserService(repo *repository.UserRepository, passwordPolicy *PasswordPolicy, avatarStorage *avatar.Storage) *UserService {
+	return &UserService{userRepo: repo, passwordPolicy: passwordPolicy, avatarStorage: avatarStorage}
 }
 
-func (us *UserService) GetAllUsers() ([]model.User, error) {
-	return us.userRepo.FindAll()
+// GetDirectoryPage returns a page of the users matching the filter. The cursor is the NextCursor of the previous page or empty for the first page.
+// Returns ErrInvalidCursor if the cursor is malformed or was issued for another sort order.
+func (us *UserService) GetDirectoryPage(filter model.UserDirectoryFilter, cursor string, pageSize int) (model.UserPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = model.UserDirectorySortNickname
+	}
+	var after *repository.UserDirectoryCursor
+	if cursor != "" {
+		after = &repository.UserDirectoryCursor{}
+		if err := decodeCursor(cursor, after); err != nil {
+			return model.UserPage{}, err
+		}
+		if after.Sort != filter.Sort || after.Descending != filter.Descending {
+			return model.UserPage{}, ErrInvalidCursor
+		}
+	}
+	// Fetch one extra user to know whether there is a next page
+	users, err := us.userRepo.FindDirectoryPage(filter, after, pageSize+1)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	page := model.UserPage{Users: users}
+	if len(users) > pageSize {
+		page.Users = users[:pageSize]
+		last := page.Users[len(page.Users)-1]
+		next := repository.UserDirectoryCursor{Sort: filter.Sort, Descending: filter.Descending, ID: last.ID}
+		if filter.Sort == model.UserDirectorySortCreatedAt {
+			next.CreatedAt = last.CreatedAt
+		} else {
+			next.Nickname = strings.ToLower(last.Nickname)
+		}
+		if page.NextCursor, err = encodeCursor(next); err != nil {
+			return model.UserPage{}, err
+		}
+	}
+	return page, nil
 }
 
 // GetUserByID finds a user by their ID and returns the user details. Returns nil if user is not found.
@@ -22,16 +67,275 @@ func (us *UserService) GetUserByID(userID uint) (*model.User, error) {
 	return us.userRepo.FindByID(userID)
 }
 
+// CanSendMessages checks whether the user may send messages. Users have to verify their email address first, bots never do.
+func (us *UserService) CanSendMessages(userID uint) (bool, error) {
+	user, err := us.userRepo.FindByID(userID)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, fmt.Errorf("user with id %v not found", userID)
+	}
+	return user.EmailVerified || user.IsBot, nil
+}
+
 // GetUserByEmail finds a user by their email address and returns the user details. Returns nil if user is not found.
 func (us *UserService) GetUserByEmail(email string) (*model.User, error) {
 	return us.userRepo.FindByEmail(email)
 }
 
-// GetUsersBySearchTerm finds those users whose nickname or email contains the search term. Returns empty array if no user is found.
-func (us *UserService) GetUsersBySearchTerm(searchTerm string, excludedUsers []uint) ([]model.User, error) {
-	return us.userRepo.FindUserBySearchTerm(searchTerm, excludedUsers)
+// SearchUsers finds a page of users matching the search term, contacts and members of shared chatrooms first. Users blocked by or blocking the searcher are left out.
+// The cursor is the NextCursor of the previous page or empty for the first page. Returns ErrInvalidCursor if the cursor is malformed.
+func (us *UserService) SearchUsers(searchTerm string, searcherID uint, excludedUsers []uint, cursor string, pageSize int) (model.UserPage, error) {
+	var after *repository.UserSearchCursor
+	if cursor != "" {
+		after = &repository.UserSearchCursor{}
+		if err := decodeCursor(cursor, after); err != nil {
+			return model.UserPage{}, err
+		}
+	}
+	// Fetch one extra user to know whether there is a next page
+	hits, err := us.userRepo.FindUserBySearchTerm(searchTerm, searcherID, excludedUsers, after, pageSize+1)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	page := model.UserPage{Users: []model.User{}}
+	if len(hits) > pageSize {
+		hits = hits[:pageSize]
+		last := hits[len(hits)-1]
+		page.NextCursor, err = encodeCursor(repository.UserSearchCursor{Tier: last.Tier, Score: last.Score, ID: last.User.ID})
+		if err != nil {
+			return model.UserPage{}, err
+		}
+	}
+	for _, hit := range hits {
+		page.Users = append(page.Users, hit.User)
+	}
+	return page, nil
+}
+
+// RegisterUser validates the registration request and creates the new user. Returns a *ValidationError if the request is invalid or the email or nickname is taken.
+func (us *UserService) RegisterUser(request model.RegistrationRequest) (model.User, error) {
+	email, err := NormaliseEmail(request.Email)
+	if err != nil {
+		return model.User{}, err
+	}
+	nickname, err := NormaliseNickname(request.Nickname)
+	if err != nil {
+		return model.User{}, err
+	}
+	if err := us.passwordPolicy.Validate(request.Password); err != nil {
+		return model.User{}, err
+	}
+
+	existingUser, err := us.userRepo.FindByEmail(email)
+	if err != nil {
+		return model.User{}, err
+	}
+	if existingUser != nil {
+		return model.User{}, emailTakenError()
+	}
+	nicknameTaken, err := us.userRepo.NicknameExists(nickname)
+	if err != nil {
+		return model.User{}, err
+	}
+	if nicknameTaken {
+		return model.User{}, nicknameTakenError()
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.User{}, err
+	}
+	user, err := us.userRepo.AddNewUser(model.User{
+		Nickname:     nickname,
+		PasswordHash: string(hashedPassword),
+		Email:        email,
+	})
+	// a concurrent registration can still take the email or nickname after the checks above
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		return model.User{}, emailTakenError()
+	case errors.Is(err, repository.ErrNicknameTaken):
+		return model.User{}, nicknameTakenError()
+	}
+	return user, err
+}
+
+// UpdateProfile updates the specified profile fields of the user and returns the updated user. Returns a *ValidationError if a field is invalid or the nickname is taken.
+func (us *UserService) UpdateProfile(userID uint, request model.UpdateProfileRequest) (*model.User, error) {
+	user, err := us.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	nickname, avatarURL := user.Nickname, user.AvatarURL
+	if request.Nickname != nil {
+		if nickname, err = NormaliseNickname(*request.Nickname); err != nil {
+			return nil, err
+		}
+		// the user may change the case of their own nickname
+		if !strings.EqualFold(nickname, user.Nickname) {
+			nicknameTaken, err := us.userRepo.NicknameExists(nickname)
+			if err != nil {
+				return nil, err
+			}
+			if nicknameTaken {
+				return nil, nicknameTakenError()
+			}
+		}
+	}
+	if request.AvatarURL != nil {
+		if avatarURL, err = ValidateAvatarURL(*request.AvatarURL); err != nil {
+			return nil, err
+		}
+	}
+
+	updatedUser, err := us.userRepo.UpdateProfile(userID, nickname, avatarURL)
+	if errors.Is(err, repository.ErrNicknameTaken) {
+		return nil, nicknameTakenError()
+	}
+	if err == nil && updatedUser == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	return updatedUser, err
+}
+
+// UploadAvatar generates the avatar sizes from the uploaded image, stores them and sets them as the avatar of the user. The previously uploaded avatar is removed.
+// Returns a *ValidationError if the image is not accepted.
+func (us *UserService) UploadAvatar(userID uint, imageData []byte) (*model.User, error) {
+	user, err := us.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	images, err := avatar.Process(imageData, avatar.Sizes)
+	if errors.Is(err, avatar.ErrUnsupportedImage) || errors.Is(err, avatar.ErrImageTooLarge) {
+		return nil, &ValidationError{Code: ValidationCodeInvalidAvatar, Field: "avatar", Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	avatarURL, err := us.avatarStorage.Save(userID, images)
+	if err != nil {
+		return nil, err
+	}
+	if err := us.userRepo.UpdateAvatarURL(userID, avatarURL); err != nil {
+		_ = us.avatarStorage.Remove(avatarURL)
+		return nil, err
+	}
+	us.removeAvatar(user.AvatarURL)
+	user.AvatarURL = avatarURL
+	return user, nil
+}
+
+// SetStatus sets the custom status of the user and returns the updated user. Returns a *ValidationError if the status is invalid.
+func (us *UserService) SetStatus(userID uint, request model.SetUserStatusRequest) (*model.User, error) {
+	request, err := NormaliseStatus(request, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	user, err := us.userRepo.UpdateStatus(userID, request.Emoji, request.Text, request.ExpiresAt)
+	if err == nil && user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	return user, err
+}
+
+// ClearStatus removes the custom status of the user and returns the updated user
+func (us *UserService) ClearStatus(userID uint) (*model.User, error) {
+	user, err := us.userRepo.UpdateStatus(userID, "", "", nil)
+	if err == nil && user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	return user, err
+}
+
+// ClearExpiredStatuses clears the statuses which have expired and returns the users whose status was cleared
+func (us *UserService) ClearExpiredStatuses() ([]model.User, error) {
+	return us.userRepo.ClearExpiredStatuses()
+}
+
+// GetSettings returns the settings of the user
+func (us *UserService) GetSettings(userID uint) (*model.UserSettings, error) {
+	settings, err := us.userRepo.FindSettings(userID)
+	if err == nil && settings == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	return settings, err
+}
+
+// UpdateSettings updates the specified settings of the user and returns all settings. Returns a *ValidationError if a setting is invalid.
+func (us *UserService) UpdateSettings(userID uint, request model.UpdateUserSettingsRequest) (*model.UserSettings, error) {
+	settings, err := us.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	if request.OnlyContactsCanMessage != nil {
+		settings.OnlyContactsCanMessage = *request.OnlyContactsCanMessage
+	}
+	if request.ReadReceipts != nil {
+		settings.ReadReceipts = *request.ReadReceipts
+	}
+	if request.LastSeenVisibility != nil {
+		if err := ValidateLastSeenVisibility(*request.LastSeenVisibility); err != nil {
+			return nil, err
+		}
+		settings.LastSeenVisibility = *request.LastSeenVisibility
+	}
+	if err := us.userRepo.UpdateSettings(userID, *settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// UpdateLastSeen records that the user is online now
+func (us *UserService) UpdateLastSeen(userID uint) error {
+	return us.userRepo.UpdateLastSeen(userID)
+}
+
+// GetVisibleLastSeen returns when the users were last online for those whose last seen time the viewer may see according to the privacy settings of both.
+// Users missing from the map are hidden from the viewer.
+func (us *UserService) GetVisibleLastSeen(viewerID uint, userIDs []uint) (map[uint]*time.Time, error) {
+	if len(userIDs) == 0 {
+		return map[uint]*time.Time{}, nil
+	}
+	return us.userRepo.FindLastSeenVisibleTo(viewerID, userIDs)
+}
+
+// DeleteAccount anonymises the user's account, removes them from their chatrooms and deletes their uploaded avatar. The identity of the user should be confirmed beforehand.
+func (us *UserService) DeleteAccount(userID uint) (*model.DeletedAccount, error) {
+	user, err := us.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user with id %v not found", userID)
+	}
+	deletedAccount, err := us.userRepo.DeleteUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	us.removeAvatar(user.AvatarURL)
+	return deletedAccount, nil
+}
+
+// removeAvatar deletes the files of a no longer used avatar. Leftover files don't affect the users, so failures are only logged.
+func (us *UserService) removeAvatar(avatarURL string) {
+	if err := us.avatarStorage.Remove(avatarURL); err != nil {
+		log.Printf("Couldn't remove avatar %v: %v\n", avatarURL, err)
+	}
+}
+
+func emailTakenError() *ValidationError {
+	return &ValidationError{Code: ValidationCodeEmailTaken, Field: "email", Message: "a user with this email address already exists"}
 }
 
-func (us *UserService) CreateNewUser(user model.User) (model.User, error) {
-	return us.userRepo.AddNewUser(user)
+func nicknameTakenError() *ValidationError {
+	return &ValidationError{Code: ValidationCodeNicknameTaken, Field: "nickname", Message: "this nickname is already taken"}
 }
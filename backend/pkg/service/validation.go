@@ -0,0 +1,247 @@
+package service
+
+import (
+	"backend/pkg/config"
+	"backend/pkg/model"
+	"bufio"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validation error codes returned to the clients
+const (
+	ValidationCodeInvalidEmail     = "INVALID_EMAIL"
+	ValidationCodeEmailTaken       = "EMAIL_TAKEN"
+	ValidationCodeInvalidNickname  = "INVALID_NICKNAME"
+	ValidationCodeInvalidAvatarURL = "INVALID_AVATAR_URL"
+	ValidationCodeInvalidAvatar    = "INVALID_AVATAR"
+	ValidationCodeNicknameTaken    = "NICKNAME_TAKEN"
+	ValidationCodePasswordTooShort = "PASSWORD_TOO_SHORT"
+	ValidationCodePasswordTooLong  = "PASSWORD_TOO_LONG"
+	ValidationCodePasswordTooWeak  = "PASSWORD_TOO_WEAK"
+	ValidationCodePasswordBreached = "PASSWORD_BREACHED"
+	ValidationCodeInvalidStatus    = "INVALID_STATUS"
+	ValidationCodeInvalidSetting   = "INVALID_SETTING"
+	ValidationCodeInvalidChatroom  = "INVALID_CHATROOM"
+)
+
+// ValidationError is returned when user input doesn't satisfy the rules. Code is a stable identifier the clients can rely on.
+type ValidationError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// IsConflict tells whether the input is valid but clashes with existing data
+func (e *ValidationError) IsConflict() bool {
+	return e.Code == ValidationCodeEmailTaken || e.Code == ValidationCodeNicknameTaken
+}
+
+// PasswordPolicy validates new passwords
+type PasswordPolicy struct {
+	MinLength           int
+	MinCharacterClasses int
+	// blocklist contains lower cased breached passwords
+	blocklist map[string]bool
+}
+
+// NewPasswordPolicyFromConfig creates the password policy from the environment configuration. A missing blocklist file is logged and ignored.
+func NewPasswordPolicyFromConfig() *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:           config.PasswordMinLength(),
+		MinCharacterClasses: config.PasswordMinCharacterClasses(),
+		blocklist:           map[string]bool{},
+	}
+	if path := config.PasswordBlocklistFile(); path != "" {
+		blocklist, err := LoadPasswordBlocklist(path)
+		if err != nil {
+			log.Printf("Couldn't load password blocklist: %v. Breached passwords won't be rejected\n", err)
+		} else {
+			policy.blocklist = blocklist
+		}
+	}
+	return policy
+}
+
+// LoadPasswordBlocklist reads a file with one password per line. Empty lines and lines starting with # are ignored.
+func LoadPasswordBlocklist(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	blocklist := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return blocklist, nil
+}
+
+// Validate checks the password against the policy. Returns a *ValidationError if the password is rejected.
+func (p *PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &ValidationError{Code: ValidationCodePasswordTooShort, Field: "password", Message: fmt.Sprintf("password should have at least %v characters", p.MinLength)}
+	}
+	if len(password) > config.PasswordMaxLength {
+		return &ValidationError{Code: ValidationCodePasswordTooLong, Field: "password", Message: fmt.Sprintf("password should have at most %v bytes", config.PasswordMaxLength)}
+	}
+	if countCharacterClasses(password) < p.MinCharacterClasses {
+		return &ValidationError{Code: ValidationCodePasswordTooWeak, Field: "password", Message: fmt.Sprintf("password should contain at least %v of: lower case letters, upper case letters, digits, symbols", p.MinCharacterClasses)}
+	}
+	if p.blocklist[strings.ToLower(password)] {
+		return &ValidationError{Code: ValidationCodePasswordBreached, Field: "password", Message: "password is too common or appeared in a data breach"}
+	}
+	return nil
+}
+
+func countCharacterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// NormaliseEmail trims and lower cases the email and checks its syntax. Returns a *ValidationError if the email is invalid.
+func NormaliseEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	invalid := &ValidationError{Code: ValidationCodeInvalidEmail, Field: "email", Message: "email address is invalid"}
+	// ParseAddress also accepts display names ("Name <email>"), so require the address to be the whole input
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 255 {
+		return "", invalid
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", invalid
+	}
+	return email, nil
+}
+
+// NormaliseNickname trims the nickname and checks it against the nickname rules. Returns a *ValidationError if the nickname is invalid.
+func NormaliseNickname(nickname string) (string, error) {
+	nickname = strings.TrimSpace(nickname)
+	length := utf8.RuneCountInString(nickname)
+	if length < config.NicknameMinLength || length > config.NicknameMaxLength {
+		return "", &ValidationError{Code: ValidationCodeInvalidNickname, Field: "nickname", Message: fmt.Sprintf("nickname should have between %v and %v characters", config.NicknameMinLength, config.NicknameMaxLength)}
+	}
+	previous := rune(0)
+	for _, r := range nickname {
+		allowed := unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '.' || r == '_' || r == '-'
+		if !allowed || (r == ' ' && previous == ' ') {
+			return "", &ValidationError{Code: ValidationCodeInvalidNickname, Field: "nickname", Message: "nickname can contain only letters, digits, single spaces, dots, underscores and hyphens"}
+		}
+		previous = r
+	}
+	return nickname, nil
+}
+
+// ValidateAvatarURL accepts an empty URL (no avatar), a path of an uploaded file and http(s) URLs. Returns a *ValidationError if the URL is invalid.
+func ValidateAvatarURL(avatarURL string) (string, error) {
+	avatarURL = strings.TrimSpace(avatarURL)
+	if avatarURL == "" {
+		return "", nil
+	}
+	invalid := &ValidationError{Code: ValidationCodeInvalidAvatarURL, Field: "avatarURL", Message: "avatar URL should be an http(s) URL or a path of an uploaded file"}
+	if len(avatarURL) > 2048 {
+		return "", invalid
+	}
+	if strings.HasPrefix(avatarURL, "/static/") && !strings.Contains(avatarURL, "..") {
+		return avatarURL, nil
+	}
+	parsedURL, err := url.Parse(avatarURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return "", invalid
+	}
+	return avatarURL, nil
+}
+
+// NormaliseChatroomChanges trims the changed metadata of a group chatroom and checks it against the group rules. Returns a *ValidationError if a value is invalid.
+func NormaliseChatroomChanges(changes model.ChatroomChanges) (model.ChatroomChanges, error) {
+	if changes.GroupName != nil {
+		groupName := strings.TrimSpace(*changes.GroupName)
+		if groupName == "" || utf8.RuneCountInString(groupName) > config.GroupNameMaxLength || strings.IndexFunc(groupName, unicode.IsControl) >= 0 {
+			return changes, &ValidationError{Code: ValidationCodeInvalidChatroom, Field: "groupName", Message: fmt.Sprintf("group name should be a single line of 1 to %v characters", config.GroupNameMaxLength)}
+		}
+		changes.GroupName = &groupName
+	}
+	if changes.Description != nil {
+		description := strings.TrimSpace(*changes.Description)
+		if utf8.RuneCountInString(description) > config.GroupDescriptionMaxLength {
+			return changes, &ValidationError{Code: ValidationCodeInvalidChatroom, Field: "description", Message: fmt.Sprintf("description should have at most %v characters", config.GroupDescriptionMaxLength)}
+		}
+		changes.Description = &description
+	}
+	if changes.Topic != nil {
+		topic := strings.TrimSpace(*changes.Topic)
+		if utf8.RuneCountInString(topic) > config.GroupTopicMaxLength || strings.IndexFunc(topic, unicode.IsControl) >= 0 {
+			return changes, &ValidationError{Code: ValidationCodeInvalidChatroom, Field: "topic", Message: fmt.Sprintf("topic should be a single line of at most %v characters", config.GroupTopicMaxLength)}
+		}
+		changes.Topic = &topic
+	}
+	if changes.AvatarURL != nil {
+		avatarURL, err := ValidateAvatarURL(*changes.AvatarURL)
+		if err != nil {
+			return changes, err
+		}
+		changes.AvatarURL = &avatarURL
+	}
+	return changes, nil
+}
+
+// NormaliseStatus trims the status fields and checks them against the status rules. Returns a *ValidationError if the status is invalid.
+func NormaliseStatus(request model.SetUserStatusRequest, now time.Time) (model.SetUserStatusRequest, error) {
+	request.Emoji = strings.TrimSpace(request.Emoji)
+	request.Text = strings.TrimSpace(request.Text)
+	if utf8.RuneCountInString(request.Emoji) > config.UserStatusEmojiMaxLength || strings.IndexFunc(request.Emoji, unicode.IsSpace) >= 0 {
+		return request, &ValidationError{Code: ValidationCodeInvalidStatus, Field: "emoji", Message: "status emoji should be a single emoji"}
+	}
+	if utf8.RuneCountInString(request.Text) > config.UserStatusTextMaxLength || strings.IndexFunc(request.Text, unicode.IsControl) >= 0 {
+		return request, &ValidationError{Code: ValidationCodeInvalidStatus, Field: "text", Message: fmt.Sprintf("status text should be a single line of at most %v characters", config.UserStatusTextMaxLength)}
+	}
+	if request.Emoji == "" && request.Text == "" {
+		return request, &ValidationError{Code: ValidationCodeInvalidStatus, Field: "text", Message: "status emoji or text should be specified"}
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return request, &ValidationError{Code: ValidationCodeInvalidStatus, Field: "expiresAt", Message: "status expiry time should be in the future"}
+	}
+	return request, nil
+}
+
+// ValidateLastSeenVisibility checks that the visibility is one of EVERYONE, CONTACTS and NOBODY. Returns a *ValidationError otherwise.
+func ValidateLastSeenVisibility(visibility string) error {
+	switch visibility {
+	case model.LastSeenVisibilityEveryone, model.LastSeenVisibilityContacts, model.LastSeenVisibilityNobody:
+		return nil
+	}
+	return &ValidationError{Code: ValidationCodeInvalidSetting, Field: "lastSeenVisibility", Message: "last seen visibility should be EVERYONE, CONTACTS or NOBODY"}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"backend/pkg/model"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validationCode(err error) string {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, MinCharacterClasses: 2, blocklist: map[string]bool{"password1": true}}
+
+	assert.NoError(t, policy.Validate("correct horse 7"))
+	assert.Equal(t, ValidationCodePasswordTooShort, validationCode(policy.Validate("abc1")))
+	assert.Equal(t, ValidationCodePasswordTooLong, validationCode(policy.Validate(strings.Repeat("a1", 37))))
+	assert.Equal(t, ValidationCodePasswordTooWeak, validationCode(policy.Validate("abcdefghij")))
+	assert.Equal(t, ValidationCodePasswordBreached, validationCode(policy.Validate("PASSWORD1")))
+}
+
+func TestNormaliseEmail(t *testing.T) {
+	email, err := NormaliseEmail("  Jane.Doe@Example.COM ")
+	assert.NoError(t, err)
+	assert.Equal(t, "jane.doe@example.com", email)
+
+	for _, invalid := range []string{"", "jane", "jane@localhost", "Jane <jane@example.com>", "jane@example.", "a@b@example.com"} {
+		_, err := NormaliseEmail(invalid)
+		assert.Equal(t, ValidationCodeInvalidEmail, validationCode(err), invalid)
+	}
+}
+
+func TestNormaliseNickname(t *testing.T) {
+	nickname, err := NormaliseNickname("  Jane Doe_1 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Doe_1", nickname)
+
+	for _, invalid := range []string{"ab", strings.Repeat("a", 33), "jane@example.com", "jane  doe", "<script>"} {
+		_, err := NormaliseNickname(invalid)
+		assert.Equal(t, ValidationCodeInvalidNickname, validationCode(err), invalid)
+	}
+}
+
+func TestNormaliseStatus(t *testing.T) {
+	now := time.Now()
+	tomorrow := now.Add(24 * time.Hour)
+	status, err := NormaliseStatus(model.SetUserStatusRequest{Emoji: " 🌴 ", Text: " On vacation until Friday ", ExpiresAt: &tomorrow}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "🌴", status.Emoji)
+	assert.Equal(t, "On vacation until Friday", status.Text)
+
+	yesterday := now.Add(-24 * time.Hour)
+	for _, invalid := range []model.SetUserStatusRequest{
+		{},
+		{Emoji: "🌴 🌴"},
+		{Text: strings.Repeat("a", 101)},
+		{Text: "line\nbreak"},
+		{Text: "In a meeting", ExpiresAt: &yesterday},
+	} {
+		_, err := NormaliseStatus(invalid, now)
+		assert.Equal(t, ValidationCodeInvalidStatus, validationCode(err), invalid)
+	}
+}
+
+func TestNormaliseChatroomChanges(t *testing.T) {
+	groupName, topic := "  Hiking club ", " Next trip: Saturday "
+	changes, err := NormaliseChatroomChanges(model.ChatroomChanges{GroupName: &groupName, Topic: &topic})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hiking club", *changes.GroupName)
+	assert.Equal(t, "Next trip: Saturday", *changes.Topic)
+	assert.Nil(t, changes.Description)
+
+	empty, longDescription, multilineTopic, avatarURL := " ", strings.Repeat("a", 1001), "line\nbreak", "ftp://example.com/a.png"
+	for _, invalid := range []model.ChatroomChanges{
+		{GroupName: &empty},
+		{Description: &longDescription},
+		{Topic: &multilineTopic},
+		{AvatarURL: &avatarURL},
+	} {
+		_, err := NormaliseChatroomChanges(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
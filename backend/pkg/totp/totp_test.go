@@ -0,0 +1,56 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238Secret is the SHA1 test key from RFC 6238 appendix B
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes, the 6 digit codes are their last 6 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := GenerateCode(rfc6238Secret, Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "time %v", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := GenerateCode(rfc6238Secret, Step(now))
+	assert.NoError(t, err)
+
+	step, ok := Validate(rfc6238Secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// the previous step is still accepted, older ones are not
+	_, ok = Validate(rfc6238Secret, code, now.Add(Period*time.Second))
+	assert.True(t, ok)
+	_, ok = Validate(rfc6238Secret, code, now.Add(2*Period*time.Second))
+	assert.False(t, ok)
+
+	_, ok = Validate(rfc6238Secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("ChatApp", "user1@example.com", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/ChatApp:user1@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=ChatApp")
+}
@@ -169,7 +169,12 @@ const ChatWindow = ({ conversation, setConversation, ws, currentUser }) => {
       </Row>
       <Row className="message-list">
         <Col>
-          {conversation.messages.length > 0 ? conversation.messages.map((message, idx) => (
+          {conversation.messages.length > 0 ? conversation.messages.map((message, idx) => message.kind === 'SYSTEM' ? (
+            // system messages about membership changes are shown as a notice without read receipts
+            <div key={idx} className="message system" data-id={message.id}>
+              <div className="message-content">{message.text}</div>
+            </div>
+          ) : (
             <div
               key={idx}
               className={`message ${message.senderID === currentUser.id ? 'sent' : 'received'}`}
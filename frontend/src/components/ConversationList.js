@@ -2,9 +2,17 @@ import React from 'react';
 import { ListGroup } from 'react-bootstrap';
 import './ConversationList.css';
 
-const ConversationList = ({ conversations = [], onConverstationSelect }) => {
+const ConversationList = ({ conversations = [], onConverstationSelect, onLoadMore }) => {
+  // load the next page of the chat list when the list is scrolled close to the end
+  const handleScroll = (e) => {
+    const { scrollTop, scrollHeight, clientHeight } = e.currentTarget;
+    if (onLoadMore && scrollHeight - scrollTop - clientHeight < 50) {
+      onLoadMore();
+    }
+  };
+
   return (
-    <div className="conversation-list-container">
+    <div className="conversation-list-container" onScroll={handleScroll}>
       <ListGroup>
         {conversations.length > 0 ?
           conversations.map((conversation, idx) => (
@@ -1,4 +1,4 @@
-import React, { useEffect, useState } from 'react'
+import React, { useEffect, useRef, useState } from 'react'
 import { Container, Row, Col } from 'react-bootstrap'
 import ConversationList from './ConversationList'
 import ChatWindow from './ChatWindow'
@@ -138,6 +138,23 @@ const MainChatPage = () => {
                 ).toLocaleTimeString(),
                 unreadCount: messageData.createPrivateChatroom.unreadCount,
             }
+            // The users already had a private chatroom, so the message was added to it
+            const existingConversation = prevConversations.find(
+                (conversation) => conversation.id === newConversation.id,
+            )
+            if (existingConversation) {
+                newConversation.participants = existingConversation.participants
+                newConversation.messages = [
+                    ...existingConversation.messages,
+                    ...newConversation.messages,
+                ]
+                newConversation.unreadCount =
+                    existingConversation.unreadCount +
+                    (messageData.createPrivateChatroom.chatMessage.senderID ===
+                    currentUser.id
+                        ? 0
+                        : 1)
+            }
             // Update the selected conversation if the current user is the sender (initiator of the chatroom)
             if (
                 messageData.createPrivateChatroom.chatMessage.senderID ===
@@ -145,8 +162,13 @@ const MainChatPage = () => {
             ) {
                 setSelectedConversation(newConversation)
             }
-            // Add the new conversation to the conversations array
-            return [newConversation, ...prevConversations]
+            // Add the new conversation to the top of the conversations array
+            return [
+                newConversation,
+                ...prevConversations.filter(
+                    (conversation) => conversation.id !== newConversation.id,
+                ),
+            ]
         })
     }
 
@@ -357,39 +379,116 @@ const MainChatPage = () => {
         }
     }
 
-    useEffect(() => {
-        if (!currentUser) {
+    // The chat list is paginated: the first page is loaded right away and the next ones when the list is scrolled to the end
+    const [chatListCursor, setChatListCursor] = useState('')
+    const isChatListLoading = useRef(false)
+    const fetchChatListPage = async (cursor) => {
+        if (isChatListLoading.current) {
             return
         }
-        const fetchChatrooms = async () => {
-            try {
-                const response = await fetch(
-                    `${API_URL}/users/${currentUser.id}/chatrooms`,
-                    {
-                        method: 'GET',
-                        headers: { Authorization: `Bearer ${token}` },
-                    },
-                )
-
-                if (!response.ok) {
-                    throw new Error('Failed to fetch chatrooms')
-                }
+        isChatListLoading.current = true
+        try {
+            const response = await fetch(
+                `${API_URL}/users/${currentUser.id}/chatrooms?cursor=${encodeURIComponent(cursor)}`,
+                {
+                    method: 'GET',
+                    headers: { Authorization: `Bearer ${token}` },
+                },
+            )
 
-                const data = await response.json()
-                console.log('Fetched chatrooms:', data)
-                setConversations(data.map(resolveConversationAdditionalDetails))
-            } catch (error) {
-                console.error('Failed to fetch chatrooms:', error)
+            if (!response.ok) {
+                throw new Error('Failed to fetch chatrooms')
             }
+
+            const data = await response.json()
+            console.log('Fetched chatrooms:', data.chatrooms)
+            // The chat list only has the last message and the other participant of private chatrooms, the rest is loaded when the conversation is selected
+            const pageConversations = data.chatrooms.map((chatroom) => ({
+                ...resolveConversationAdditionalDetails({
+                    ...chatroom,
+                    participants: chatroom.otherParticipant
+                        ? [currentUser, chatroom.otherParticipant]
+                        : [],
+                    messages: chatroom.lastMessage
+                        ? [chatroom.lastMessage]
+                        : [],
+                }),
+                historyLoaded: false,
+            }))
+            setConversations((prevConversations) => {
+                // the first page replaces the list, the next ones skip conversations which were already added, e.g. by a new message
+                const previous = cursor ? prevConversations : []
+                return [
+                    ...previous,
+                    ...pageConversations.filter(
+                        (conversation) =>
+                            !previous.some(
+                                (prevConversation) =>
+                                    prevConversation.id === conversation.id,
+                            ),
+                    ),
+                ]
+            })
+            setChatListCursor(data.nextCursor || null)
+        } catch (error) {
+            console.error('Failed to fetch chatrooms:', error)
+        } finally {
+            isChatListLoading.current = false
         }
+    }
 
-        fetchChatrooms()
+    const handleLoadMoreConversations = () => {
+        if (chatListCursor) {
+            fetchChatListPage(chatListCursor)
+        }
+    }
+
+    useEffect(() => {
+        if (!currentUser) {
+            return
+        }
+        fetchChatListPage('')
     }, [currentUser, token])
 
     if (isLoading) {
         return <div>Loading the user...</div>
     }
 
+    // Select the conversation and load its message history and participants the first time
+    const handleConversationSelect = async (conversation) => {
+        setSelectedConversation(conversation)
+        if (!conversation.id || conversation.historyLoaded) {
+            return
+        }
+        try {
+            const response = await fetch(
+                `${API_URL}/chatrooms/${conversation.id}`,
+                {
+                    method: 'GET',
+                    headers: { Authorization: `Bearer ${token}` },
+                },
+            )
+            if (!response.ok) {
+                throw new Error('Failed to fetch chatroom')
+            }
+            const chatroom = await response.json()
+            setConversations((prevConversations) =>
+                prevConversations.map((prevConversation) =>
+                    prevConversation.id === chatroom.id
+                        ? {
+                              ...prevConversation,
+                              participants: chatroom.participants || [],
+                              messages: chatroom.messages || [],
+                              historyLoaded: true,
+                          }
+                        : prevConversation,
+                ),
+            )
+        } catch (error) {
+            console.error('Failed to fetch chatroom:', error)
+        }
+    }
+
     console.log('Conversations:', conversations)
 
     const handleUserSelect = (selectedUser) => {
@@ -406,7 +505,7 @@ const MainChatPage = () => {
         if (existingConversation) {
             // If a conversation with the selected user exists, select it
             console.log('Existing conversation found:', existingConversation)
-            setSelectedConversation(existingConversation)
+            handleConversationSelect(existingConversation)
         } else {
             // If no conversation exists, create a new one
             const emptyConversation = resolveConversationAdditionalDetails({
@@ -425,7 +524,8 @@ const MainChatPage = () => {
                     <SearchBar onSelect={handleUserSelect} />
                     <ConversationList
                         conversations={conversations}
-                        onConverstationSelect={setSelectedConversation}
+                        onConverstationSelect={handleConversationSelect}
+                        onLoadMore={handleLoadMoreConversations}
                     />
                 </Col>
                 <Col md={8}>
@@ -23,7 +23,7 @@ function SearchBar({ onSelect }) {
         // Set a new timeout to delay sending the HTTP request
         timeout = setTimeout(async () => {
             try {
-                const response = await fetch(`${API_URL}/users/search?searchTerm=${query}`, {
+                const response = await fetch(`${API_URL}/users/search?searchTerm=${encodeURIComponent(query)}`, {
                     method: 'GET',
                     headers: {
                         'Content-Type': 'application/json',
@@ -33,7 +33,7 @@ function SearchBar({ onSelect }) {
                 if (response.ok) {
                     const searchData = await response.json();
                     console.log("Search result:", searchData);
-                    setSearchResults(searchData);
+                    setSearchResults(searchData.users);
                 } else if (response.status === 401) {
                     navigate('/login')
                 }